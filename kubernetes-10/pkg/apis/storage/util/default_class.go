@@ -0,0 +1,34 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DefaultClassIndexes returns the indexes of the StorageClasses, given by
+// their ObjectMeta, that are annotated as the default class. More than one
+// index means the default class is ambiguous.
+func DefaultClassIndexes(objectMetas []metav1.ObjectMeta) []int {
+	var indexes []int
+	for i := range objectMetas {
+		if IsDefaultAnnotation(objectMetas[i]) {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"github.com/sourcegraph/monorepo-test-1/kubernetes-10/pkg/apis/storage"
+)
+
+// sortedParameters returns the parameters as key=value pairs sorted by key,
+// so that they can be compared and reported in a deterministic order.
+func sortedParameters(parameters map[string]string) []string {
+	pairs := make([]string, 0, len(parameters))
+	for k, v := range parameters {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(pairs)
+	return pairs
+}
+
+func TestStorageClassConversionRoundTrip(t *testing.T) {
+	testCases := map[string]map[string]string{
+		"nil parameters":               nil,
+		"empty parameters":             {},
+		"parameters with empty values": {"type": "pd-ssd", "zone": "", "": "unnamed"},
+	}
+
+	for name, parameters := range testCases {
+		class := &StorageClass{
+			ObjectMeta:  metav1.ObjectMeta{Name: "fast", Annotations: map[string]string{"a": "b"}},
+			Provisioner: "kubernetes.io/gce-pd",
+			Parameters:  parameters,
+		}
+
+		internal := &storage.StorageClass{}
+		if err := Convert_v1beta1_StorageClass_To_storage_StorageClass(class, internal, nil); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if expected, actual := sortedParameters(parameters), sortedParameters(internal.Parameters); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("%s: expected internal parameters %v, got %v", name, expected, actual)
+		}
+		out := &StorageClass{}
+		if err := Convert_storage_StorageClass_To_v1beta1_StorageClass(internal, out, nil); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if expected, actual := sortedParameters(parameters), sortedParameters(out.Parameters); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("%s: expected parameters %v after round trip, got %v", name, expected, actual)
+		}
+		if !reflect.DeepEqual(out, class) {
+			t.Errorf("%s: expected %#v after round trip, got %#v", name, class, out)
+		}
+	}
+}
+
+func TestStorageClassListConversionRoundTrip(t *testing.T) {
+	list := &StorageClassList{
+		ListMeta: metav1.ListMeta{ResourceVersion: "10"},
+		Items: []StorageClass{
+			{
+				ObjectMeta:  metav1.ObjectMeta{Name: "fast"},
+				Provisioner: "kubernetes.io/gce-pd",
+				Parameters:  map[string]string{"type": "pd-ssd", "zone": ""},
+			},
+			{
+				ObjectMeta:  metav1.ObjectMeta{Name: "slow"},
+				Provisioner: "kubernetes.io/gce-pd",
+			},
+		},
+	}
+
+	internal := &storage.StorageClassList{}
+	if err := Convert_v1beta1_StorageClassList_To_storage_StorageClassList(list, internal, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := &StorageClassList{}
+	if err := Convert_storage_StorageClassList_To_v1beta1_StorageClassList(internal, out, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(out, list) {
+		t.Errorf("expected %#v after round trip, got %#v", list, out)
+	}
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	storageutil "github.com/sourcegraph/monorepo-test-1/kubernetes-10/pkg/apis/storage/util"
+)
+
+// CopyWithParameters returns a shallow copy of the StorageClass whose
+// Parameters are the Parameters of the StorageClass merged with extra, values
+// in extra taking precedence. Only the Parameters map is newly allocated; all
+// other fields, including the maps of ObjectMeta, are shared with the original
+// and must not be mutated through the copy. Use DeepCopy if they need to be.
+func (class *StorageClass) CopyWithParameters(extra map[string]string) *StorageClass {
+	out := *class
+	out.Parameters = make(map[string]string, len(class.Parameters)+len(extra))
+	for k, v := range class.Parameters {
+		out.Parameters[k] = v
+	}
+	for k, v := range extra {
+		out.Parameters[k] = v
+	}
+	return &out
+}
+
+// MarshalStorageClassTo marshals class into dAtA like class.MarshalTo, which
+// dAtA must be at least class.Size() bytes long for. The StorageClass must not
+// be mutated while it is being marshaled. If it grows nonetheless, e.g.
+// because Parameters are added concurrently, and no longer fits into dAtA, an
+// error is returned where MarshalTo panics.
+func MarshalStorageClassTo(class *StorageClass, dAtA []byte) (n int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(runtime.Error); !ok {
+				panic(r)
+			}
+			n, err = 0, fmt.Errorf("proto: StorageClass %q does not fit into a buffer of %d bytes, was it mutated while marshaling? %v", class.Name, len(dAtA), r)
+		}
+	}()
+	return class.MarshalTo(dAtA)
+}
+
+// FilterByProvisioner returns the StorageClasses of list that use provisioner.
+func FilterByProvisioner(list *StorageClassList, provisioner string) []StorageClass {
+	var classes []StorageClass
+	for i := range list.Items {
+		if list.Items[i].Provisioner == provisioner {
+			classes = append(classes, list.Items[i])
+		}
+	}
+	return classes
+}
+
+// DefaultStorageClass returns the StorageClass of classes annotated as the
+// default one, or nil if there is none. It returns an error if more than one
+// StorageClass is annotated as the default.
+func DefaultStorageClass(classes []StorageClass) (*StorageClass, error) {
+	objectMetas := make([]metav1.ObjectMeta, 0, len(classes))
+	for i := range classes {
+		objectMetas = append(objectMetas, classes[i].ObjectMeta)
+	}
+	defaults := storageutil.DefaultClassIndexes(objectMetas)
+	switch len(defaults) {
+	case 0:
+		return nil, nil
+	case 1:
+		return &classes[defaults[0]], nil
+	}
+	names := make([]string, 0, len(defaults))
+	for _, i := range defaults {
+		names = append(names, classes[i].Name)
+	}
+	return nil, fmt.Errorf("%d default StorageClasses were found: %s", len(defaults), strings.Join(names, ", "))
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	storageutil "github.com/sourcegraph/monorepo-test-1/kubernetes-10/pkg/apis/storage/v1beta1/util"
+)
+
+func TestCopyWithParameters(t *testing.T) {
+	class := &StorageClass{
+		ObjectMeta:  metav1.ObjectMeta{Name: "fast"},
+		Provisioner: "kubernetes.io/gce-pd",
+		Parameters:  map[string]string{"type": "pd-ssd", "zone": "us-central1-a"},
+	}
+
+	out := class.CopyWithParameters(map[string]string{"zone": "us-central1-b", "fsType": "ext4"})
+
+	expectedParameters := map[string]string{"type": "pd-ssd", "zone": "us-central1-b", "fsType": "ext4"}
+	if !reflect.DeepEqual(out.Parameters, expectedParameters) {
+		t.Errorf("expected parameters %v, got %v", expectedParameters, out.Parameters)
+	}
+	if out.Name != class.Name || out.Provisioner != class.Provisioner {
+		t.Errorf("expected name and provisioner to be copied, got %q and %q", out.Name, out.Provisioner)
+	}
+
+	originalParameters := map[string]string{"type": "pd-ssd", "zone": "us-central1-a"}
+	if !reflect.DeepEqual(class.Parameters, originalParameters) {
+		t.Errorf("expected original parameters to be unchanged, got %v", class.Parameters)
+	}
+
+	out.Parameters["type"] = "pd-standard"
+	if class.Parameters["type"] != "pd-ssd" {
+		t.Errorf("expected parameters of the copy not to be shared with the original")
+	}
+
+	if empty := (&StorageClass{}).CopyWithParameters(nil); empty.Parameters == nil || len(empty.Parameters) != 0 {
+		t.Errorf("expected empty parameters, got %v", empty.Parameters)
+	}
+}
+
+func TestMarshalStorageClassTo(t *testing.T) {
+	class := &StorageClass{
+		ObjectMeta:  metav1.ObjectMeta{Name: "fast"},
+		Provisioner: "kubernetes.io/gce-pd",
+		Parameters:  map[string]string{"type": "pd-ssd"},
+	}
+
+	dAtA := make([]byte, class.Size())
+	n, err := MarshalStorageClassTo(class, dAtA)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != len(dAtA) {
+		t.Errorf("expected %d bytes, got %d", len(dAtA), n)
+	}
+
+	// Simulate the Parameters map growing after the buffer was sized.
+	class.Parameters["zone"] = "us-central1-a"
+	if _, err := MarshalStorageClassTo(class, dAtA); err == nil {
+		t.Errorf("expected an error for a buffer smaller than the StorageClass")
+	}
+}
+
+func TestFilterByProvisioner(t *testing.T) {
+	list := &StorageClassList{
+		Items: []StorageClass{
+			{ObjectMeta: metav1.ObjectMeta{Name: "fast"}, Provisioner: "kubernetes.io/gce-pd"},
+			{ObjectMeta: metav1.ObjectMeta{Name: "nfs"}, Provisioner: "example.com/nfs"},
+			{ObjectMeta: metav1.ObjectMeta{Name: "slow"}, Provisioner: "kubernetes.io/gce-pd"},
+		},
+	}
+
+	classes := FilterByProvisioner(list, "kubernetes.io/gce-pd")
+	if len(classes) != 2 || classes[0].Name != "fast" || classes[1].Name != "slow" {
+		t.Errorf("expected classes fast and slow, got %v", classes)
+	}
+	if classes := FilterByProvisioner(list, "example.com/unknown"); len(classes) != 0 {
+		t.Errorf("expected no classes, got %v", classes)
+	}
+}
+
+func TestDefaultStorageClass(t *testing.T) {
+	newClass := func(name string, isDefault bool) StorageClass {
+		class := StorageClass{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		if isDefault {
+			class.Annotations = map[string]string{storageutil.IsDefaultStorageClassAnnotation: "true"}
+		}
+		return class
+	}
+
+	class, err := DefaultStorageClass([]StorageClass{newClass("fast", false), newClass("slow", true)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if class == nil || class.Name != "slow" {
+		t.Errorf("expected the default class slow, got %v", class)
+	}
+
+	class, err = DefaultStorageClass([]StorageClass{newClass("fast", false)})
+	if err != nil || class != nil {
+		t.Errorf("expected no default class and no error, got %v and %v", class, err)
+	}
+
+	_, err = DefaultStorageClass([]StorageClass{newClass("fast", true), newClass("slow", true)})
+	if err == nil {
+		t.Errorf("expected an error for multiple default classes")
+	}
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package validation
+
+import (
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"github.com/sourcegraph/monorepo-test-1/kubernetes-10/pkg/apis/storage"
+	storageutil "github.com/sourcegraph/monorepo-test-1/kubernetes-10/pkg/apis/storage/util"
+)
+
+// ValidateSingleDefault tests that at most one StorageClass in the list is
+// marked as the default class. Otherwise dynamic provisioning picks one of
+// them nondeterministically. The error lists all classes marked as default.
+func ValidateSingleDefault(list *storage.StorageClassList) field.ErrorList {
+	allErrs := field.ErrorList{}
+	objectMetas := make([]metav1.ObjectMeta, 0, len(list.Items))
+	for i := range list.Items {
+		objectMetas = append(objectMetas, list.Items[i].ObjectMeta)
+	}
+	var defaults []string
+	for _, i := range storageutil.DefaultClassIndexes(objectMetas) {
+		defaults = append(defaults, list.Items[i].Name)
+	}
+	if len(defaults) > 1 {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("items"), defaults, "more than one StorageClass is marked as default: "+strings.Join(defaults, ", ")))
+	}
+	return allErrs
+}
+
+// DefaultAnnotationWarnings returns a warning for each default class
+// annotation of a StorageClass whose value is neither "true" nor "false".
+// Only "true" marks the class as default, so values like "True" or "yes" are
+// most likely typos that silently leave the class a regular one. They are
+// not rejected, as existing classes may carry them.
+func DefaultAnnotationWarnings(meta metav1.ObjectMeta) []string {
+	var warnings []string
+	for _, annotation := range []string{storageutil.IsDefaultStorageClassAnnotation, storageutil.BetaIsDefaultStorageClassAnnotation} {
+		value, exists := meta.Annotations[annotation]
+		if !exists || value == "true" || value == "false" {
+			continue
+		}
+		warnings = append(warnings, fmt.Sprintf("annotation %s has value %q, which does not mark the StorageClass as default: only \"true\" does", annotation, value))
+	}
+	return warnings
+}
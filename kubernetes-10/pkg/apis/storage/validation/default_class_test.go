@@ -0,0 +1,107 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package validation
+
+import (
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"github.com/sourcegraph/monorepo-test-1/kubernetes-10/pkg/apis/storage"
+)
+
+func TestValidateSingleDefault(t *testing.T) {
+	class := func(name string, isDefault bool) storage.StorageClass {
+		sc := storage.StorageClass{
+			ObjectMeta:  metav1.ObjectMeta{Name: name},
+			Provisioner: "kubernetes.io/gce-pd",
+		}
+		if isDefault {
+			sc.Annotations = map[string]string{"storageclass.kubernetes.io/is-default-class": "true"}
+		}
+		return sc
+	}
+
+	testCases := map[string]struct {
+		classes          []storage.StorageClass
+		expectedDefaults []string
+	}{
+		"no default": {
+			classes: []storage.StorageClass{class("slow", false), class("fast", false)},
+		},
+		"one default": {
+			classes: []storage.StorageClass{class("slow", true), class("fast", false)},
+		},
+		"two defaults": {
+			classes:          []storage.StorageClass{class("slow", true), class("fast", false), class("standard", true)},
+			expectedDefaults: []string{"slow", "standard"},
+		},
+	}
+	for name, tc := range testCases {
+		errs := ValidateSingleDefault(&storage.StorageClassList{Items: tc.classes})
+		if len(tc.expectedDefaults) == 0 {
+			if len(errs) != 0 {
+				t.Errorf("%s: expected success: %v", name, errs)
+			}
+			continue
+		}
+		if len(errs) != 1 {
+			t.Errorf("%s: expected exactly one error, got %v", name, errs)
+			continue
+		}
+		for _, className := range tc.expectedDefaults {
+			if !strings.Contains(errs[0].Detail, className) {
+				t.Errorf("%s: expected error to list %q, got %q", name, className, errs[0].Detail)
+			}
+		}
+	}
+}
+
+func TestDefaultAnnotationWarnings(t *testing.T) {
+	testCases := map[string]struct {
+		annotations      map[string]string
+		expectedWarnings int
+	}{
+		"true": {
+			annotations: map[string]string{"storageclass.kubernetes.io/is-default-class": "true"},
+		},
+		"false": {
+			annotations: map[string]string{"storageclass.kubernetes.io/is-default-class": "false"},
+		},
+		"True": {
+			annotations:      map[string]string{"storageclass.kubernetes.io/is-default-class": "True"},
+			expectedWarnings: 1,
+		},
+		"yes": {
+			annotations:      map[string]string{"storageclass.kubernetes.io/is-default-class": "yes"},
+			expectedWarnings: 1,
+		},
+		"yes in beta annotation": {
+			annotations:      map[string]string{"storageclass.beta.kubernetes.io/is-default-class": "yes"},
+			expectedWarnings: 1,
+		},
+		"absent": {
+			annotations: map[string]string{"other": "yes"},
+		},
+	}
+	for name, tc := range testCases {
+		warnings := DefaultAnnotationWarnings(metav1.ObjectMeta{Name: "fast", Annotations: tc.annotations})
+		if len(warnings) != tc.expectedWarnings {
+			t.Errorf("%s: expected %d warnings, got %v", name, tc.expectedWarnings, warnings)
+		}
+	}
+}
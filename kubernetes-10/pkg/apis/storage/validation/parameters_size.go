@@ -0,0 +1,58 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package validation
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// TotalParametersSizeLimitB is a byte budget for the parameters of a
+// StorageClass that keeps the object well below the etcd object size limit.
+const TotalParametersSizeLimitB int = 256 * (1 << 10) // 256 kB
+
+// ValidateParametersSize tests that the parameters of a StorageClass do not
+// take more than maxBytes bytes when serialized.
+func ValidateParametersSize(params map[string]string, maxBytes int) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if size := ParametersSize(params); size > maxBytes {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("parameters"), fmt.Sprintf("%d bytes", size), fmt.Sprintf("must take at most %d bytes when serialized", maxBytes)))
+	}
+	return allErrs
+}
+
+// ParametersSize returns the number of bytes the parameters of a StorageClass
+// take in its protobuf serialization, as computed by its Size method.
+func ParametersSize(params map[string]string) int {
+	n := 0
+	for k, v := range params {
+		entrySize := 1 + len(k) + sizeOfVarint(uint64(len(k))) + 1 + len(v) + sizeOfVarint(uint64(len(v)))
+		n += 1 + entrySize + sizeOfVarint(uint64(entrySize))
+	}
+	return n
+}
+
+// sizeOfVarint returns the number of bytes of x encoded as a protobuf varint.
+func sizeOfVarint(x uint64) int {
+	n := 1
+	for x >= 1<<7 {
+		x >>= 7
+		n++
+	}
+	return n
+}
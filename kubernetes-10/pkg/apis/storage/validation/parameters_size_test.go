@@ -0,0 +1,62 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package validation
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParametersSize(t *testing.T) {
+	testCases := map[string]struct {
+		params       map[string]string
+		expectedSize int
+	}{
+		"no parameters": {nil, 0},
+		// tag, length, key tag, key length, key, value tag, value length, value
+		"one parameter": {map[string]string{"type": "gp2"}, 1 + 1 + 1 + 1 + 4 + 1 + 1 + 3},
+		"two byte value length": {
+			map[string]string{"k": strings.Repeat("v", 200)},
+			1 + 2 + 1 + 1 + 1 + 1 + 2 + 200,
+		},
+	}
+	for name, tc := range testCases {
+		if size := ParametersSize(tc.params); size != tc.expectedSize {
+			t.Errorf("%s: expected size %d, got %d", name, tc.expectedSize, size)
+		}
+	}
+}
+
+func TestValidateParametersSize(t *testing.T) {
+	params := map[string]string{"type": "gp2", "zone": "us-east-1a"}
+	size := ParametersSize(params)
+
+	if errs := ValidateParametersSize(params, size); len(errs) != 0 {
+		t.Errorf("expected success at the limit: %v", errs)
+	}
+	errs := ValidateParametersSize(params, size-1)
+	if len(errs) != 1 {
+		t.Fatalf("expected exactly one error over the limit, got %v", errs)
+	}
+	if errs[0].Field != "parameters" {
+		t.Errorf("expected error at parameters, got %s", errs[0].Field)
+	}
+	if expected := fmt.Sprintf("must take at most %d bytes when serialized", size-1); errs[0].Detail != expected {
+		t.Errorf("expected detail %q, got %q", expected, errs[0].Detail)
+	}
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package validation
+
+import (
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"github.com/sourcegraph/monorepo-test-1/kubernetes-10/pkg/api"
+)
+
+// ProvisionerReclaimPolicies maps provisioner names to the reclaim policies
+// that the volumes they provision support, e.g. to keep StorageClasses of
+// provisioners that can not delete volumes from using the Delete policy.
+// Provisioners without an entry support all reclaim policies.
+type ProvisionerReclaimPolicies map[string][]api.PersistentVolumeReclaimPolicy
+
+// ValidateProvisionerReclaimPolicy tests that reclaimPolicy is supported by
+// provisioner according to supported. An empty reclaimPolicy stands for
+// Delete, the reclaim policy of dynamically provisioned volumes by default.
+func ValidateProvisionerReclaimPolicy(provisioner string, reclaimPolicy api.PersistentVolumeReclaimPolicy, supported ProvisionerReclaimPolicies) field.ErrorList {
+	allErrs := field.ErrorList{}
+	policies, restricted := supported[provisioner]
+	if !restricted {
+		return allErrs
+	}
+	if reclaimPolicy == "" {
+		reclaimPolicy = api.PersistentVolumeReclaimDelete
+	}
+	names := make([]string, 0, len(policies))
+	for _, policy := range policies {
+		if policy == reclaimPolicy {
+			return allErrs
+		}
+		names = append(names, string(policy))
+	}
+	return append(allErrs, field.NotSupported(field.NewPath("reclaimPolicy"), reclaimPolicy, names))
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package validation
+
+import (
+	"testing"
+
+	"github.com/sourcegraph/monorepo-test-1/kubernetes-10/pkg/api"
+)
+
+func TestValidateProvisionerReclaimPolicy(t *testing.T) {
+	supported := ProvisionerReclaimPolicies{
+		"kubernetes.io/no-provisioner": {api.PersistentVolumeReclaimRetain},
+		"example.com/nfs":              {api.PersistentVolumeReclaimRetain, api.PersistentVolumeReclaimRecycle},
+	}
+
+	testCases := map[string]struct {
+		provisioner   string
+		reclaimPolicy api.PersistentVolumeReclaimPolicy
+		expectError   bool
+	}{
+		"supported policy": {
+			provisioner:   "kubernetes.io/no-provisioner",
+			reclaimPolicy: api.PersistentVolumeReclaimRetain,
+		},
+		"one of several supported policies": {
+			provisioner:   "example.com/nfs",
+			reclaimPolicy: api.PersistentVolumeReclaimRecycle,
+		},
+		"unrestricted provisioner": {
+			provisioner:   "kubernetes.io/gce-pd",
+			reclaimPolicy: api.PersistentVolumeReclaimDelete,
+		},
+		"unsupported policy": {
+			provisioner:   "kubernetes.io/no-provisioner",
+			reclaimPolicy: api.PersistentVolumeReclaimDelete,
+			expectError:   true,
+		},
+		"default policy unsupported": {
+			provisioner: "example.com/nfs",
+			expectError: true,
+		},
+	}
+	for name, tc := range testCases {
+		errs := ValidateProvisionerReclaimPolicy(tc.provisioner, tc.reclaimPolicy, supported)
+		if !tc.expectError {
+			if len(errs) != 0 {
+				t.Errorf("%s: expected success, got %v", name, errs)
+			}
+			continue
+		}
+		if len(errs) != 1 {
+			t.Errorf("%s: expected exactly one error, got %v", name, errs)
+			continue
+		}
+		if errs[0].Field != "reclaimPolicy" {
+			t.Errorf("%s: expected error at reclaimPolicy, got %v", name, errs[0])
+		}
+	}
+
+	if errs := ValidateProvisionerReclaimPolicy("kubernetes.io/no-provisioner", api.PersistentVolumeReclaimDelete, nil); len(errs) != 0 {
+		t.Errorf("expected success without a mapping, got %v", errs)
+	}
+}
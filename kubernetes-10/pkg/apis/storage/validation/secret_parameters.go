@@ -0,0 +1,62 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package validation
+
+import (
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	apivalidation "github.com/sourcegraph/monorepo-test-1/kubernetes-10/pkg/api/validation"
+)
+
+// secretParameterPrefixes are the prefixes of the StorageClass parameters that
+// reference a secret. Each is completed with "-name" and "-namespace" to form
+// the keys of the name and namespace of the secret.
+var secretParameterPrefixes = []string{
+	"csi.storage.k8s.io/provisioner-secret",
+	"csi.storage.k8s.io/controller-publish-secret",
+	"csi.storage.k8s.io/node-stage-secret",
+	"csi.storage.k8s.io/node-publish-secret",
+}
+
+// ValidateSecretParameters tests that the secret references in the parameters
+// of a StorageClass come in name/namespace pairs and that the referenced
+// names and namespaces are valid.
+func ValidateSecretParameters(params map[string]string) field.ErrorList {
+	allErrs := field.ErrorList{}
+	fldPath := field.NewPath("parameters")
+	for _, prefix := range secretParameterPrefixes {
+		nameKey, namespaceKey := prefix+"-name", prefix+"-namespace"
+		name, hasName := params[nameKey]
+		namespace, hasNamespace := params[namespaceKey]
+		switch {
+		case hasName && !hasNamespace:
+			allErrs = append(allErrs, field.Required(fldPath.Key(namespaceKey), "must be set when "+nameKey+" is set"))
+		case !hasName && hasNamespace:
+			allErrs = append(allErrs, field.Required(fldPath.Key(nameKey), "must be set when "+namespaceKey+" is set"))
+		}
+		if hasName {
+			for _, msg := range apivalidation.ValidateSecretName(name, false) {
+				allErrs = append(allErrs, field.Invalid(fldPath.Key(nameKey), name, msg))
+			}
+		}
+		if hasNamespace {
+			for _, msg := range apivalidation.ValidateNamespaceName(namespace, false) {
+				allErrs = append(allErrs, field.Invalid(fldPath.Key(namespaceKey), namespace, msg))
+			}
+		}
+	}
+	return allErrs
+}
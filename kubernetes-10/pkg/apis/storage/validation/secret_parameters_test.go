@@ -0,0 +1,68 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package validation
+
+import (
+	"testing"
+)
+
+func TestValidateSecretParameters(t *testing.T) {
+	successCases := []map[string]string{
+		nil,
+		{"type": "pd-ssd"},
+		{
+			"csi.storage.k8s.io/provisioner-secret-name":      "provisioner-secret",
+			"csi.storage.k8s.io/provisioner-secret-namespace": "kube-system",
+		},
+	}
+	for _, params := range successCases {
+		if errs := ValidateSecretParameters(params); len(errs) != 0 {
+			t.Errorf("expected success for %v: %v", params, errs)
+		}
+	}
+
+	errorCases := map[string]struct {
+		params        map[string]string
+		expectedField string
+	}{
+		"name without namespace": {
+			params:        map[string]string{"csi.storage.k8s.io/provisioner-secret-name": "provisioner-secret"},
+			expectedField: "parameters[csi.storage.k8s.io/provisioner-secret-namespace]",
+		},
+		"namespace without name": {
+			params:        map[string]string{"csi.storage.k8s.io/node-publish-secret-namespace": "kube-system"},
+			expectedField: "parameters[csi.storage.k8s.io/node-publish-secret-name]",
+		},
+		"invalid name": {
+			params: map[string]string{
+				"csi.storage.k8s.io/provisioner-secret-name":      "Not_A_Name",
+				"csi.storage.k8s.io/provisioner-secret-namespace": "kube-system",
+			},
+			expectedField: "parameters[csi.storage.k8s.io/provisioner-secret-name]",
+		},
+	}
+	for name, tc := range errorCases {
+		errs := ValidateSecretParameters(tc.params)
+		if len(errs) != 1 {
+			t.Errorf("%s: expected exactly one error, got %v", name, errs)
+			continue
+		}
+		if errs[0].Field != tc.expectedField {
+			t.Errorf("%s: expected error at %s, got %v", name, tc.expectedField, errs[0])
+		}
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"reflect"
 
+	"github.com/golang/glog"
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -33,14 +34,40 @@ import (
 	"github.com/sourcegraph/monorepo-test-1/kubernetes-11/pkg/apis/policy/validation"
 )
 
+// EmptySelectorPolicy decides what happens to a new PodDisruptionBudget with
+// a nil or empty selector. Such a budget covers all pods of its namespace,
+// which is rarely intended and may block all evictions.
+type EmptySelectorPolicy string
+
+const (
+	// EmptySelectorAllow accepts budgets with an empty selector.
+	EmptySelectorAllow EmptySelectorPolicy = "Allow"
+	// EmptySelectorWarn accepts budgets with an empty selector and logs a
+	// warning.
+	EmptySelectorWarn EmptySelectorPolicy = "Warn"
+	// EmptySelectorReject fails the validation of budgets with an empty
+	// selector.
+	EmptySelectorReject EmptySelectorPolicy = "Reject"
+)
+
 // podDisruptionBudgetStrategy implements verification logic for PodDisruptionBudgets.
 type podDisruptionBudgetStrategy struct {
 	runtime.ObjectTyper
 	names.NameGenerator
+
+	emptySelectorPolicy EmptySelectorPolicy
 }
 
 // Strategy is the default logic that applies when creating and updating PodDisruptionBudget objects.
-var Strategy = podDisruptionBudgetStrategy{api.Scheme, names.SimpleNameGenerator}
+var Strategy = podDisruptionBudgetStrategy{ObjectTyper: api.Scheme, NameGenerator: names.SimpleNameGenerator, emptySelectorPolicy: EmptySelectorAllow}
+
+// NewStrategyWithEmptySelectorPolicy returns a Strategy that applies policy to
+// PodDisruptionBudgets created with an empty selector.
+func NewStrategyWithEmptySelectorPolicy(policy EmptySelectorPolicy) podDisruptionBudgetStrategy {
+	strategy := Strategy
+	strategy.emptySelectorPolicy = policy
+	return strategy
+}
 
 // NamespaceScoped returns true because all PodDisruptionBudget' need to be within a namespace.
 func (podDisruptionBudgetStrategy) NamespaceScoped() bool {
@@ -72,9 +99,28 @@ func (podDisruptionBudgetStrategy) PrepareForUpdate(ctx genericapirequest.Contex
 }
 
 // Validate validates a new PodDisruptionBudget.
-func (podDisruptionBudgetStrategy) Validate(ctx genericapirequest.Context, obj runtime.Object) field.ErrorList {
+func (s podDisruptionBudgetStrategy) Validate(ctx genericapirequest.Context, obj runtime.Object) field.ErrorList {
 	podDisruptionBudget := obj.(*policy.PodDisruptionBudget)
-	return validation.ValidatePodDisruptionBudget(podDisruptionBudget)
+	allErrs := validation.ValidatePodDisruptionBudget(podDisruptionBudget)
+	return append(allErrs, s.validateSelectorNotEmpty(podDisruptionBudget)...)
+}
+
+// validateSelectorNotEmpty applies the empty selector policy to a new
+// PodDisruptionBudget. The selector of existing budgets can't be updated, so
+// they are left alone.
+func (s podDisruptionBudgetStrategy) validateSelectorNotEmpty(podDisruptionBudget *policy.PodDisruptionBudget) field.ErrorList {
+	selector := podDisruptionBudget.Spec.Selector
+	if selector != nil && (len(selector.MatchLabels) > 0 || len(selector.MatchExpressions) > 0) {
+		return nil
+	}
+	const message = "an empty selector matches all pods in the namespace"
+	switch s.emptySelectorPolicy {
+	case EmptySelectorWarn:
+		glog.Warningf("PodDisruptionBudget %s/%s: %s", podDisruptionBudget.Namespace, podDisruptionBudget.Name, message)
+	case EmptySelectorReject:
+		return field.ErrorList{field.Invalid(field.NewPath("spec", "selector"), selector, message)}
+	}
+	return nil
 }
 
 // Canonicalize normalizes the object after validation.
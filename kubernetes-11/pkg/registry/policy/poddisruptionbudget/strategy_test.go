@@ -132,3 +132,42 @@ func TestPodDisruptionBudgetStatusStrategy(t *testing.T) {
 		t.Errorf("Unexpected error %v", errs)
 	}
 }
+
+func TestPodDisruptionBudgetStrategyEmptySelector(t *testing.T) {
+	ctx := genericapirequest.NewDefaultContext()
+	selectors := map[string]*metav1.LabelSelector{
+		"nil selector":       nil,
+		"empty selector":     {},
+		"populated selector": {MatchLabels: map[string]string{"a": "b"}},
+	}
+	testCases := []struct {
+		policy         EmptySelectorPolicy
+		expectRejected map[string]bool
+	}{
+		{policy: EmptySelectorAllow},
+		{policy: EmptySelectorWarn},
+		{policy: EmptySelectorReject, expectRejected: map[string]bool{"nil selector": true, "empty selector": true}},
+	}
+
+	for _, tc := range testCases {
+		strategy := NewStrategyWithEmptySelectorPolicy(tc.policy)
+		for name, selector := range selectors {
+			pdb := &policy.PodDisruptionBudget{
+				ObjectMeta: metav1.ObjectMeta{Name: "abc", Namespace: metav1.NamespaceDefault},
+				Spec: policy.PodDisruptionBudgetSpec{
+					MinAvailable: intstr.FromInt(3),
+					Selector:     selector,
+				},
+			}
+			strategy.PrepareForCreate(ctx, pdb)
+			errs := strategy.Validate(ctx, pdb)
+			if tc.expectRejected[name] {
+				if len(errs) != 1 || errs[0].Field != "spec.selector" {
+					t.Errorf("%s policy, %s: expected an error at spec.selector, got %v", tc.policy, name, errs)
+				}
+			} else if len(errs) != 0 {
+				t.Errorf("%s policy, %s: unexpected errors: %v", tc.policy, name, errs)
+			}
+		}
+	}
+}
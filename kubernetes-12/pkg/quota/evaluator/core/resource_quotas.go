@@ -17,8 +17,13 @@ limitations under the License.
 package core
 
 import (
+	"sort"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apiserver/pkg/admission"
 	"github.com/sourcegraph/monorepo-test-1/kubernetes-12/pkg/api"
 	"github.com/sourcegraph/monorepo-test-1/kubernetes-12/pkg/client/clientset_generated/clientset"
 	"github.com/sourcegraph/monorepo-test-1/kubernetes-12/pkg/quota"
@@ -27,11 +32,8 @@ import (
 
 // NewResourceQuotaEvaluator returns an evaluator that can evaluate resource quotas
 func NewResourceQuotaEvaluator(kubeClient clientset.Interface) quota.Evaluator {
-	return &generic.ObjectCountEvaluator{
-		AllowCreateOnUpdate: false,
-		InternalGroupKind:   api.Kind("ResourceQuota"),
-		ResourceName:        api.ResourceQuotas,
-		ListFuncByNamespace: func(namespace string, options metav1.ListOptions) ([]runtime.Object, error) {
+	evaluator := NewObjectCountEvaluator(api.Kind("ResourceQuota"), api.ResourceQuotas,
+		func(namespace string, options metav1.ListOptions) ([]runtime.Object, error) {
 			itemList, err := kubeClient.Core().ResourceQuotas(namespace).List(options)
 			if err != nil {
 				return nil, err
@@ -41,6 +43,79 @@ func NewResourceQuotaEvaluator(kubeClient clientset.Interface) quota.Evaluator {
 				results = append(results, &itemList.Items[i])
 			}
 			return results, nil
-		},
+		})
+	return &resourceQuotaEvaluator{Evaluator: evaluator}
+}
+
+// resourceQuotaEvaluator counts resource quotas, handling admission operations
+// explicitly rather than the way object counts do by default.
+type resourceQuotaEvaluator struct {
+	quota.Evaluator
+}
+
+// Handles returns true if the evaluator should handle the specified operation.
+func (r *resourceQuotaEvaluator) Handles(operation admission.Operation) bool {
+	// Only creating a quota increments the number of quotas, updating one does
+	// not change it. Deletes are not charged at admission, the quota controller
+	// recalculates the usage.
+	return admission.Create == operation
+}
+
+// NewObjectCountEvaluator returns an evaluator that counts the objects of the
+// given group kind against resourceName, listing them with listFunc.
+func NewObjectCountEvaluator(groupKind schema.GroupKind, resourceName api.ResourceName, listFunc generic.ListFuncByNamespace) quota.Evaluator {
+	return &generic.ObjectCountEvaluator{
+		AllowCreateOnUpdate: false,
+		InternalGroupKind:   groupKind,
+		ResourceName:        resourceName,
+		ListFuncByNamespace: listFunc,
+	}
+}
+
+// conflictingScopes are the pairs of scopes no object can match both of, so
+// that a quota with both of them would never apply to anything.
+var conflictingScopes = [][2]api.ResourceQuotaScope{
+	{api.ResourceQuotaScopeTerminating, api.ResourceQuotaScopeNotTerminating},
+	{api.ResourceQuotaScopeBestEffort, api.ResourceQuotaScopeNotBestEffort},
+}
+
+// ValidateScopeConsistency returns an error for every scope of the resource
+// quota that contradicts an earlier one, e.g. NotTerminating after
+// Terminating. The API itself accepts such quotas although they match no
+// object.
+func ValidateScopeConsistency(rq *api.ResourceQuota) field.ErrorList {
+	allErrs := field.ErrorList{}
+	fldPath := field.NewPath("spec").Child("scopes")
+	seen := map[api.ResourceQuotaScope]bool{}
+	for i, scope := range rq.Spec.Scopes {
+		for _, pair := range conflictingScopes {
+			for j, conflicting := range pair {
+				if scope == pair[1-j] && seen[conflicting] {
+					allErrs = append(allErrs, field.Invalid(fldPath.Index(i), scope, "conflicts with scope "+string(conflicting)))
+				}
+			}
+		}
+		seen[scope] = true
+	}
+	return allErrs
+}
+
+// ValidateResourceQuotaHardLimits returns an error for every resource whose
+// hard limit in the resource quota is negative. No usage can stay within
+// such a limit, and the evaluators do not expect one when they compare usage
+// against it.
+func ValidateResourceQuotaHardLimits(rq *api.ResourceQuota) field.ErrorList {
+	allErrs := field.ErrorList{}
+	fldPath := field.NewPath("spec").Child("hard")
+	resourceNames := make([]string, 0, len(rq.Spec.Hard))
+	for resourceName := range rq.Spec.Hard {
+		resourceNames = append(resourceNames, string(resourceName))
+	}
+	sort.Strings(resourceNames)
+	for _, resourceName := range resourceNames {
+		if limit := rq.Spec.Hard[api.ResourceName(resourceName)]; limit.Sign() < 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Key(resourceName), limit.String(), "must be greater than or equal to 0"))
+		}
 	}
+	return allErrs
 }
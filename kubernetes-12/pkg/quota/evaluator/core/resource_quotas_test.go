@@ -0,0 +1,174 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/admission"
+	"github.com/sourcegraph/monorepo-test-1/kubernetes-12/pkg/api"
+	"github.com/sourcegraph/monorepo-test-1/kubernetes-12/pkg/client/clientset_generated/clientset/fake"
+	"github.com/sourcegraph/monorepo-test-1/kubernetes-12/pkg/quota"
+)
+
+func TestObjectCountEvaluator(t *testing.T) {
+	groupKind := schema.GroupKind{Group: "example.com", Kind: "Widget"}
+	resourceName := api.ResourceName("widgets.example.com")
+	var listedNamespace string
+	listFunc := func(namespace string, options metav1.ListOptions) ([]runtime.Object, error) {
+		listedNamespace = namespace
+		return []runtime.Object{&api.ConfigMap{}, &api.ConfigMap{}}, nil
+	}
+	evaluator := NewObjectCountEvaluator(groupKind, resourceName, listFunc)
+
+	if evaluator.GroupKind() != groupKind {
+		t.Errorf("expected group kind %v, actual: %v", groupKind, evaluator.GroupKind())
+	}
+	input := []api.ResourceName{api.ResourceConfigMaps, api.ResourceCPU, resourceName}
+	expected := quota.ToSet([]api.ResourceName{resourceName})
+	actual := quota.ToSet(evaluator.MatchingResources(input))
+	if !expected.Equal(actual) {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+
+	stats, err := evaluator.UsageStats(quota.UsageStatsOptions{Namespace: "test"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if listedNamespace != "test" {
+		t.Errorf("expected namespace %q to be listed, actual: %q", "test", listedNamespace)
+	}
+	expectedUsage := api.ResourceList{resourceName: resource.MustParse("2")}
+	if !quota.Equals(expectedUsage, stats.Used) {
+		t.Errorf("expected: %v, actual: %v", expectedUsage, stats.Used)
+	}
+}
+
+func TestResourceQuotaEvaluatorHandles(t *testing.T) {
+	evaluator := NewResourceQuotaEvaluator(fake.NewSimpleClientset())
+	testCases := map[admission.Operation]bool{
+		admission.Create:  true,
+		admission.Update:  false,
+		admission.Delete:  false,
+		admission.Connect: false,
+	}
+	for operation, expected := range testCases {
+		if actual := evaluator.Handles(operation); actual != expected {
+			t.Errorf("%s: expected Handles to return %v, actual: %v", operation, expected, actual)
+		}
+	}
+}
+
+func TestValidateScopeConsistency(t *testing.T) {
+	testCases := map[string]struct {
+		scopes         []api.ResourceQuotaScope
+		expectedFields []string
+	}{
+		"no scopes": {},
+		"consistent scopes": {
+			scopes: []api.ResourceQuotaScope{api.ResourceQuotaScopeTerminating, api.ResourceQuotaScopeBestEffort},
+		},
+		"repeated scope": {
+			scopes: []api.ResourceQuotaScope{api.ResourceQuotaScopeNotBestEffort, api.ResourceQuotaScopeNotBestEffort},
+		},
+		"terminating and not terminating": {
+			scopes:         []api.ResourceQuotaScope{api.ResourceQuotaScopeTerminating, api.ResourceQuotaScopeNotTerminating},
+			expectedFields: []string{"spec.scopes[1]"},
+		},
+		"best effort and not best effort": {
+			scopes:         []api.ResourceQuotaScope{api.ResourceQuotaScopeNotBestEffort, api.ResourceQuotaScopeTerminating, api.ResourceQuotaScopeBestEffort},
+			expectedFields: []string{"spec.scopes[2]"},
+		},
+		"both pairs": {
+			scopes: []api.ResourceQuotaScope{
+				api.ResourceQuotaScopeBestEffort,
+				api.ResourceQuotaScopeNotTerminating,
+				api.ResourceQuotaScopeNotBestEffort,
+				api.ResourceQuotaScopeTerminating,
+			},
+			expectedFields: []string{"spec.scopes[2]", "spec.scopes[3]"},
+		},
+	}
+
+	for name, tc := range testCases {
+		rq := &api.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: "quota", Namespace: "test"},
+			Spec:       api.ResourceQuotaSpec{Scopes: tc.scopes},
+		}
+		errs := ValidateScopeConsistency(rq)
+		if len(errs) != len(tc.expectedFields) {
+			t.Errorf("%s: expected %d errors, got %v", name, len(tc.expectedFields), errs)
+			continue
+		}
+		for i, expected := range tc.expectedFields {
+			if errs[i].Field != expected {
+				t.Errorf("%s: expected error at %s, got %s", name, expected, errs[i].Field)
+			}
+		}
+	}
+}
+
+func TestValidateResourceQuotaHardLimits(t *testing.T) {
+	testCases := map[string]struct {
+		hard           api.ResourceList
+		expectedFields []string
+	}{
+		"no limits": {},
+		"valid limits": {
+			hard: api.ResourceList{
+				api.ResourceCPU:    resource.MustParse("2"),
+				api.ResourcePods:   resource.MustParse("0"),
+				api.ResourceMemory: resource.MustParse("1Gi"),
+			},
+		},
+		"negative limit": {
+			hard: api.ResourceList{
+				api.ResourceCPU:  resource.MustParse("2"),
+				api.ResourcePods: resource.MustParse("-1"),
+			},
+			expectedFields: []string{"spec.hard[pods]"},
+		},
+		"several negative limits": {
+			hard: api.ResourceList{
+				api.ResourceServices: resource.MustParse("-5"),
+				api.ResourceMemory:   resource.MustParse("-1Gi"),
+			},
+			expectedFields: []string{"spec.hard[memory]", "spec.hard[services]"},
+		},
+	}
+
+	for name, tc := range testCases {
+		rq := &api.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: "quota", Namespace: "test"},
+			Spec:       api.ResourceQuotaSpec{Hard: tc.hard},
+		}
+		errs := ValidateResourceQuotaHardLimits(rq)
+		if len(errs) != len(tc.expectedFields) {
+			t.Errorf("%s: expected %d errors, got %v", name, len(tc.expectedFields), errs)
+			continue
+		}
+		for i, expected := range tc.expectedFields {
+			if errs[i].Field != expected {
+				t.Errorf("%s: expected error at %s, got %s", name, expected, errs[i].Field)
+			}
+		}
+	}
+}
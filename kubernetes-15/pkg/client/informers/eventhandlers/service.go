@@ -0,0 +1,56 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package eventhandlers registers typed event handlers with the generated
+// informers.
+package eventhandlers
+
+import (
+	"k8s.io/client-go/tools/cache"
+	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/api"
+	coreinformers "github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/client/informers/informers_generated/internalversion/core/internalversion"
+)
+
+// OnServiceChanges registers onAdd, onUpdate and onDelete, any of which may be
+// nil, as event handlers of informer. Objects that are not Services are
+// skipped, and deleted Services whose final state is unknown are unwrapped
+// from their tombstone. onUpdate is called with the new Service.
+func OnServiceChanges(informer coreinformers.ServiceInformer, onAdd, onUpdate, onDelete func(*api.Service)) {
+	informer.Informer().AddEventHandler(serviceEventHandler(onAdd, onUpdate, onDelete))
+}
+
+func serviceEventHandler(onAdd, onUpdate, onDelete func(*api.Service)) cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if service, ok := obj.(*api.Service); ok && onAdd != nil {
+				onAdd(service)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if service, ok := newObj.(*api.Service); ok && onUpdate != nil {
+				onUpdate(service)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if service, ok := obj.(*api.Service); ok && onDelete != nil {
+				onDelete(service)
+			}
+		},
+	}
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package eventhandlers
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/api"
+	coreinformers "github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/client/informers/informers_generated/internalversion/core/internalversion"
+	corelisters "github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/client/listers/core/internalversion"
+)
+
+func TestOnServiceChanges(t *testing.T) {
+	informer := &fakeSharedIndexInformer{}
+
+	var events []string
+	record := func(event string) func(*api.Service) {
+		return func(service *api.Service) {
+			events = append(events, event+" "+service.Name)
+		}
+	}
+	OnServiceChanges(&fakeServiceInformer{informer: informer}, record("add"), record("update"), record("delete"))
+	if len(informer.handlers) != 1 {
+		t.Fatalf("expected 1 registered handler, got %d", len(informer.handlers))
+	}
+	handler := informer.handlers[0]
+
+	oldService := &api.Service{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: metav1.NamespaceDefault, ResourceVersion: "1"}}
+	newService := &api.Service{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: metav1.NamespaceDefault, ResourceVersion: "2"}}
+	handler.OnAdd(oldService)
+	handler.OnUpdate(oldService, newService)
+	handler.OnDelete(newService)
+	handler.OnDelete(cache.DeletedFinalStateUnknown{Key: "default/bar", Obj: &api.Service{ObjectMeta: metav1.ObjectMeta{Name: "bar"}}})
+
+	// Objects of other types must be skipped instead of panicking.
+	handler.OnAdd(&api.Endpoints{})
+	handler.OnUpdate(&api.Endpoints{}, &api.Endpoints{})
+	handler.OnDelete(&api.Endpoints{})
+	handler.OnDelete(cache.DeletedFinalStateUnknown{Key: "default/baz", Obj: &api.Endpoints{}})
+
+	expected := []string{"add foo", "update foo", "delete foo", "delete bar"}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected events %v, got %v", expected, events)
+	}
+}
+
+func TestOnServiceChangesWithNilHandlers(t *testing.T) {
+	informer := &fakeSharedIndexInformer{}
+
+	var deleted []string
+	OnServiceChanges(&fakeServiceInformer{informer: informer}, nil, nil, func(service *api.Service) {
+		deleted = append(deleted, service.Name)
+	})
+	handler := informer.handlers[0]
+
+	service := &api.Service{ObjectMeta: metav1.ObjectMeta{Name: "foo"}}
+	handler.OnAdd(service)
+	handler.OnUpdate(service, service)
+	handler.OnDelete(service)
+	if !reflect.DeepEqual(deleted, []string{"foo"}) {
+		t.Errorf("expected only the delete handler to be called, got %v", deleted)
+	}
+}
+
+// fakeServiceInformer returns informer.
+type fakeServiceInformer struct {
+	informer cache.SharedIndexInformer
+}
+
+var _ coreinformers.ServiceInformer = &fakeServiceInformer{}
+
+func (f *fakeServiceInformer) Informer() cache.SharedIndexInformer {
+	return f.informer
+}
+
+func (f *fakeServiceInformer) Lister() corelisters.ServiceLister {
+	return corelisters.NewServiceLister(f.informer.GetIndexer())
+}
+
+// fakeSharedIndexInformer records the registered event handlers.
+type fakeSharedIndexInformer struct {
+	cache.SharedIndexInformer
+	handlers []cache.ResourceEventHandler
+}
+
+func (i *fakeSharedIndexInformer) AddEventHandler(handler cache.ResourceEventHandler) {
+	i.handlers = append(i.handlers, handler)
+}
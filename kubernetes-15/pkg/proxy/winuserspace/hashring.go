@@ -0,0 +1,83 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package winuserspace
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+// hashRing is a consistent hash ring of endpoints. Each endpoint is placed on
+// the ring virtualNodes times, and a key belongs to the endpoint following its
+// hash on the ring. Adding or removing one of N endpoints thus only moves
+// about 1/N of the keys to other endpoints.
+type hashRing struct {
+	hashes []uint32          // sorted hashes of the virtual nodes
+	owners map[uint32]string // hash of a virtual node -> its endpoint
+}
+
+// newHashRing returns a ring of the given endpoints with virtualNodes virtual
+// nodes per endpoint.
+func newHashRing(endpoints []string, virtualNodes int) *hashRing {
+	ring := &hashRing{
+		hashes: make([]uint32, 0, len(endpoints)*virtualNodes),
+		owners: make(map[uint32]string, len(endpoints)*virtualNodes),
+	}
+	for _, endpoint := range endpoints {
+		for i := 0; i < virtualNodes; i++ {
+			hash := hashKey(endpoint + "#" + strconv.Itoa(i))
+			if _, exists := ring.owners[hash]; exists {
+				// Colliding virtual nodes belong to the smallest endpoint,
+				// so the ring does not depend on the order of the endpoints.
+				if ring.owners[hash] > endpoint {
+					ring.owners[hash] = endpoint
+				}
+				continue
+			}
+			ring.owners[hash] = endpoint
+			ring.hashes = append(ring.hashes, hash)
+		}
+	}
+	sort.Sort(uint32Slice(ring.hashes))
+	return ring
+}
+
+// get returns the endpoint key belongs to, or "" if the ring is empty.
+func (ring *hashRing) get(key string) string {
+	if len(ring.hashes) == 0 {
+		return ""
+	}
+	hash := hashKey(key)
+	i := sort.Search(len(ring.hashes), func(i int) bool { return ring.hashes[i] >= hash })
+	if i == len(ring.hashes) {
+		i = 0
+	}
+	return ring.owners[ring.hashes[i]]
+}
+
+func hashKey(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
+}
+
+type uint32Slice []uint32
+
+func (s uint32Slice) Len() int           { return len(s) }
+func (s uint32Slice) Less(i, j int) bool { return s[i] < s[j] }
+func (s uint32Slice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,70 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package winuserspace
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestHashRingRemovingEndpointRemapsFewKeys(t *testing.T) {
+	numEndpoints := 10
+	numKeys := 10000
+	endpoints := make([]string, numEndpoints)
+	for i := range endpoints {
+		endpoints[i] = fmt.Sprintf("10.0.0.%d:80", i+1)
+	}
+	ring := newHashRing(endpoints, 100)
+
+	removed := endpoints[4]
+	remaining := append(append([]string{}, endpoints[:4]...), endpoints[5:]...)
+	updatedRing := newHashRing(remaining, 100)
+
+	remapped := 0
+	for i := 0; i < numKeys; i++ {
+		key := fmt.Sprintf("192.168.%d.%d", i/256, i%256)
+		before, after := ring.get(key), updatedRing.get(key)
+		if before == after {
+			continue
+		}
+		if before != removed {
+			t.Errorf("Expected only keys of %s to be remapped, %s moved from %s to %s", removed, key, before, after)
+		}
+		remapped++
+	}
+	// About 1/N of the keys belonged to the removed endpoint.
+	if remapped == 0 || remapped > 2*numKeys/numEndpoints {
+		t.Errorf("Expected about %d of %d keys to be remapped, got %d", numKeys/numEndpoints, numKeys, remapped)
+	}
+}
+
+func TestHashRingDoesNotDependOnEndpointOrder(t *testing.T) {
+	ring := newHashRing([]string{"10.0.0.1:80", "10.0.0.2:80", "10.0.0.3:80"}, 50)
+	reversedRing := newHashRing([]string{"10.0.0.3:80", "10.0.0.2:80", "10.0.0.1:80"}, 50)
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("192.168.0.%d", i)
+		if ring.get(key) != reversedRing.get(key) {
+			t.Errorf("Expected %s to be assigned to the same endpoint regardless of the endpoint order, got %s and %s", key, ring.get(key), reversedRing.get(key))
+		}
+	}
+}
+
+func TestHashRingEmpty(t *testing.T) {
+	if endpoint := newHashRing(nil, 100).get("192.168.0.1"); endpoint != "" {
+		t.Errorf("Expected no endpoint from an empty ring, got %q", endpoint)
+	}
+}
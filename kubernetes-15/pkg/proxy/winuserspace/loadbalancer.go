@@ -18,6 +18,7 @@ package winuserspace
 
 import (
 	"net"
+	"time"
 
 	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/api"
 	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/proxy"
@@ -31,4 +32,15 @@ type LoadBalancer interface {
 	NewService(service proxy.ServicePortName, sessionAffinityType api.ServiceAffinity, stickyMaxAgeMinutes int) error
 	DeleteService(service proxy.ServicePortName)
 	CleanupStaleStickySessions(service proxy.ServicePortName)
+	// ReplaceEndpoints atomically replaces all endpoints of the service-port.
+	ReplaceEndpoints(service proxy.ServicePortName, endpoints []string)
+}
+
+// LatencyRecorder is implemented by load balancers that take the latencies of
+// the endpoints into account.
+type LatencyRecorder interface {
+	// RecordEndpointLatency records the time endpoint of the given
+	// service-port took to respond, from the first byte sent to it until the
+	// first byte received from it.
+	RecordEndpointLatency(service proxy.ServicePortName, endpoint string, d time.Duration)
 }
@@ -373,7 +373,9 @@ func (proxier *Proxier) OnServiceUpdate(services []*api.Service) {
 					},
 					Port: servicePort.Name,
 				}
-				proxier.loadBalancer.NewService(servicePortName, service.Spec.SessionAffinity, stickyMaxAgeMinutes)
+				if err := proxier.loadBalancer.NewService(servicePortName, service.Spec.SessionAffinity, stickyMaxAgeMinutes); err != nil {
+					glog.Errorf("Failed to register load balancer for service %q: %v", servicePortName, err)
+				}
 			}
 		}
 	}
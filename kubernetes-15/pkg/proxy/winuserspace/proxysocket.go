@@ -119,7 +119,7 @@ func (tcp *tcpProxySocket) ListenPort() int {
 	return tcp.port
 }
 
-func tryConnect(service ServicePortPortalName, srcAddr net.Addr, protocol string, proxier *Proxier) (out net.Conn, err error) {
+func tryConnect(service ServicePortPortalName, srcAddr net.Addr, protocol string, proxier *Proxier) (out net.Conn, endpoint string, err error) {
 	sessionAffinityReset := false
 	for _, dialTimeout := range endpointDialTimeout {
 		servicePortName := proxy.ServicePortName{
@@ -132,7 +132,7 @@ func tryConnect(service ServicePortPortalName, srcAddr net.Addr, protocol string
 		endpoint, err := proxier.loadBalancer.NextEndpoint(servicePortName, srcAddr, sessionAffinityReset)
 		if err != nil {
 			glog.Errorf("Couldn't find an endpoint for %s: %v", service, err)
-			return nil, err
+			return nil, "", err
 		}
 		glog.V(3).Infof("Mapped service %q to endpoint %s", service, endpoint)
 		// TODO: This could spin up a new goroutine to make the outbound connection,
@@ -146,9 +146,29 @@ func tryConnect(service ServicePortPortalName, srcAddr net.Addr, protocol string
 			sessionAffinityReset = true
 			continue
 		}
-		return outConn, nil
+		return outConn, endpoint, nil
+	}
+	return nil, "", fmt.Errorf("failed to connect to an endpoint.")
+}
+
+// responseTimeRecorder returns the function that records the response times
+// of endpoint of the service, or nil if the load balancer of proxier does not
+// take latencies into account.
+func responseTimeRecorder(service ServicePortPortalName, endpoint string, proxier *Proxier) func(time.Duration) {
+	recorder, ok := proxier.loadBalancer.(LatencyRecorder)
+	if !ok {
+		return nil
+	}
+	servicePortName := proxy.ServicePortName{
+		NamespacedName: types.NamespacedName{
+			Namespace: service.Namespace,
+			Name:      service.Name,
+		},
+		Port: service.Port,
+	}
+	return func(d time.Duration) {
+		recorder.RecordEndpointLatency(servicePortName, endpoint, d)
 	}
-	return nil, fmt.Errorf("failed to connect to an endpoint.")
 }
 
 func (tcp *tcpProxySocket) ProxyLoop(service ServicePortPortalName, myInfo *serviceInfo, proxier *Proxier) {
@@ -175,32 +195,45 @@ func (tcp *tcpProxySocket) ProxyLoop(service ServicePortPortalName, myInfo *serv
 			continue
 		}
 		glog.V(3).Infof("Accepted TCP connection from %v to %v", inConn.RemoteAddr(), inConn.LocalAddr())
-		outConn, err := tryConnect(service, inConn.(*net.TCPConn).RemoteAddr(), "tcp", proxier)
+		outConn, endpoint, err := tryConnect(service, inConn.(*net.TCPConn).RemoteAddr(), "tcp", proxier)
 		if err != nil {
 			glog.Errorf("Failed to connect to balancer: %v", err)
 			inConn.Close()
 			continue
 		}
 		// Spin up an async copy loop.
-		go proxyTCP(inConn.(*net.TCPConn), outConn.(*net.TCPConn))
+		go proxyTCP(inConn.(*net.TCPConn), outConn.(*net.TCPConn), responseTimeRecorder(service, endpoint, proxier))
 	}
 }
 
-// proxyTCP proxies data bi-directionally between in and out.
-func proxyTCP(in, out *net.TCPConn) {
+// proxyTCP proxies data bi-directionally between in and out. If
+// recordResponseTime is not nil, it is called with the time out took to
+// respond, see responseTimer.
+func proxyTCP(in, out *net.TCPConn, recordResponseTime func(time.Duration)) {
 	var wg sync.WaitGroup
 	wg.Add(2)
 	glog.V(4).Infof("Creating proxy between %v <-> %v <-> %v <-> %v",
 		in.RemoteAddr(), in.LocalAddr(), out.LocalAddr(), out.RemoteAddr())
-	go copyBytes("from backend", in, out, &wg)
-	go copyBytes("to backend", out, in, &wg)
+	var onRequest, onResponse func()
+	if recordResponseTime != nil {
+		timer := &responseTimer{record: recordResponseTime}
+		onRequest, onResponse = timer.requestSent, timer.responseReceived
+	}
+	go copyBytes("from backend", in, out, onResponse, &wg)
+	go copyBytes("to backend", out, in, onRequest, &wg)
 	wg.Wait()
 }
 
-func copyBytes(direction string, dest, src *net.TCPConn, wg *sync.WaitGroup) {
+// copyBytes copies from src to dest until either is closed. If onFirstRead is
+// not nil, it is called once when the first bytes are read from src.
+func copyBytes(direction string, dest, src *net.TCPConn, onFirstRead func(), wg *sync.WaitGroup) {
 	defer wg.Done()
 	glog.V(4).Infof("Copying %s: %s -> %s", direction, src.RemoteAddr(), dest.RemoteAddr())
-	n, err := io.Copy(dest, src)
+	var reader io.Reader = src
+	if onFirstRead != nil {
+		reader = &firstReadNotifier{Reader: src, onFirstRead: onFirstRead}
+	}
+	n, err := io.Copy(dest, reader)
 	if err != nil {
 		if !isClosedError(err) {
 			glog.Errorf("I/O error: %v", err)
@@ -211,6 +244,51 @@ func copyBytes(direction string, dest, src *net.TCPConn, wg *sync.WaitGroup) {
 	src.Close()
 }
 
+// firstReadNotifier calls onFirstRead once when the first bytes are read
+// from Reader.
+type firstReadNotifier struct {
+	io.Reader
+	once        sync.Once
+	onFirstRead func()
+}
+
+func (r *firstReadNotifier) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if n > 0 {
+		r.once.Do(r.onFirstRead)
+	}
+	return n, err
+}
+
+// responseTimer measures the time a backend takes to respond on a proxied
+// connection, from the first byte sent to it until the first byte received
+// from it, and passes it to record. Backends that send first, before they
+// receive anything, are not measured.
+type responseTimer struct {
+	lock   sync.Mutex
+	sentAt time.Time
+	record func(time.Duration)
+}
+
+// requestSent is called when the first bytes are sent to the backend.
+func (t *responseTimer) requestSent() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.sentAt = time.Now()
+}
+
+// responseReceived is called when the first bytes are received from the
+// backend.
+func (t *responseTimer) responseReceived() {
+	t.lock.Lock()
+	sentAt := t.sentAt
+	t.lock.Unlock()
+	if sentAt.IsZero() {
+		return
+	}
+	t.record(time.Since(sentAt))
+}
+
 // udpProxySocket implements proxySocket.  Close() is implemented by net.UDPConn.  When Close() is called,
 // no new connections are allowed and existing connections are broken.
 // TODO: We could lame-duck this ourselves, if it becomes important.
@@ -688,7 +766,7 @@ func (udp *udpProxySocket) getBackendConn(activeClients *clientCache, dnsClients
 		// and keep accepting inbound traffic.
 		glog.V(3).Infof("New UDP connection from %s", cliAddr)
 		var err error
-		svrConn, err = tryConnect(service, cliAddr, "udp", proxier)
+		svrConn, _, err = tryConnect(service, cliAddr, "udp", proxier)
 		if err != nil {
 			return nil, err
 		}
@@ -19,8 +19,29 @@ package winuserspace
 import (
 	"reflect"
 	"testing"
+	"time"
 )
 
+func TestResponseTimer(t *testing.T) {
+	var recorded []time.Duration
+	timer := &responseTimer{record: func(d time.Duration) {
+		recorded = append(recorded, d)
+	}}
+
+	// A backend that sends before it received anything is not measured.
+	timer.responseReceived()
+	if len(recorded) != 0 {
+		t.Errorf("Expected no response time for a backend that sent first, got %v", recorded)
+	}
+
+	timer.requestSent()
+	time.Sleep(10 * time.Millisecond)
+	timer.responseReceived()
+	if len(recorded) != 1 || recorded[0] < 10*time.Millisecond {
+		t.Errorf("Expected one response time of at least 10ms, got %v", recorded)
+	}
+}
+
 func TestPackUnpackDnsMsgUnqualifiedName(t *testing.T) {
 	msg := &dnsMsg{}
 	var buffer [4096]byte
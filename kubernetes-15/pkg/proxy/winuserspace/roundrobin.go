@@ -17,8 +17,10 @@ limitations under the License.
 package winuserspace
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"math"
 	"net"
 	"reflect"
 	"strconv"
@@ -26,7 +28,10 @@ import (
 	"time"
 
 	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/clock"
 	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/api"
 	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/proxy"
 	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/util/slice"
@@ -37,6 +42,17 @@ var (
 	ErrMissingEndpoints    = errors.New("missing endpoints")
 )
 
+const (
+	// defaultStickySessionCleanupInterval is how often Start removes expired
+	// sticky sessions.
+	defaultStickySessionCleanupInterval = time.Minute
+	// defaultStatsInterval is how often Start logs load balancer statistics.
+	defaultStatsInterval = 5 * time.Minute
+	// minLatencySmoothing is the minimum weight of a new latency measurement
+	// in the moving average of the latencies of an endpoint.
+	minLatencySmoothing = 0.2
+)
+
 type affinityState struct {
 	clientIP string
 	//clientProtocol  api.Protocol //not yet used
@@ -55,15 +71,55 @@ type affinityPolicy struct {
 type LoadBalancerRR struct {
 	lock     sync.RWMutex
 	services map[proxy.ServicePortName]*balancerState
+	// clock is used to track and expire sticky sessions.
+	clock clock.Clock
+	// slowStartWindow is the period over which the share of requests of an
+	// endpoint added to a service is ramped up. Zero disables slow start.
+	slowStartWindow time.Duration
+	// latencyDecay, if positive, makes NextEndpoint favor endpoints with lower
+	// recorded latencies. It is the time constant over which the weight of a
+	// latency measurement fades.
+	latencyDecay time.Duration
+	// virtualNodes, if positive, makes ClientIP session affinity assign
+	// clients to endpoints with a consistent hash ring that has that many
+	// virtual nodes per endpoint.
+	virtualNodes int
+	// stickySessionCleanupInterval and statsInterval are the periods of the
+	// background loops launched by Start.
+	stickySessionCleanupInterval time.Duration
+	statsInterval                time.Duration
+	// background tracks the goroutines launched by Start.
+	background sync.WaitGroup
 }
 
 // Ensure this implements LoadBalancer.
 var _ LoadBalancer = &LoadBalancerRR{}
 
+// Ensure this implements LatencyRecorder.
+var _ LatencyRecorder = &LoadBalancerRR{}
+
 type balancerState struct {
-	endpoints []string // a list of "ip:port" style strings
-	index     int      // current index into endpoints
-	affinity  affinityPolicy
+	endpoints      []string // a list of "ip:port" style strings
+	index          int      // current index into endpoints
+	affinity       affinityPolicy
+	endpointLabels map[string]labels.Set       // map "ip:port" -> labels of that endpoint
+	warmUps        map[string]*endpointWarmUp  // map "ip:port" -> slow start of that endpoint
+	latencies      map[string]*endpointLatency // map "ip:port" -> recorded latency of that endpoint
+	weights        map[string]float64          // map "ip:port" -> latency weighted selection state
+	ring           *hashRing                   // consistent hash ring of endpoints, built on demand
+}
+
+// endpointWarmUp tracks an endpoint within its slow start window.
+type endpointWarmUp struct {
+	start  time.Time
+	credit float64
+}
+
+// endpointLatency is the exponentially weighted moving average of the
+// latencies recorded for an endpoint, in nanoseconds.
+type endpointLatency struct {
+	average     float64
+	lastUpdated time.Time
 }
 
 func newAffinityPolicy(affinityType api.ServiceAffinity, ttlMinutes int) *affinityPolicy {
@@ -74,15 +130,107 @@ func newAffinityPolicy(affinityType api.ServiceAffinity, ttlMinutes int) *affini
 	}
 }
 
-// NewLoadBalancerRR returns a new LoadBalancerRR.
-func NewLoadBalancerRR() *LoadBalancerRR {
-	return &LoadBalancerRR{
-		services: map[proxy.ServicePortName]*balancerState{},
+// NewLoadBalancerRR returns a new LoadBalancerRR. Without options, it takes
+// the endpoints of a service in turn.
+func NewLoadBalancerRR(options ...LoadBalancerRROption) *LoadBalancerRR {
+	return newLoadBalancerRR(clock.RealClock{}, options...)
+}
+
+// LoadBalancerRROption sets an optional behavior of the LoadBalancerRR
+// returned by NewLoadBalancerRR.
+type LoadBalancerRROption func(*LoadBalancerRR)
+
+// WithSlowStart makes the LoadBalancerRR gradually ramp up the share of
+// requests of endpoints added to a service over slowStartWindow, after which
+// they participate normally.
+func WithSlowStart(slowStartWindow time.Duration) LoadBalancerRROption {
+	return func(lb *LoadBalancerRR) {
+		lb.slowStartWindow = slowStartWindow
+	}
+}
+
+// WithLatencyWeighting makes the LoadBalancerRR favor endpoints with lower
+// latencies, as recorded by RecordEndpointLatency. Measurements fade over
+// latencyDecay, so that endpoints which were slow get their share of requests
+// back once no new measurements confirm it. With WithSlowStart, the weights
+// of the endpoints in their slow start window are reduced as well.
+func WithLatencyWeighting(latencyDecay time.Duration) LoadBalancerRROption {
+	return func(lb *LoadBalancerRR) {
+		lb.latencyDecay = latencyDecay
+	}
+}
+
+// WithConsistentHashing makes the LoadBalancerRR assign clients of services
+// with ClientIP session affinity to endpoints by consistent hashing of their
+// IPs, with virtualNodes virtual nodes per endpoint. Adding or removing an
+// endpoint then only reassigns a small share of the clients.
+func WithConsistentHashing(virtualNodes int) LoadBalancerRROption {
+	return func(lb *LoadBalancerRR) {
+		lb.virtualNodes = virtualNodes
+	}
+}
+
+// newLoadBalancerRR returns a new LoadBalancerRR that uses the given clock to
+// expire sticky sessions, to track slow start windows and to fade latencies.
+func newLoadBalancerRR(c clock.Clock, options ...LoadBalancerRROption) *LoadBalancerRR {
+	lb := &LoadBalancerRR{
+		services:                     map[proxy.ServicePortName]*balancerState{},
+		clock:                        c,
+		stickySessionCleanupInterval: defaultStickySessionCleanupInterval,
+		statsInterval:                defaultStatsInterval,
+	}
+	for _, option := range options {
+		option(lb)
+	}
+	return lb
+}
+
+// Start launches the removal of expired sticky sessions of all services and
+// the periodic logging of load balancer statistics. Both stop when ctx is
+// cancelled.
+func (lb *LoadBalancerRR) Start(ctx context.Context) {
+	lb.runInBackground(ctx, lb.cleanupAllStaleStickySessions, lb.stickySessionCleanupInterval)
+	lb.runInBackground(ctx, lb.logStats, lb.statsInterval)
+}
+
+// runInBackground runs f every period until ctx is cancelled.
+func (lb *LoadBalancerRR) runInBackground(ctx context.Context, f func(), period time.Duration) {
+	lb.background.Add(1)
+	go func() {
+		defer lb.background.Done()
+		wait.Until(f, period, ctx.Done())
+	}()
+}
+
+// cleanupAllStaleStickySessions removes the expired sticky sessions of all
+// services.
+func (lb *LoadBalancerRR) cleanupAllStaleStickySessions() {
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+
+	for svcPort, state := range lb.services {
+		lb.cleanupStaleStickySessionsInternal(svcPort, state)
+	}
+}
+
+// logStats logs the number of endpoints and sticky sessions of each service.
+func (lb *LoadBalancerRR) logStats() {
+	lb.lock.RLock()
+	defer lb.lock.RUnlock()
+
+	for svcPort, state := range lb.services {
+		glog.V(2).Infof("LoadBalancerRR: service %q has %d endpoints and %d sticky sessions", svcPort, len(state.endpoints), len(state.affinity.affinityMap))
 	}
 }
 
+// NewService registers the service port with the given session affinity. The
+// sticky session age ttlMinutes must be positive for ClientIP affinity and is
+// ignored otherwise.
 func (lb *LoadBalancerRR) NewService(svcPort proxy.ServicePortName, affinityType api.ServiceAffinity, ttlMinutes int) error {
 	glog.V(4).Infof("LoadBalancerRR NewService %q", svcPort)
+	if affinityType == api.ServiceAffinityClientIP && ttlMinutes <= 0 {
+		return fmt.Errorf("invalid sticky session max age %d minutes for service %q: must be positive for %s session affinity", ttlMinutes, svcPort, affinityType)
+	}
 	lb.lock.Lock()
 	defer lb.lock.Unlock()
 	lb.newServiceInternal(svcPort, affinityType, ttlMinutes)
@@ -120,9 +268,202 @@ func isSessionAffinity(affinity *affinityPolicy) bool {
 	return true
 }
 
+// SetEndpointLabels sets the labels of the endpoints of a service, keyed by
+// "ip:port" endpoint string. The labels are used by NextEndpointWithSelector
+// and replace any previously set labels for the service.
+func (lb *LoadBalancerRR) SetEndpointLabels(svcPort proxy.ServicePortName, endpointLabels map[string]labels.Set) {
+	glog.V(4).Infof("LoadBalancerRR SetEndpointLabels %q: %+v", svcPort, endpointLabels)
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+	state := lb.newServiceInternal(svcPort, api.ServiceAffinity(""), 0)
+	state.endpointLabels = endpointLabels
+}
+
+// endpointMatches returns true if the labels of endpoint match selector.
+func (state *balancerState) endpointMatches(endpoint string, selector labels.Selector) bool {
+	return selector.Matches(state.endpointLabels[endpoint])
+}
+
+// hasEndpointMatching returns true if any endpoint matches selector.
+func (state *balancerState) hasEndpointMatching(selector labels.Selector) bool {
+	for _, endpoint := range state.endpoints {
+		if state.endpointMatches(endpoint, selector) {
+			return true
+		}
+	}
+	return false
+}
+
+// warmedUp returns true if endpoint may receive the request. Endpoints in
+// their slow start window accumulate credit proportional to the elapsed part
+// of the window each time they are considered, and receive a request each time
+// the credit reaches one.
+func (state *balancerState) warmedUp(endpoint string, now time.Time, window time.Duration) bool {
+	warmUp, exists := state.warmUps[endpoint]
+	if !exists {
+		return true
+	}
+	elapsed := now.Sub(warmUp.start)
+	if elapsed >= window {
+		delete(state.warmUps, endpoint)
+		return true
+	}
+	warmUp.credit += float64(elapsed) / float64(window)
+	if warmUp.credit >= 1 {
+		warmUp.credit--
+		return true
+	}
+	return false
+}
+
+// startWarmUps starts the slow start window of the endpoints in newEndpoints
+// that are not yet endpoints of state. The first endpoints of a service are
+// not slow started, as there is nothing to share the requests with.
+// This assumes that lb.lock is already held.
+func (lb *LoadBalancerRR) startWarmUps(state *balancerState, newEndpoints []string) {
+	if lb.slowStartWindow <= 0 {
+		return
+	}
+	current := make(map[string]bool, len(state.endpoints))
+	for _, endpoint := range state.endpoints {
+		current[endpoint] = true
+	}
+	warmUps := map[string]*endpointWarmUp{}
+	for _, endpoint := range newEndpoints {
+		if warmUp, exists := state.warmUps[endpoint]; exists {
+			warmUps[endpoint] = warmUp
+		} else if len(current) > 0 && !current[endpoint] {
+			glog.V(4).Infof("LoadBalancerRR: Starting slow start of endpoint %s", endpoint)
+			warmUps[endpoint] = &endpointWarmUp{start: lb.clock.Now()}
+		}
+	}
+	state.warmUps = warmUps
+}
+
+// RecordEndpointLatency records the time endpoint of the service took to
+// respond, from the first byte sent to it until the first byte received from
+// it. It is only used if the load balancer weights endpoints by latency.
+func (lb *LoadBalancerRR) RecordEndpointLatency(svcPort proxy.ServicePortName, endpoint string, d time.Duration) {
+	if lb.latencyDecay <= 0 {
+		return
+	}
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+
+	state, exists := lb.services[svcPort]
+	if !exists || state == nil {
+		return
+	}
+	now := lb.clock.Now()
+	latency, exists := state.latencies[endpoint]
+	if !exists {
+		if state.latencies == nil {
+			state.latencies = map[string]*endpointLatency{}
+		}
+		state.latencies[endpoint] = &endpointLatency{average: float64(d), lastUpdated: now}
+		return
+	}
+	// The older the average, the more it is replaced by the new measurement.
+	smoothing := math.Max(minLatencySmoothing, 1-math.Exp(-float64(now.Sub(latency.lastUpdated))/float64(lb.latencyDecay)))
+	latency.average += smoothing * (float64(d) - latency.average)
+	latency.lastUpdated = now
+}
+
+// expectedLatency returns the average latency of endpoint, faded towards mean
+// the longer it was not updated, or mean if no latency was recorded.
+func (state *balancerState) expectedLatency(endpoint string, mean float64, now time.Time, decay time.Duration) float64 {
+	latency, exists := state.latencies[endpoint]
+	if !exists {
+		return mean
+	}
+	fade := math.Exp(-float64(now.Sub(latency.lastUpdated)) / float64(decay))
+	return mean + (latency.average-mean)*fade
+}
+
+// warmUpFraction returns the elapsed part of the slow start window of
+// endpoint, or one if it is not in its slow start window.
+func (state *balancerState) warmUpFraction(endpoint string, now time.Time, window time.Duration) float64 {
+	warmUp, exists := state.warmUps[endpoint]
+	if !exists {
+		return 1
+	}
+	elapsed := now.Sub(warmUp.start)
+	if elapsed >= window {
+		delete(state.warmUps, endpoint)
+		return 1
+	}
+	return float64(elapsed) / float64(window)
+}
+
+// nextEndpointByLatency returns one of candidates using smooth weighted
+// round-robin, with weights inversely proportional to the expected latencies
+// of the endpoints and reduced during slow start.
+// This assumes that lb.lock is already held.
+func (lb *LoadBalancerRR) nextEndpointByLatency(state *balancerState, candidates []string, now time.Time) string {
+	total, measured := 0.0, 0
+	for _, candidate := range candidates {
+		if latency, exists := state.latencies[candidate]; exists {
+			total += latency.average
+			measured++
+		}
+	}
+	mean := 1.0
+	if measured > 0 {
+		mean = total / float64(measured)
+	}
+
+	weights := make([]float64, len(candidates))
+	totalWeight := 0.0
+	for i, candidate := range candidates {
+		weights[i] = 1 / math.Max(state.expectedLatency(candidate, mean, now, lb.latencyDecay), 1)
+		weights[i] *= state.warmUpFraction(candidate, now, lb.slowStartWindow)
+		totalWeight += weights[i]
+	}
+
+	// The weights are normalized, so that the selection state does not
+	// depend on the scale of the latencies when they were accumulated.
+	if state.weights == nil {
+		state.weights = map[string]float64{}
+	}
+	endpoint := ""
+	for i, candidate := range candidates {
+		if totalWeight > 0 {
+			state.weights[candidate] += weights[i] / totalWeight
+		} else {
+			state.weights[candidate] += 1 / float64(len(candidates))
+		}
+		if endpoint == "" || state.weights[candidate] > state.weights[endpoint] {
+			endpoint = candidate
+		}
+	}
+	state.weights[endpoint]--
+	return endpoint
+}
+
+// retainLatencies forgets the latencies of the endpoints that are not in
+// newEndpoints and restarts the latency weighted selection.
+func (state *balancerState) retainLatencies(newEndpoints []string) {
+	retained := map[string]*endpointLatency{}
+	for _, endpoint := range newEndpoints {
+		if latency, exists := state.latencies[endpoint]; exists {
+			retained[endpoint] = latency
+		}
+	}
+	state.latencies = retained
+	state.weights = nil
+}
+
 // NextEndpoint returns a service endpoint.
 // The service endpoint is chosen using the round-robin algorithm.
 func (lb *LoadBalancerRR) NextEndpoint(svcPort proxy.ServicePortName, srcAddr net.Addr, sessionAffinityReset bool) (string, error) {
+	return lb.NextEndpointWithSelector(svcPort, srcAddr, nil, sessionAffinityReset)
+}
+
+// NextEndpointWithSelector returns a service endpoint whose labels match
+// selector. The service endpoint is chosen using the round-robin algorithm
+// among the matching endpoints. If selector is nil or no endpoint matches it,
+// all endpoints of the service are considered.
+func (lb *LoadBalancerRR) NextEndpointWithSelector(svcPort proxy.ServicePortName, srcAddr net.Addr, selector labels.Selector, sessionAffinityReset bool) (string, error) {
 	// Coarse locking is simple.  We can get more fine-grained if/when we
 	// can prove it matters.
 	lb.lock.Lock()
@@ -138,6 +479,7 @@ func (lb *LoadBalancerRR) NextEndpoint(svcPort proxy.ServicePortName, srcAddr ne
 	glog.V(4).Infof("NextEndpoint for service %q, srcAddr=%v: endpoints: %+v", svcPort, srcAddr, state.endpoints)
 
 	sessionAffinityEnabled := isSessionAffinity(&state.affinity)
+	useSelector := selector != nil && state.hasEndpointMatching(selector)
 
 	var ipaddr string
 	if sessionAffinityEnabled {
@@ -149,18 +491,63 @@ func (lb *LoadBalancerRR) NextEndpoint(svcPort proxy.ServicePortName, srcAddr ne
 		}
 		if !sessionAffinityReset {
 			sessionAffinity, exists := state.affinity.affinityMap[ipaddr]
-			if exists && int(time.Now().Sub(sessionAffinity.lastUsed).Minutes()) < state.affinity.ttlMinutes {
+			if exists && int(lb.clock.Since(sessionAffinity.lastUsed).Minutes()) < state.affinity.ttlMinutes &&
+				(!useSelector || state.endpointMatches(sessionAffinity.endpoint, selector)) {
 				// Affinity wins.
 				endpoint := sessionAffinity.endpoint
-				sessionAffinity.lastUsed = time.Now()
+				sessionAffinity.lastUsed = lb.clock.Now()
 				glog.V(4).Infof("NextEndpoint for service %q from IP %s with sessionAffinity %#v: %s", svcPort, ipaddr, sessionAffinity, endpoint)
 				return endpoint, nil
 			}
 		}
 	}
-	// Take the next endpoint.
-	endpoint := state.endpoints[state.index]
-	state.index = (state.index + 1) % len(state.endpoints)
+	now := lb.clock.Now()
+	endpoint := ""
+	if sessionAffinityEnabled && !sessionAffinityReset && lb.virtualNodes > 0 {
+		if state.ring == nil {
+			state.ring = newHashRing(state.endpoints, lb.virtualNodes)
+		}
+		endpoint = state.ring.get(ipaddr)
+		if useSelector && !state.endpointMatches(endpoint, selector) {
+			endpoint = ""
+		}
+	}
+	switch {
+	case endpoint != "":
+		// The client is assigned to its endpoint on the hash ring.
+	case lb.latencyDecay > 0:
+		candidates := make([]string, 0, len(state.endpoints))
+		for _, candidate := range state.endpoints {
+			if !useSelector || state.endpointMatches(candidate, selector) {
+				candidates = append(candidates, candidate)
+			}
+		}
+		endpoint = lb.nextEndpointByLatency(state, candidates, now)
+	default:
+		// Take the next endpoint, skipping the ones not matching the selector
+		// and the ones in their slow start window that are not due for a
+		// request.
+		warmingUpEndpoint := ""
+		for i := 0; i < len(state.endpoints); i++ {
+			candidate := state.endpoints[state.index]
+			state.index = (state.index + 1) % len(state.endpoints)
+			if useSelector && !state.endpointMatches(candidate, selector) {
+				continue
+			}
+			if !state.warmedUp(candidate, now, lb.slowStartWindow) {
+				if warmingUpEndpoint == "" {
+					warmingUpEndpoint = candidate
+				}
+				continue
+			}
+			endpoint = candidate
+			break
+		}
+		if endpoint == "" {
+			// Only endpoints in their slow start window are left.
+			endpoint = warmingUpEndpoint
+		}
+	}
 
 	if sessionAffinityEnabled {
 		var affinity *affinityState
@@ -169,7 +556,7 @@ func (lb *LoadBalancerRR) NextEndpoint(svcPort proxy.ServicePortName, srcAddr ne
 			affinity = new(affinityState) //&affinityState{ipaddr, "TCP", "", endpoint, time.Now()}
 			state.affinity.affinityMap[ipaddr] = affinity
 		}
-		affinity.lastUsed = time.Now()
+		affinity.lastUsed = lb.clock.Now()
 		affinity.endpoint = endpoint
 		affinity.clientIP = ipaddr
 		glog.V(4).Infof("Updated affinity key %s: %#v", ipaddr, state.affinity.affinityMap[ipaddr])
@@ -264,16 +651,7 @@ func (lb *LoadBalancerRR) OnEndpointsAdd(endpoints *api.Endpoints) {
 
 		if !exists || state == nil || len(newEndpoints) > 0 {
 			glog.V(1).Infof("LoadBalancerRR: Setting endpoints for %s to %+v", svcPort, newEndpoints)
-			lb.updateAffinityMap(svcPort, newEndpoints)
-			// OnEndpointsAdd can be called without NewService being called externally.
-			// To be safe we will call it here.  A new service will only be created
-			// if one does not already exist.  The affinity will be updated
-			// later, once NewService is called.
-			state = lb.newServiceInternal(svcPort, api.ServiceAffinity(""), 0)
-			state.endpoints = slice.ShuffleStrings(newEndpoints)
-
-			// Reset the round-robin index.
-			state.index = 0
+			lb.setEndpointsLocked(svcPort, newEndpoints)
 		}
 	}
 }
@@ -298,16 +676,7 @@ func (lb *LoadBalancerRR) OnEndpointsUpdate(oldEndpoints, endpoints *api.Endpoin
 
 		if !exists || state == nil || len(curEndpoints) != len(newEndpoints) || !slicesEquiv(slice.CopyStrings(curEndpoints), newEndpoints) {
 			glog.V(1).Infof("LoadBalancerRR: Setting endpoints for %s to %+v", svcPort, newEndpoints)
-			lb.updateAffinityMap(svcPort, newEndpoints)
-			// OnEndpointsUpdate can be called without NewService being called externally.
-			// To be safe we will call it here.  A new service will only be created
-			// if one does not already exist.  The affinity will be updated
-			// later, once NewService is called.
-			state = lb.newServiceInternal(svcPort, api.ServiceAffinity(""), 0)
-			state.endpoints = slice.ShuffleStrings(newEndpoints)
-
-			// Reset the round-robin index.
-			state.index = 0
+			lb.setEndpointsLocked(svcPort, newEndpoints)
 		}
 		registeredEndpoints[svcPort] = true
 	}
@@ -319,6 +688,7 @@ func (lb *LoadBalancerRR) OnEndpointsUpdate(oldEndpoints, endpoints *api.Endpoin
 			// Reset but don't delete.
 			state := lb.services[svcPort]
 			state.endpoints = []string{}
+			state.ring = nil
 			state.index = 0
 			state.affinity.affinityMap = map[string]*affinityState{}
 		}
@@ -337,6 +707,7 @@ func (lb *LoadBalancerRR) OnEndpointsDelete(endpoints *api.Endpoints) {
 		// If the service is still around, reset but don't delete.
 		if state, ok := lb.services[svcPort]; ok {
 			state.endpoints = []string{}
+			state.ring = nil
 			state.index = 0
 			state.affinity.affinityMap = map[string]*affinityState{}
 		}
@@ -346,6 +717,36 @@ func (lb *LoadBalancerRR) OnEndpointsDelete(endpoints *api.Endpoints) {
 func (lb *LoadBalancerRR) OnEndpointsSynced() {
 }
 
+// ReplaceEndpoints replaces all endpoints of the service with endpoints, as
+// "ip:port" style strings, under a single lock. Concurrent calls of
+// NextEndpoint see either the old or the new endpoints, never an empty set
+// in between. Sticky sessions to endpoints that are not replaced are kept.
+func (lb *LoadBalancerRR) ReplaceEndpoints(svcPort proxy.ServicePortName, endpoints []string) {
+	glog.V(1).Infof("LoadBalancerRR: Replacing endpoints for %s with %+v", svcPort, endpoints)
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+
+	lb.setEndpointsLocked(svcPort, endpoints)
+}
+
+// setEndpointsLocked sets the endpoints of svcPort and resets its round-robin
+// index. lb.lock must be held.
+func (lb *LoadBalancerRR) setEndpointsLocked(svcPort proxy.ServicePortName, endpoints []string) {
+	lb.updateAffinityMap(svcPort, endpoints)
+	// Endpoints can be set without NewService being called externally.
+	// To be safe we will call it here.  A new service will only be created
+	// if one does not already exist.  The affinity will be updated
+	// later, once NewService is called.
+	state := lb.newServiceInternal(svcPort, api.ServiceAffinity(""), 0)
+	lb.startWarmUps(state, endpoints)
+	state.retainLatencies(endpoints)
+	state.endpoints = slice.ShuffleStrings(endpoints)
+	state.ring = nil
+
+	// Reset the round-robin index.
+	state.index = 0
+}
+
 // Tests whether two slices are equivalent.  This sorts both slices in-place.
 func slicesEquiv(lhs, rhs []string) bool {
 	if len(lhs) != len(rhs) {
@@ -365,8 +766,14 @@ func (lb *LoadBalancerRR) CleanupStaleStickySessions(svcPort proxy.ServicePortNa
 	if !exists {
 		return
 	}
+	lb.cleanupStaleStickySessionsInternal(svcPort, state)
+}
+
+// cleanupStaleStickySessionsInternal removes the expired sticky sessions of
+// the service. This assumes that lb.lock is already held.
+func (lb *LoadBalancerRR) cleanupStaleStickySessionsInternal(svcPort proxy.ServicePortName, state *balancerState) {
 	for ip, affinity := range state.affinity.affinityMap {
-		if int(time.Now().Sub(affinity.lastUsed).Minutes()) >= state.affinity.ttlMinutes {
+		if int(lb.clock.Since(affinity.lastUsed).Minutes()) >= state.affinity.ttlMinutes {
 			glog.V(4).Infof("Removing client %s from affinityMap for service %q", affinity.clientIP, svcPort)
 			delete(state.affinity.affinityMap, ip)
 		}
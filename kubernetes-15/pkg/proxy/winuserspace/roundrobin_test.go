@@ -17,11 +17,19 @@ limitations under the License.
 package winuserspace
 
 import (
+	"context"
+	"fmt"
 	"net"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/clock"
 	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/api"
 	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/proxy"
 )
@@ -118,6 +126,77 @@ func TestLoadBalanceWorksWithSingleEndpoint(t *testing.T) {
 	expectEndpoint(t, loadBalancer, service, "endpoint1:40", nil)
 }
 
+func expectEndpointWithSelector(t *testing.T, loadBalancer *LoadBalancerRR, service proxy.ServicePortName, selector labels.Selector, expected string) {
+	endpoint, err := loadBalancer.NextEndpointWithSelector(service, nil, selector, false)
+	if err != nil {
+		t.Errorf("Didn't find a service for %s, expected %s, failed with: %v", service, expected, err)
+	}
+	if endpoint != expected {
+		t.Errorf("Didn't get expected endpoint for service %s selector %v, expected %s, got: %s", service, selector, expected, endpoint)
+	}
+}
+
+func TestLoadBalanceWorksWithSelector(t *testing.T) {
+	loadBalancer := NewLoadBalancerRR()
+	service := proxy.ServicePortName{NamespacedName: types.NamespacedName{Namespace: "testnamespace", Name: "foo"}, Port: "p"}
+	endpoints := &api.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: service.Name, Namespace: service.Namespace},
+		Subsets: []api.EndpointSubset{{
+			Addresses: []api.EndpointAddress{{IP: "endpoint1"}, {IP: "endpoint2"}, {IP: "endpoint3"}},
+			Ports:     []api.EndpointPort{{Name: "p", Port: 1}},
+		}},
+	}
+	loadBalancer.OnEndpointsAdd(endpoints)
+	loadBalancer.SetEndpointLabels(service, map[string]labels.Set{
+		"endpoint1:1": {"track": "stable"},
+		"endpoint2:1": {"track": "canary"},
+		"endpoint3:1": {"track": "stable"},
+	})
+
+	canary := labels.SelectorFromSet(labels.Set{"track": "canary"})
+	for i := 0; i < 4; i++ {
+		expectEndpointWithSelector(t, loadBalancer, service, canary, "endpoint2:1")
+	}
+
+	stable := labels.SelectorFromSet(labels.Set{"track": "stable"})
+	seen := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		endpoint, err := loadBalancer.NextEndpointWithSelector(service, nil, stable, false)
+		if err != nil {
+			t.Fatalf("Didn't find a service for %s: %v", service, err)
+		}
+		if endpoint == "endpoint2:1" {
+			t.Errorf("Got endpoint %s not matching selector %v", endpoint, stable)
+		}
+		seen[endpoint] = true
+	}
+	if !seen["endpoint1:1"] || !seen["endpoint3:1"] {
+		t.Errorf("Expected round-robin over all matching endpoints, got %v", seen)
+	}
+}
+
+func TestLoadBalanceWithSelectorFallsBackWhenNoneMatch(t *testing.T) {
+	loadBalancer := NewLoadBalancerRR()
+	service := proxy.ServicePortName{NamespacedName: types.NamespacedName{Namespace: "testnamespace", Name: "foo"}, Port: "p"}
+	endpoints := &api.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: service.Name, Namespace: service.Namespace},
+		Subsets: []api.EndpointSubset{{
+			Addresses: []api.EndpointAddress{{IP: "endpoint1"}, {IP: "endpoint2"}},
+			Ports:     []api.EndpointPort{{Name: "p", Port: 1}},
+		}},
+	}
+	loadBalancer.OnEndpointsAdd(endpoints)
+	loadBalancer.SetEndpointLabels(service, map[string]labels.Set{
+		"endpoint1:1": {"track": "stable"},
+	})
+
+	shuffledEndpoints := loadBalancer.services[service].endpoints
+	canary := labels.SelectorFromSet(labels.Set{"track": "canary"})
+	expectEndpointWithSelector(t, loadBalancer, service, canary, shuffledEndpoints[0])
+	expectEndpointWithSelector(t, loadBalancer, service, canary, shuffledEndpoints[1])
+	expectEndpointWithSelector(t, loadBalancer, service, canary, shuffledEndpoints[0])
+}
+
 func stringsInSlice(haystack []string, needles ...string) bool {
 	for _, needle := range needles {
 		found := false
@@ -357,7 +436,7 @@ func TestStickyLoadBalanceWorksWithNewServiceCalledFirst(t *testing.T) {
 	}
 
 	// Call NewService() before OnEndpointsUpdate()
-	loadBalancer.NewService(service, api.ServiceAffinityClientIP, 0)
+	loadBalancer.NewService(service, api.ServiceAffinityClientIP, 180)
 	endpoints := &api.Endpoints{
 		ObjectMeta: metav1.ObjectMeta{Name: service.Name, Namespace: service.Namespace},
 		Subsets: []api.EndpointSubset{
@@ -404,6 +483,219 @@ func TestStickyLoadBalanceWorksWithNewServiceCalledFirst(t *testing.T) {
 	expectEndpoint(t, loadBalancer, service, ep3, client3)
 }
 
+func TestStickySessionExpiresAfterMaxAge(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	loadBalancer := newLoadBalancerRR(fakeClock)
+	service := proxy.ServicePortName{NamespacedName: types.NamespacedName{Namespace: "testnamespace", Name: "foo"}, Port: ""}
+
+	stickyMaxAgeMinutes := 10
+	loadBalancer.NewService(service, api.ServiceAffinityClientIP, stickyMaxAgeMinutes)
+	endpoints := &api.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: service.Name, Namespace: service.Namespace},
+		Subsets: []api.EndpointSubset{
+			{Addresses: []api.EndpointAddress{{IP: "endpoint1"}, {IP: "endpoint2"}}, Ports: []api.EndpointPort{{Port: 1}}},
+		},
+	}
+	loadBalancer.OnEndpointsAdd(endpoints)
+
+	client1 := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0}
+	if _, err := loadBalancer.NextEndpoint(service, client1, false); err != nil {
+		t.Fatalf("Didn't find a service for %s: %v", service, err)
+	}
+
+	fakeClock.Step(time.Duration(stickyMaxAgeMinutes)*time.Minute - time.Second)
+	loadBalancer.CleanupStaleStickySessions(service)
+	if _, exists := loadBalancer.services[service].affinity.affinityMap["127.0.0.1"]; !exists {
+		t.Errorf("Expected session of client %v to exist just before %d minutes", client1, stickyMaxAgeMinutes)
+	}
+
+	fakeClock.Step(time.Second)
+	loadBalancer.CleanupStaleStickySessions(service)
+	if _, exists := loadBalancer.services[service].affinity.affinityMap["127.0.0.1"]; exists {
+		t.Errorf("Expected session of client %v to expire after %d minutes", client1, stickyMaxAgeMinutes)
+	}
+}
+
+func TestLoadBalanceSlowStartsAddedEndpoints(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	slowStartWindow := 10 * time.Minute
+	loadBalancer := newLoadBalancerRR(fakeClock, WithSlowStart(slowStartWindow))
+	service := proxy.ServicePortName{NamespacedName: types.NamespacedName{Namespace: "testnamespace", Name: "foo"}, Port: "p"}
+	endpoints := &api.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: service.Name, Namespace: service.Namespace},
+		Subsets: []api.EndpointSubset{{
+			Addresses: []api.EndpointAddress{{IP: "endpoint1"}, {IP: "endpoint2"}},
+			Ports:     []api.EndpointPort{{Name: "p", Port: 1}},
+		}},
+	}
+	loadBalancer.OnEndpointsAdd(endpoints)
+	updatedEndpoints := &api.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: service.Name, Namespace: service.Namespace},
+		Subsets: []api.EndpointSubset{{
+			Addresses: []api.EndpointAddress{{IP: "endpoint1"}, {IP: "endpoint2"}, {IP: "endpoint3"}},
+			Ports:     []api.EndpointPort{{Name: "p", Port: 1}},
+		}},
+	}
+	loadBalancer.OnEndpointsUpdate(endpoints, updatedEndpoints)
+
+	countSelections := func(n int) map[string]int {
+		counts := map[string]int{}
+		for i := 0; i < n; i++ {
+			endpoint, err := loadBalancer.NextEndpoint(service, nil, false)
+			if err != nil {
+				t.Fatalf("Didn't find a service for %s: %v", service, err)
+			}
+			counts[endpoint]++
+		}
+		return counts
+	}
+
+	// A quarter into the window the new endpoint gets a fraction of the
+	// selections of the existing ones.
+	fakeClock.Step(slowStartWindow / 4)
+	counts := countSelections(300)
+	if counts["endpoint3:1"] == 0 || counts["endpoint3:1"]*2 > counts["endpoint1:1"] {
+		t.Errorf("Expected endpoint3:1 to get less than half the selections of endpoint1:1 during slow start, got %v", counts)
+	}
+
+	// After the window all endpoints participate equally.
+	fakeClock.Step(slowStartWindow)
+	counts = countSelections(300)
+	for _, endpoint := range []string{"endpoint1:1", "endpoint2:1", "endpoint3:1"} {
+		if counts[endpoint] != 100 {
+			t.Errorf("Expected 100 selections of %s after slow start, got %v", endpoint, counts)
+		}
+	}
+}
+
+func TestLoadBalanceFavorsLowLatencyEndpoints(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	latencyDecay := time.Minute
+	loadBalancer := newLoadBalancerRR(fakeClock, WithLatencyWeighting(latencyDecay))
+	service := proxy.ServicePortName{NamespacedName: types.NamespacedName{Namespace: "testnamespace", Name: "foo"}, Port: "p"}
+	endpoints := &api.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: service.Name, Namespace: service.Namespace},
+		Subsets: []api.EndpointSubset{{
+			Addresses: []api.EndpointAddress{{IP: "endpoint1"}, {IP: "endpoint2"}, {IP: "endpoint3"}},
+			Ports:     []api.EndpointPort{{Name: "p", Port: 1}},
+		}},
+	}
+	loadBalancer.OnEndpointsAdd(endpoints)
+	latencies := map[string]time.Duration{
+		"endpoint1:1": 10 * time.Millisecond,
+		"endpoint2:1": 10 * time.Millisecond,
+		"endpoint3:1": 100 * time.Millisecond,
+	}
+
+	countSelections := func(n int, record bool) map[string]int {
+		counts := map[string]int{}
+		for i := 0; i < n; i++ {
+			endpoint, err := loadBalancer.NextEndpoint(service, nil, false)
+			if err != nil {
+				t.Fatalf("Didn't find a service for %s: %v", service, err)
+			}
+			counts[endpoint]++
+			if record {
+				loadBalancer.RecordEndpointLatency(service, endpoint, latencies[endpoint])
+			}
+			fakeClock.Step(time.Second)
+		}
+		return counts
+	}
+
+	// Once latencies are recorded, the slow endpoint gets far fewer
+	// selections than the fast ones.
+	countSelections(30, true)
+	counts := countSelections(300, true)
+	if counts["endpoint3:1"] == 0 || counts["endpoint3:1"]*4 > counts["endpoint1:1"] || counts["endpoint3:1"]*4 > counts["endpoint2:1"] {
+		t.Errorf("Expected endpoint3:1 to get less than a quarter of the selections of the fast endpoints, got %v", counts)
+	}
+
+	// Without new measurements, the recorded latencies fade and all
+	// endpoints participate equally again.
+	fakeClock.Step(10 * latencyDecay)
+	counts = countSelections(300, false)
+	for endpoint := range latencies {
+		if counts[endpoint] < 90 || counts[endpoint] > 110 {
+			t.Errorf("Expected about 100 selections of %s after the latencies faded, got %v", endpoint, counts)
+		}
+	}
+}
+
+func TestLoadBalanceSlowStartsAddedEndpointsWithLatencyWeighting(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	slowStartWindow := 10 * time.Minute
+	loadBalancer := newLoadBalancerRR(fakeClock, WithLatencyWeighting(time.Minute), WithSlowStart(slowStartWindow))
+	service := proxy.ServicePortName{NamespacedName: types.NamespacedName{Namespace: "testnamespace", Name: "foo"}, Port: "p"}
+	endpoints := &api.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: service.Name, Namespace: service.Namespace},
+		Subsets: []api.EndpointSubset{{
+			Addresses: []api.EndpointAddress{{IP: "endpoint1"}, {IP: "endpoint2"}},
+			Ports:     []api.EndpointPort{{Name: "p", Port: 1}},
+		}},
+	}
+	loadBalancer.OnEndpointsAdd(endpoints)
+	updatedEndpoints := &api.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: service.Name, Namespace: service.Namespace},
+		Subsets: []api.EndpointSubset{{
+			Addresses: []api.EndpointAddress{{IP: "endpoint1"}, {IP: "endpoint2"}, {IP: "endpoint3"}},
+			Ports:     []api.EndpointPort{{Name: "p", Port: 1}},
+		}},
+	}
+	loadBalancer.OnEndpointsUpdate(endpoints, updatedEndpoints)
+
+	countSelections := func(n int) map[string]int {
+		counts := map[string]int{}
+		for i := 0; i < n; i++ {
+			endpoint, err := loadBalancer.NextEndpoint(service, nil, false)
+			if err != nil {
+				t.Fatalf("Didn't find a service for %s: %v", service, err)
+			}
+			counts[endpoint]++
+			loadBalancer.RecordEndpointLatency(service, endpoint, 10*time.Millisecond)
+		}
+		return counts
+	}
+
+	// All endpoints are equally fast, but a quarter into the window the new
+	// endpoint gets a fraction of the selections of the existing ones.
+	fakeClock.Step(slowStartWindow / 4)
+	counts := countSelections(300)
+	if counts["endpoint3:1"] == 0 || counts["endpoint3:1"]*2 > counts["endpoint1:1"] {
+		t.Errorf("Expected endpoint3:1 to get less than half the selections of endpoint1:1 during slow start, got %v", counts)
+	}
+
+	// After the window all endpoints participate equally.
+	fakeClock.Step(slowStartWindow)
+	counts = countSelections(300)
+	for _, endpoint := range []string{"endpoint1:1", "endpoint2:1", "endpoint3:1"} {
+		if counts[endpoint] < 90 || counts[endpoint] > 110 {
+			t.Errorf("Expected about 100 selections of %s after slow start, got %v", endpoint, counts)
+		}
+	}
+}
+
+func TestStickyLoadBalanceAssignsClientsByConsistentHashing(t *testing.T) {
+	loadBalancer := NewLoadBalancerRR(WithConsistentHashing(100))
+	service := proxy.ServicePortName{NamespacedName: types.NamespacedName{Namespace: "testnamespace", Name: "foo"}, Port: ""}
+	if err := loadBalancer.NewService(service, api.ServiceAffinityClientIP, 180); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	endpoints := &api.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: service.Name, Namespace: service.Namespace},
+		Subsets: []api.EndpointSubset{
+			{Addresses: []api.EndpointAddress{{IP: "endpoint1"}, {IP: "endpoint2"}, {IP: "endpoint3"}}, Ports: []api.EndpointPort{{Port: 1}}},
+		},
+	}
+	loadBalancer.OnEndpointsAdd(endpoints)
+
+	ring := newHashRing([]string{"endpoint1:1", "endpoint2:1", "endpoint3:1"}, 100)
+	for i := 1; i <= 10; i++ {
+		client := &net.TCPAddr{IP: net.IPv4(127, 0, 0, byte(i)), Port: 0}
+		expectEndpoint(t, loadBalancer, service, ring.get(client.IP.String()), client)
+	}
+}
+
 func TestStickyLoadBalanceWorksWithNewServiceCalledSecond(t *testing.T) {
 	loadBalancer := NewLoadBalancerRR()
 	service := proxy.ServicePortName{NamespacedName: types.NamespacedName{Namespace: "testnamespace", Name: "foo"}, Port: ""}
@@ -421,7 +713,7 @@ func TestStickyLoadBalanceWorksWithNewServiceCalledSecond(t *testing.T) {
 		},
 	}
 	loadBalancer.OnEndpointsAdd(endpoints)
-	loadBalancer.NewService(service, api.ServiceAffinityClientIP, 0)
+	loadBalancer.NewService(service, api.ServiceAffinityClientIP, 180)
 
 	client1 := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0}
 	client2 := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 2), Port: 0}
@@ -473,7 +765,7 @@ func TestStickyLoadBalanaceWorksWithMultipleEndpointsRemoveOne(t *testing.T) {
 		t.Errorf("Didn't fail with non-existent service")
 	}
 
-	loadBalancer.NewService(service, api.ServiceAffinityClientIP, 0)
+	loadBalancer.NewService(service, api.ServiceAffinityClientIP, 180)
 	endpointsv1 := &api.Endpoints{
 		ObjectMeta: metav1.ObjectMeta{Name: service.Name, Namespace: service.Namespace},
 		Subsets: []api.EndpointSubset{
@@ -546,7 +838,7 @@ func TestStickyLoadBalanceWorksWithMultipleEndpointsAndUpdates(t *testing.T) {
 		t.Errorf("Didn't fail with non-existent service")
 	}
 
-	loadBalancer.NewService(service, api.ServiceAffinityClientIP, 0)
+	loadBalancer.NewService(service, api.ServiceAffinityClientIP, 180)
 	endpointsv1 := &api.Endpoints{
 		ObjectMeta: metav1.ObjectMeta{Name: service.Name, Namespace: service.Namespace},
 		Subsets: []api.EndpointSubset{
@@ -605,7 +897,7 @@ func TestStickyLoadBalanceWorksWithServiceRemoval(t *testing.T) {
 	if err == nil || len(endpoint) != 0 {
 		t.Errorf("Didn't fail with non-existent service")
 	}
-	loadBalancer.NewService(fooService, api.ServiceAffinityClientIP, 0)
+	loadBalancer.NewService(fooService, api.ServiceAffinityClientIP, 180)
 	endpoints1 := &api.Endpoints{
 		ObjectMeta: metav1.ObjectMeta{Name: fooService.Name, Namespace: fooService.Namespace},
 		Subsets: []api.EndpointSubset{
@@ -616,7 +908,7 @@ func TestStickyLoadBalanceWorksWithServiceRemoval(t *testing.T) {
 		},
 	}
 	barService := proxy.ServicePortName{NamespacedName: types.NamespacedName{Namespace: "testnamespace", Name: "bar"}, Port: ""}
-	loadBalancer.NewService(barService, api.ServiceAffinityClientIP, 0)
+	loadBalancer.NewService(barService, api.ServiceAffinityClientIP, 180)
 	endpoints2 := &api.Endpoints{
 		ObjectMeta: metav1.ObjectMeta{Name: barService.Name, Namespace: barService.Namespace},
 		Subsets: []api.EndpointSubset{
@@ -674,7 +966,7 @@ func TestStickyLoadBalanceWorksWithEndpointFails(t *testing.T) {
 	}
 
 	// Call NewService() before OnEndpointsUpdate()
-	loadBalancer.NewService(service, api.ServiceAffinityClientIP, 0)
+	loadBalancer.NewService(service, api.ServiceAffinityClientIP, 180)
 	endpoints := &api.Endpoints{
 		ObjectMeta: metav1.ObjectMeta{Name: service.Name, Namespace: service.Namespace},
 		Subsets: []api.EndpointSubset{
@@ -715,3 +1007,171 @@ func TestStickyLoadBalanceWorksWithEndpointFails(t *testing.T) {
 	expectEndpointWithSessionAffinityReset(t, loadBalancer, service, ep1, client2)
 	expectEndpointWithSessionAffinityReset(t, loadBalancer, service, ep2, client3)
 }
+
+func TestStartStopsWhenContextIsCancelled(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	loadBalancer := newLoadBalancerRR(fakeClock)
+	loadBalancer.stickySessionCleanupInterval = time.Millisecond
+	loadBalancer.statsInterval = time.Millisecond
+	service := proxy.ServicePortName{NamespacedName: types.NamespacedName{Namespace: "testnamespace", Name: "foo"}, Port: ""}
+	loadBalancer.NewService(service, api.ServiceAffinityClientIP, 1)
+	endpoints := &api.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: service.Name, Namespace: service.Namespace},
+		Subsets: []api.EndpointSubset{{
+			Addresses: []api.EndpointAddress{{IP: "endpoint1"}},
+			Ports:     []api.EndpointPort{{Port: 1}},
+		}},
+	}
+	loadBalancer.OnEndpointsAdd(endpoints)
+	client := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0}
+	expectEndpoint(t, loadBalancer, service, "endpoint1:1", client)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	loadBalancer.Start(ctx)
+
+	// Expired sticky sessions are removed in the background.
+	fakeClock.Step(2 * time.Minute)
+	if err := wait.PollImmediate(time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
+		loadBalancer.lock.RLock()
+		defer loadBalancer.lock.RUnlock()
+		return len(loadBalancer.services[service].affinity.affinityMap) == 0, nil
+	}); err != nil {
+		t.Errorf("Expected the expired sticky session to be removed: %v", err)
+	}
+
+	// Services may be added and deleted while shutting down.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			svc := proxy.ServicePortName{NamespacedName: types.NamespacedName{Namespace: "testnamespace", Name: "bar"}, Port: strconv.Itoa(i)}
+			loadBalancer.NewService(svc, api.ServiceAffinityClientIP, 1)
+			loadBalancer.DeleteService(svc)
+		}
+	}()
+	cancel()
+	<-done
+
+	stopped := make(chan struct{})
+	go func() {
+		loadBalancer.background.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Errorf("Expected the background goroutines to stop when the context is cancelled")
+	}
+}
+
+func TestNewServiceValidatesStickyMaxAge(t *testing.T) {
+	testCases := []struct {
+		affinityType        api.ServiceAffinity
+		stickyMaxAgeMinutes int
+		expectError         bool
+	}{
+		{api.ServiceAffinityClientIP, 1, false},
+		{api.ServiceAffinityClientIP, 0, true},
+		{api.ServiceAffinityClientIP, -1, true},
+		{api.ServiceAffinityNone, 0, false},
+		{api.ServiceAffinityNone, -1, false},
+	}
+
+	for _, tc := range testCases {
+		loadBalancer := NewLoadBalancerRR()
+		service := proxy.ServicePortName{NamespacedName: types.NamespacedName{Namespace: "testnamespace", Name: "foo"}, Port: ""}
+		err := loadBalancer.NewService(service, tc.affinityType, tc.stickyMaxAgeMinutes)
+		if tc.expectError {
+			if err == nil {
+				t.Errorf("%s affinity with max age %d: expected an error", tc.affinityType, tc.stickyMaxAgeMinutes)
+			}
+			if _, exists := loadBalancer.services[service]; exists {
+				t.Errorf("%s affinity with max age %d: expected the service not to be registered", tc.affinityType, tc.stickyMaxAgeMinutes)
+			}
+		} else if err != nil {
+			t.Errorf("%s affinity with max age %d: unexpected error: %v", tc.affinityType, tc.stickyMaxAgeMinutes, err)
+		}
+	}
+}
+
+func TestReplaceEndpointsNeverExposesAnEmptySet(t *testing.T) {
+	loadBalancer := NewLoadBalancerRR()
+	service := proxy.ServicePortName{NamespacedName: types.NamespacedName{Namespace: "testnamespace", Name: "foo"}, Port: "p"}
+	endpointSets := [][]string{
+		{"endpoint:1", "endpoint:2"},
+		{"endpoint:3", "endpoint:4", "endpoint:5"},
+	}
+	valid := map[string]bool{}
+	for _, endpoints := range endpointSets {
+		for _, endpoint := range endpoints {
+			valid[endpoint] = true
+		}
+	}
+	loadBalancer.ReplaceEndpoints(service, endpointSets[0])
+
+	stop := make(chan struct{})
+	errs := make(chan error, 1)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				endpoint, err := loadBalancer.NextEndpoint(service, nil, false)
+				if err == nil && !valid[endpoint] {
+					err = fmt.Errorf("unexpected endpoint %q", endpoint)
+				}
+				if err != nil {
+					select {
+					case errs <- err:
+					default:
+					}
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 1000; i++ {
+		loadBalancer.ReplaceEndpoints(service, endpointSets[i%len(endpointSets)])
+	}
+	close(stop)
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		t.Errorf("Expected NextEndpoint to succeed while the endpoints are replaced, got: %v", err)
+	default:
+	}
+}
+
+func TestStickyReplaceEndpointsKeepsAffinityOfSurvivingEndpoints(t *testing.T) {
+	client1 := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0}
+	client2 := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 2), Port: 0}
+	loadBalancer := NewLoadBalancerRR()
+	service := proxy.ServicePortName{NamespacedName: types.NamespacedName{Namespace: "testnamespace", Name: "foo"}, Port: ""}
+	loadBalancer.NewService(service, api.ServiceAffinityClientIP, 180)
+	loadBalancer.ReplaceEndpoints(service, []string{"endpoint:1", "endpoint:2"})
+	shuffledEndpoints := loadBalancer.services[service].endpoints
+	expectEndpoint(t, loadBalancer, service, shuffledEndpoints[0], client1)
+	expectEndpoint(t, loadBalancer, service, shuffledEndpoints[1], client2)
+
+	// Replace the endpoint of client2, the one of client1 survives.
+	surviving := shuffledEndpoints[0]
+	loadBalancer.ReplaceEndpoints(service, []string{surviving, "endpoint:3"})
+	expectEndpoint(t, loadBalancer, service, surviving, client1)
+	if _, exists := loadBalancer.services[service].affinity.affinityMap["127.0.0.2"]; exists {
+		t.Errorf("Expected the affinity of client2 to its removed endpoint to be dropped")
+	}
+	endpoint, err := loadBalancer.NextEndpoint(service, client2, false)
+	if err != nil {
+		t.Fatalf("Didn't find a service for %s: %v", service, err)
+	}
+	if endpoint != surviving && endpoint != "endpoint:3" {
+		t.Errorf("Expected client2 to get one of the new endpoints, got: %s", endpoint)
+	}
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operationexecutor
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// failureInjector fails operations on purpose, so that the reconcilers using
+// the executor can be tested against failing operations in a controlled way.
+type failureInjector struct {
+	lock     sync.Mutex
+	rand     *rand.Rand
+	failures map[string]injectedFailure
+}
+
+// injectedFailure is the share of operations of a type that fail, and the
+// error they fail with.
+type injectedFailure struct {
+	fraction float64
+	err      error
+}
+
+func newFailureInjector() *failureInjector {
+	return &failureInjector{
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		failures: make(map[string]injectedFailure),
+	}
+}
+
+// injectedError returns the error the operation of type operationName must
+// fail with, or nil if it may run.
+func (f *failureInjector) injectedError(operationName string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	failure, exists := f.failures[operationName]
+	if !exists || failure.fraction <= 0 {
+		return nil
+	}
+	if failure.fraction < 1 && f.rand.Float64() >= failure.fraction {
+		return nil
+	}
+	return failure.err
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operationexecutor
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/api/v1"
+)
+
+func TestOperationExecutor_AttachVolume_InjectedFailure(t *testing.T) {
+	// Arrange
+	ch, quit := make(chan interface{}), make(chan interface{})
+	injectedErr := errors.New("injected attach failure")
+	oe := NewOperationExecutor(
+		newFakeOperationGenerator(ch, quit),
+		WithFailureInjection("AttachVolume", 1, injectedErr))
+	volumeName := v1.UniqueVolumeName("pd-volume")
+	asw := newFakeAttacherActualStateOfWorld()
+	asw.volumesDetached[volumeName] = true
+
+	// Act
+	err := oe.AttachVolume(VolumeToAttach{VolumeName: volumeName, NodeName: "node"}, asw)
+
+	// Assert
+	if err != injectedErr {
+		t.Fatalf("Expected AttachVolume to fail with the injected error, got: %v", err)
+	}
+	if oe.IsOperationPending(volumeName, "" /* podName */) {
+		t.Errorf("Expected no pending operation for volume %q", volumeName)
+	}
+	if numOperationsStarted(ch, quit) != 0 {
+		t.Errorf("Expected the attach operation not to run")
+	}
+	if !asw.volumesDetached[volumeName] {
+		t.Errorf("Expected the actual state of world to be untouched")
+	}
+}
+
+func TestOperationExecutor_InjectsFailuresOnlyForConfiguredOperations(t *testing.T) {
+	ch, quit := make(chan interface{}), make(chan interface{})
+	oe := NewOperationExecutor(
+		newFakeOperationGenerator(ch, quit),
+		WithFailureInjection("AttachVolume", 1, errors.New("injected attach failure")))
+
+	err := oe.DetachVolume(AttachedVolume{VolumeName: "pd-volume", NodeName: "node"}, false /* verifySafeToDetach */, nil /* actualStateOfWorld */)
+	if err != nil {
+		t.Fatalf("Expected DetachVolume to run, got: %v", err)
+	}
+	if numOperationsStarted(ch, quit) != 1 {
+		t.Errorf("Expected the detach operation to run")
+	}
+}
+
+func TestFailureInjector_Fraction(t *testing.T) {
+	injectedErr := errors.New("injected failure")
+	testCases := []struct {
+		fraction       float64
+		expectFailures int
+	}{
+		{0, 0},
+		{1, 100},
+		{-1, 0},
+	}
+
+	for _, tc := range testCases {
+		injector := newFailureInjector()
+		injector.failures["AttachVolume"] = injectedFailure{fraction: tc.fraction, err: injectedErr}
+		failures := 0
+		for i := 0; i < 100; i++ {
+			if injector.injectedError("AttachVolume") != nil {
+				failures++
+			}
+		}
+		if failures != tc.expectFailures {
+			t.Errorf("fraction %v: expected %d of 100 operations to fail, got %d", tc.fraction, tc.expectFailures, failures)
+		}
+	}
+}
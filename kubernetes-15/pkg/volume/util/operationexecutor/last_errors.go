@@ -0,0 +1,65 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operationexecutor
+
+import (
+	"sync"
+
+	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/api/v1"
+	volumetypes "github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/volume/util/types"
+)
+
+// lastErrors remembers the error of the last operation on each volume and
+// pod that failed, until an operation on them succeeds.
+type lastErrors struct {
+	lock   sync.Mutex
+	errors map[operationKey]error
+}
+
+func newLastErrors() *lastErrors {
+	return &lastErrors{errors: make(map[operationKey]error)}
+}
+
+// get returns the error of the last operation on volumeName and podName, or
+// nil if it succeeded or none ran yet.
+func (l *lastErrors) get(volumeName v1.UniqueVolumeName, podName volumetypes.UniquePodName) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.errors[operationKey{volumeName, podName}]
+}
+
+// wrap returns a function that runs operation and remembers its error for
+// volumeName and podName, or forgets the previous one if it succeeded.
+func (l *lastErrors) wrap(volumeName v1.UniqueVolumeName, podName volumetypes.UniquePodName, operation func() error) func() error {
+	return func() error {
+		err := operation()
+		if IsOperationCancelledError(err) {
+			// The operation did not run, so it did not fail either.
+			return err
+		}
+
+		l.lock.Lock()
+		defer l.lock.Unlock()
+		key := operationKey{volumeName, podName}
+		if err == nil {
+			delete(l.errors, key)
+		} else {
+			l.errors[key] = err
+		}
+		return err
+	}
+}
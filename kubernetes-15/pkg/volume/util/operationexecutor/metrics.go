@@ -0,0 +1,106 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operationexecutor
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/util/clock"
+	v1helper "github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/api/v1/helper"
+	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/volume"
+)
+
+const operationExecutorSubsystem = "volume_operation_executor"
+
+// unknownMetricLabelValue is the value of metric labels that could not be
+// resolved for an operation, e.g. the StorageClass of an inline volume.
+const unknownMetricLabelValue = "unknown"
+
+var (
+	nilVolumeSpecCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Subsystem: operationExecutorSubsystem,
+			Name:      "verify_attached_nil_spec_total",
+			Help:      "Number of attached volumes whose attachment could not be verified because their volume spec was nil.",
+		},
+	)
+	operationDurationSeconds = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Subsystem: operationExecutorSubsystem,
+			Name:      "operation_duration_seconds",
+			Help:      "Duration of AttachVolume and MountVolume operations by plugin and StorageClass of the volume.",
+		},
+		[]string{"operation_name", "plugin_name", "storage_class"},
+	)
+)
+
+var registerMetrics sync.Once
+
+// RegisterMetrics registers the operation executor metrics. It is called by
+// NewOperationExecutor and does nothing after the first call.
+func RegisterMetrics() {
+	registerMetrics.Do(func() {
+		prometheus.MustRegister(nilVolumeSpecCounter)
+		prometheus.MustRegister(operationDurationSeconds)
+	})
+}
+
+// measureOperation returns a function that runs operation and observes its
+// duration, labelled with the plugin and StorageClass of spec.
+func measureOperation(
+	clock clock.Clock,
+	pluginMgr *volume.VolumePluginMgr,
+	operationName string,
+	spec *volume.Spec,
+	operation func() error) func() error {
+	pluginName := pluginMetricLabel(pluginMgr, spec)
+	storageClass := storageClassMetricLabel(spec)
+	return func() error {
+		start := clock.Now()
+		err := operation()
+		operationDurationSeconds.WithLabelValues(operationName, pluginName, storageClass).Observe(clock.Since(start).Seconds())
+		return err
+	}
+}
+
+// pluginMetricLabel returns the name of the plugin of spec, or
+// unknownMetricLabelValue if it can not be found.
+func pluginMetricLabel(pluginMgr *volume.VolumePluginMgr, spec *volume.Spec) string {
+	if pluginMgr == nil || spec == nil {
+		return unknownMetricLabelValue
+	}
+	plugin, err := pluginMgr.FindPluginBySpec(spec)
+	if err != nil || plugin == nil {
+		return unknownMetricLabelValue
+	}
+	return plugin.GetPluginName()
+}
+
+// storageClassMetricLabel returns the name of the StorageClass of the
+// persistent volume of spec, or unknownMetricLabelValue if spec is not a
+// persistent volume or has no class. Only the name is used, so that the
+// number of label values is bounded by the number of classes.
+func storageClassMetricLabel(spec *volume.Spec) string {
+	if spec == nil || spec.PersistentVolume == nil {
+		return unknownMetricLabelValue
+	}
+	if class := v1helper.GetPersistentVolumeClass(spec.PersistentVolume); class != "" {
+		return class
+	}
+	return unknownMetricLabelValue
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operationexecutor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/clock"
+	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/api/v1"
+	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/volume"
+	volumetesting "github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/volume/testing"
+)
+
+func TestStorageClassMetricLabel(t *testing.T) {
+	newPersistentVolumeSpec := func(storageClassName string, annotations map[string]string) *volume.Spec {
+		return volume.NewSpecFromPersistentVolume(&v1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pv", Annotations: annotations},
+			Spec:       v1.PersistentVolumeSpec{StorageClassName: storageClassName},
+		}, false /* readOnly */)
+	}
+	inlineSpec := volume.NewSpecFromVolume(&getTestPodWithGCEPD("pod1", "pd-volume").Spec.Volumes[0])
+
+	testCases := map[string]struct {
+		spec     *volume.Spec
+		expected string
+	}{
+		"nil spec":               {spec: nil, expected: unknownMetricLabelValue},
+		"inline volume":          {spec: inlineSpec, expected: unknownMetricLabelValue},
+		"persistent volume":      {spec: newPersistentVolumeSpec("fast", nil), expected: "fast"},
+		"beta annotation":        {spec: newPersistentVolumeSpec("", map[string]string{v1.BetaStorageClassAnnotation: "slow"}), expected: "slow"},
+		"persistent volume only": {spec: newPersistentVolumeSpec("", nil), expected: unknownMetricLabelValue},
+	}
+
+	for name, tc := range testCases {
+		if label := storageClassMetricLabel(tc.spec); label != tc.expected {
+			t.Errorf("%s: expected storage class label %q, got %q", name, tc.expected, label)
+		}
+	}
+}
+
+func TestMeasureOperationLabelsStorageClass(t *testing.T) {
+	volumePluginMgr, fakePlugin := volumetesting.GetTestVolumePluginMgr(t)
+	spec := volume.NewSpecFromPersistentVolume(&v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pv"},
+		Spec: v1.PersistentVolumeSpec{
+			StorageClassName: "fast",
+			PersistentVolumeSource: v1.PersistentVolumeSource{
+				GCEPersistentDisk: &v1.GCEPersistentDiskVolumeSource{PDName: "pd"},
+			},
+		},
+	}, false /* readOnly */)
+	histogram := operationDurationSeconds.WithLabelValues("MountVolume", fakePlugin.GetPluginName(), "fast")
+	countBefore := getHistogramSampleCount(t, histogram)
+	fakeClock := clock.NewFakeClock(time.Now())
+
+	measured := measureOperation(fakeClock, volumePluginMgr, "MountVolume", spec, func() error {
+		fakeClock.Step(2 * time.Second)
+		return nil
+	})
+	if err := measured(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if count := getHistogramSampleCount(t, histogram) - countBefore; count != 1 {
+		t.Errorf("expected one observation labelled with StorageClass %q, got %d", "fast", count)
+	}
+}
+
+func getHistogramSampleCount(t *testing.T, histogram prometheus.Histogram) uint64 {
+	metric := &dto.Metric{}
+	if err := histogram.Write(metric); err != nil {
+		t.Fatalf("Failed to read histogram: %v", err)
+	}
+	return metric.GetHistogram().GetSampleCount()
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operationexecutor
+
+import (
+	"strings"
+)
+
+// MountRefChecker decides whether a device mount path is still referenced by
+// other mounts, in which case the device must not be unmounted yet.
+type MountRefChecker interface {
+	// HasMountRefs returns true if any of mountRefs, the other mount points
+	// of the device mounted at mountPath, still references the device.
+	HasMountRefs(mountPath string, mountRefs []string) bool
+}
+
+// StrictMountRefChecker considers every other mount point of the device a
+// reference.
+type StrictMountRefChecker struct{}
+
+var _ MountRefChecker = StrictMountRefChecker{}
+
+// HasMountRefs returns true if there are any mountRefs.
+func (StrictMountRefChecker) HasMountRefs(mountPath string, mountRefs []string) bool {
+	return len(mountRefs) > 0
+}
+
+// GCIMounterMountRefChecker is the default MountRefChecker.
+//
+// TODO: this is a workaround for the unmount device issue caused by gci mounter.
+// In GCI cluster, if gci mounter is used for mounting, the container started by mounter
+// script will cause additional mounts created in the container. Since these mounts are
+// irrelavant to the original mounts, they should be not considered when checking the
+// mount references. Current solution is to filter out those mount paths that contain
+// the string of original mount path.
+// Plan to work on better approach to solve this issue.
+type GCIMounterMountRefChecker struct{}
+
+var _ MountRefChecker = GCIMounterMountRefChecker{}
+
+// HasMountRefs returns true if any of mountRefs does not contain mountPath.
+func (GCIMounterMountRefChecker) HasMountRefs(mountPath string, mountRefs []string) bool {
+	count := 0
+	for _, ref := range mountRefs {
+		if !strings.Contains(ref, mountPath) {
+			count = count + 1
+		}
+	}
+	return count > 0
+}
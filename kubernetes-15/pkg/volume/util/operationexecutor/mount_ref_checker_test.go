@@ -0,0 +1,88 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operationexecutor
+
+import (
+	"testing"
+)
+
+func TestStrictMountRefChecker(t *testing.T) {
+	mountPath := "/var/lib/kubelet/plugins/kubernetes.io/gce-pd/mounts/disk1"
+	testCases := map[string]struct {
+		mountRefs []string
+		expected  bool
+	}{
+		"no refs": {
+			mountRefs: nil,
+			expected:  false,
+		},
+		"unrelated ref": {
+			mountRefs: []string{"/var/lib/kubelet/pods/pod1/volumes/kubernetes.io~gce-pd/disk1"},
+			expected:  true,
+		},
+		"ref containing the mount path": {
+			mountRefs: []string{"/home/kubernetes/containerized_mounter/rootfs" + mountPath},
+			expected:  true,
+		},
+	}
+
+	for name, tc := range testCases {
+		if actual := (StrictMountRefChecker{}).HasMountRefs(mountPath, tc.mountRefs); actual != tc.expected {
+			t.Errorf("%s: expected HasMountRefs to return %v, got %v", name, tc.expected, actual)
+		}
+	}
+}
+
+func TestGCIMounterMountRefChecker(t *testing.T) {
+	mountPath := "/var/lib/kubelet/plugins/kubernetes.io/gce-pd/mounts/disk1"
+	testCases := map[string]struct {
+		mountRefs []string
+		expected  bool
+	}{
+		"no refs": {
+			mountRefs: nil,
+			expected:  false,
+		},
+		"unrelated ref": {
+			mountRefs: []string{"/var/lib/kubelet/pods/pod1/volumes/kubernetes.io~gce-pd/disk1"},
+			expected:  true,
+		},
+		"gci mounter ref": {
+			mountRefs: []string{"/home/kubernetes/containerized_mounter/rootfs" + mountPath},
+			expected:  false,
+		},
+		"gci mounter ref and unrelated ref": {
+			mountRefs: []string{
+				"/home/kubernetes/containerized_mounter/rootfs" + mountPath,
+				"/var/lib/kubelet/pods/pod1/volumes/kubernetes.io~gce-pd/disk1",
+			},
+			expected: true,
+		},
+		// The workaround matches substrings, so a ref of a different disk
+		// whose path starts with the mount path is ignored as well.
+		"ref of a disk with the mount path as prefix": {
+			mountRefs: []string{mountPath + "0"},
+			expected:  false,
+		},
+	}
+
+	for name, tc := range testCases {
+		if actual := (GCIMounterMountRefChecker{}).HasMountRefs(mountPath, tc.mountRefs); actual != tc.expected {
+			t.Errorf("%s: expected HasMountRefs to return %v, got %v", name, tc.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operationexecutor
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/util/clock"
+	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/api/v1"
+	volumetypes "github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/volume/util/types"
+)
+
+// OperationBackoff configures an exponential backoff applied to an operation
+// after it fails, in addition to the backoff of the pending operations.
+type OperationBackoff struct {
+	// InitialDelay is the time to wait before retrying after the first failure.
+	InitialDelay time.Duration
+
+	// MaxDelay is the maximum time to wait before retrying.
+	MaxDelay time.Duration
+}
+
+// failureExpiry is how long the failures of an operation are kept after it
+// was permitted to run again, or after its retries were given up on. Once it
+// passed, the operation starts over with a fresh backoff, so that operations
+// that are not retried anymore do not accumulate and given up operations are
+// not rejected for good.
+const failureExpiry = 10 * time.Minute
+
+// operationBackoff tracks the failures of an operation per volume and pod and
+// rejects retries until the backoff for them has passed, or once nextBackoff
+// gave up on them.
+type operationBackoff struct {
+	// nextBackoff returns the time to wait before retrying an operation that
+	// failed attempts times in a row, the last time with err after waiting
+	// lastDelay, or false if it must not be retried anymore.
+	nextBackoff func(attempts int, lastDelay time.Duration, err error) (time.Duration, bool)
+
+	clock clock.Clock
+
+	lock     sync.Mutex
+	failures map[operationKey]*operationFailure
+}
+
+// operationKey identifies the operations that share a backoff, the same way
+// the pending operations identify operations that may not run in parallel.
+type operationKey struct {
+	volumeName v1.UniqueVolumeName
+	podName    volumetypes.UniquePodName
+}
+
+type operationFailure struct {
+	attempts            int
+	lastErrorTime       time.Time
+	durationBeforeRetry time.Duration
+	gaveUp              bool
+}
+
+// expiryTime returns the time after which the failure is forgotten, which is
+// failureExpiry after its backoff passed.
+func (f *operationFailure) expiryTime() time.Time {
+	return f.lastErrorTime.Add(f.durationBeforeRetry).Add(failureExpiry)
+}
+
+// expired returns whether the failure is older than failureExpiry.
+func (f *operationFailure) expired(now time.Time) bool {
+	return now.After(f.expiryTime())
+}
+
+// newOperationBackoff returns a backoff that doubles the time to wait before
+// retrying with every failure, from config.InitialDelay up to
+// config.MaxDelay.
+func newOperationBackoff(config OperationBackoff) *operationBackoff {
+	return newOperationBackoffFunc(func(attempts int, lastDelay time.Duration, _ error) (time.Duration, bool) {
+		if attempts == 1 {
+			return config.InitialDelay, true
+		}
+		if delay := 2 * lastDelay; delay < config.MaxDelay {
+			return delay, true
+		}
+		return config.MaxDelay, true
+	})
+}
+
+func newOperationBackoffFunc(nextBackoff func(attempts int, lastDelay time.Duration, err error) (time.Duration, bool)) *operationBackoff {
+	return &operationBackoff{
+		nextBackoff: nextBackoff,
+		clock:       clock.RealClock{},
+		failures:    make(map[operationKey]*operationFailure),
+	}
+}
+
+// safeToRetry returns an error if the operation on volumeName and podName
+// failed and its backoff has not passed yet, or its retries were given up on.
+func (b *operationBackoff) safeToRetry(operationName string, volumeName v1.UniqueVolumeName, podName volumetypes.UniquePodName) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	failure, exists := b.failures[operationKey{volumeName, podName}]
+	if !exists || failure.expired(b.clock.Now()) {
+		return nil
+	}
+	if failure.gaveUp {
+		return newRetriesExhaustedError(operationName, volumeName, failure.attempts, failure.expiryTime())
+	}
+	if retryTime := failure.lastErrorTime.Add(failure.durationBeforeRetry); b.clock.Now().Before(retryTime) {
+		return newOperationBackoffError(operationName, volumeName, retryTime, failure.durationBeforeRetry)
+	}
+	return nil
+}
+
+// wrap returns a function that runs operation and updates the backoff of
+// volumeName and podName with its result.
+func (b *operationBackoff) wrap(volumeName v1.UniqueVolumeName, podName volumetypes.UniquePodName, operation func() error) func() error {
+	return func() error {
+		err := operation()
+
+		b.lock.Lock()
+		defer b.lock.Unlock()
+		now := b.clock.Now()
+		b.pruneLocked(now)
+		key := operationKey{volumeName, podName}
+		if err == nil {
+			delete(b.failures, key)
+			return nil
+		}
+		if IsOperationCancelledError(err) {
+			// The operation did not run, so it did not fail either.
+			return err
+		}
+		failure, exists := b.failures[key]
+		if !exists {
+			failure = &operationFailure{}
+			b.failures[key] = failure
+		}
+		failure.attempts++
+		failure.lastErrorTime = now
+		durationBeforeRetry, retry := b.nextBackoff(failure.attempts, failure.durationBeforeRetry, err)
+		failure.durationBeforeRetry = durationBeforeRetry
+		failure.gaveUp = !retry
+		return err
+	}
+}
+
+// pruneLocked forgets the expired failures. b.lock must be held.
+func (b *operationBackoff) pruneLocked(now time.Time) {
+	for key, failure := range b.failures {
+		if failure.expired(now) {
+			delete(b.failures, key)
+		}
+	}
+}
+
+// operationBackoffError is returned when an operation is rejected because it
+// failed recently and its backoff has not passed yet.
+type operationBackoffError struct {
+	operationName       string
+	volumeName          v1.UniqueVolumeName
+	retryTime           time.Time
+	durationBeforeRetry time.Duration
+}
+
+var _ error = operationBackoffError{}
+
+func (err operationBackoffError) Error() string {
+	return fmt.Sprintf(
+		"%s for volume %q failed. No retries permitted until %v (durationBeforeRetry %v)",
+		err.operationName,
+		err.volumeName,
+		err.retryTime,
+		err.durationBeforeRetry)
+}
+
+// newOperationBackoffError returns a new instance of operationBackoffError.
+func newOperationBackoffError(operationName string, volumeName v1.UniqueVolumeName, retryTime time.Time, durationBeforeRetry time.Duration) error {
+	return operationBackoffError{
+		operationName:       operationName,
+		volumeName:          volumeName,
+		retryTime:           retryTime,
+		durationBeforeRetry: durationBeforeRetry,
+	}
+}
+
+// IsOperationBackoffError returns true if an error returned from
+// OperationExecutor is an operationBackoffError.
+func IsOperationBackoffError(err error) bool {
+	switch err.(type) {
+	case operationBackoffError:
+		return true
+	default:
+		return false
+	}
+}
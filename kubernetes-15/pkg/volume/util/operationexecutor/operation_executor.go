@@ -21,13 +21,19 @@ limitations under the License.
 package operationexecutor
 
 import (
-	"strings"
+	"context"
+	"fmt"
+	"os"
+	"sync"
 	"time"
 
 	"github.com/golang/glog"
 
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/clock"
 	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/api/v1"
+	kevents "github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/kubelet/events"
 	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/util/mount"
 	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/volume"
 	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/volume/util/nestedpendingoperations"
@@ -114,24 +120,251 @@ type OperationExecutor interface {
 	// IsOperationPending returns true if an operation for the given volumeName and podName is pending,
 	// otherwise it returns false
 	IsOperationPending(volumeName v1.UniqueVolumeName, podName volumetypes.UniquePodName) bool
+
+	// WaitForOperation blocks until no operation for the given volumeName
+	// and podName is pending, in which case it returns nil, or until ctx is
+	// done, in which case it returns the error of ctx.
+	WaitForOperation(ctx context.Context, volumeName v1.UniqueVolumeName, podName volumetypes.UniquePodName) error
+
+	// LastError returns the error of the last operation for the given
+	// volumeName and podName if it failed, or nil if it succeeded or no
+	// operation ran yet. The pod name is the one the operation was pending
+	// with, which is empty for operations that are exclusive per volume.
+	LastError(volumeName v1.UniqueVolumeName, podName volumetypes.UniquePodName) error
+
+	// DrainOperationsForPlugin cancels the operations of the given plugin that
+	// have not started yet, so that the reconciler regenerates them against a
+	// reloaded plugin without backoff. Operations that already started run to
+	// completion. Operations start as soon as they are issued unless they
+	// wait for a slot, so only the MountVolume operations waiting for a
+	// concurrent mount slot set by WithMaxConcurrentMounts are cancelled in
+	// practice, and without it this does nothing.
+	DrainOperationsForPlugin(pluginName string)
+
+	// PauseVolume keeps the executor from starting new operations on the
+	// given volume until ResumeVolume is called, they fail with an error for
+	// which IsVolumePausedError returns true instead. Operations that are
+	// already pending are not affected. This is meant for inspecting the
+	// state of a stuck volume without the reconciler changing it.
+	PauseVolume(volumeName v1.UniqueVolumeName)
+
+	// ResumeVolume lets the executor start operations on a volume paused by
+	// PauseVolume again.
+	ResumeVolume(volumeName v1.UniqueVolumeName)
+
+	// SnapshotPending returns the operations that were started and did not
+	// complete yet, sorted by volume, pod and operation name. The records
+	// can be serialized, e.g. for the kubelet to checkpoint them and compare
+	// them with its desired state of the world after a restart using
+	// PartitionPendingOperations. Taking a snapshot does not affect the
+	// operations.
+	SnapshotPending() []PendingOperationRecord
+
+	// StaleOperations returns the operations of SnapshotPending that were
+	// started more than olderThan ago, e.g. for a monitor to alert about
+	// operations that are wedged.
+	StaleOperations(olderThan time.Duration) []PendingOperationRecord
 }
 
 // NewOperationExecutor returns a new instance of OperationExecutor.
+// By default the executor uses the real clock, does not record events or
+// trace operations, skips MountVolume operations issued again within
+// DefaultMountDeduplicationWindow after they succeeded, does not inject
+// failures, retries failed operations with the exponential backoff of the
+// pending operations only, does not limit the number of concurrent
+// MountVolume operations and has no circuit breakers for plugins, options
+// may change this. The operation metrics are registered with the first
+// executor, which both the kubelet and the attach/detach controller create.
 func NewOperationExecutor(
-	operationGenerator OperationGenerator) OperationExecutor {
+	operationGenerator OperationGenerator,
+	options ...OperationExecutorOption) OperationExecutor {
+
+	RegisterMetrics()
+	oe := &operationExecutor{
+		operationGenerator:       operationGenerator,
+		clock:                    clock.RealClock{},
+		recorder:                 noopEventRecorder{},
+		tracer:                   noopTracer{},
+		operations:               make(map[*trackedOperation]bool),
+		operationsChanged:        make(chan struct{}),
+		lastErrors:               newLastErrors(),
+		pausedVolumes:            make(map[v1.UniqueVolumeName]bool),
+		mountDeduplicationWindow: DefaultMountDeduplicationWindow,
+	}
+	for _, option := range options {
+		option(oe)
+	}
+	oe.pendingOperations = nestedpendingoperations.NewNestedPendingOperations(
+		oe.retries == nil /* exponentialBackOffOnError */)
+	if oe.mountDeduplicationWindow > 0 {
+		oe.recentMounts = newRecentSuccesses(oe.mountDeduplicationWindow, oe.clock)
+	}
+	if oe.attachVerificationBackoff != nil {
+		oe.attachVerificationBackoff.clock = oe.clock
+	}
+	if oe.pluginCircuitBreakers != nil {
+		oe.pluginCircuitBreakers.clock = oe.clock
+	}
+	if oe.retries != nil {
+		oe.retries.clock = oe.clock
+	}
+	if oe.deviceUnmountBackoff != nil {
+		oe.deviceUnmountBackoff.clock = oe.clock
+	}
+	return oe
+}
+
+// OperationExecutorOption sets an optional dependency of the OperationExecutor
+// returned by NewOperationExecutor.
+type OperationExecutorOption func(*operationExecutor)
+
+// WithClock sets the clock used for backoffs and timeouts.
+func WithClock(clock clock.Clock) OperationExecutorOption {
+	return func(oe *operationExecutor) {
+		oe.clock = clock
+	}
+}
+
+// WithEventRecorder sets the recorder for events about failed operations.
+func WithEventRecorder(recorder EventRecorder) OperationExecutorOption {
+	return func(oe *operationExecutor) {
+		oe.recorder = recorder
+	}
+}
 
-	return &operationExecutor{
-		pendingOperations: nestedpendingoperations.NewNestedPendingOperations(
-			true /* exponentialBackOffOnError */),
-		operationGenerator: operationGenerator,
+// WithTracer sets the tracer that starts a span for every operation.
+func WithTracer(tracer Tracer) OperationExecutorOption {
+	return func(oe *operationExecutor) {
+		oe.tracer = tracer
 	}
 }
 
+// WithDeviceUnmountBackoff makes the executor retry failed UnmountDevice
+// operations with backoff on top of the backoff of the pending operations,
+// which allows kernel references to a busy device to drain before the next
+// attempt.
+func WithDeviceUnmountBackoff(backoff OperationBackoff) OperationExecutorOption {
+	return func(oe *operationExecutor) {
+		oe.deviceUnmountBackoff = newOperationBackoff(backoff)
+	}
+}
+
+// WithMaxConcurrentMounts limits the number of MountVolume operations running
+// at the same time to maxConcurrentMounts, other operations are not limited
+// by it. A limit of zero or less disables limiting.
+func WithMaxConcurrentMounts(maxConcurrentMounts int) OperationExecutorOption {
+	return func(oe *operationExecutor) {
+		oe.mountSemaphore = nil
+		if maxConcurrentMounts > 0 {
+			oe.mountSemaphore = make(chan struct{}, maxConcurrentMounts)
+		}
+	}
+}
+
+// WithMountSlotTimeout sets how long a MountVolume operation limited by
+// WithMaxConcurrentMounts waits for another one to complete before it fails.
+// A timeout of zero, the default, makes it wait until it is cancelled.
+func WithMountSlotTimeout(timeout time.Duration) OperationExecutorOption {
+	return func(oe *operationExecutor) {
+		oe.mountSlotTimeout = timeout
+	}
+}
+
+// WithRetryPolicy makes policy decide when failed operations are retried
+// instead of the exponential backoff of the pending operations.
+func WithRetryPolicy(policy RetryPolicy) OperationExecutorOption {
+	return func(oe *operationExecutor) {
+		oe.retries = newRetryPolicyBackoff(policy)
+	}
+}
+
+// WithMountDeduplicationWindow sets how long after a MountVolume operation
+// succeeded the same MountVolume operation is skipped as already satisfied.
+// Remounts, see VolumeToMount.Remount, are never skipped, since they are
+// issued to refresh a mount that is known to exist. A window of zero disables
+// skipping.
+func WithMountDeduplicationWindow(window time.Duration) OperationExecutorOption {
+	return func(oe *operationExecutor) {
+		oe.mountDeduplicationWindow = window
+	}
+}
+
+// WithFailureInjection makes the given fraction, between zero and one, of the
+// operations of type operationName, e.g. "AttachVolume", fail with err
+// instead of running. It is meant for chaos testing of the callers of the
+// executor, no operations fail on purpose unless it is set.
+func WithFailureInjection(operationName string, fraction float64, err error) OperationExecutorOption {
+	return func(oe *operationExecutor) {
+		if oe.failureInjector == nil {
+			oe.failureInjector = newFailureInjector()
+		}
+		oe.failureInjector.failures[operationName] = injectedFailure{fraction: fraction, err: err}
+	}
+}
+
+// WithAttachVerificationBackoff sets the backoff applied to
+// VerifyControllerAttachedVolume operations that failed, typically because
+// the attach/detach controller did not report the volume as attached yet,
+// on top of the backoff of the pending operations. Each of these operations
+// fetches the node object, so a longer backoff spares the API server when the
+// controller is slow to attach volumes.
+func WithAttachVerificationBackoff(backoff OperationBackoff) OperationExecutorOption {
+	return func(oe *operationExecutor) {
+		oe.attachVerificationBackoff = newOperationBackoff(backoff)
+	}
+}
+
+// WithPluginCircuitBreaker makes the executor reject the AttachVolume,
+// MountVolume and UnmountVolume operations on the volumes of a plugin whose
+// operations of these types failed breaker.FailureThreshold times in a row
+// for breaker.Cooldown, with an error for which IsPluginCircuitOpenError
+// returns true. It keeps a plugin that fails systemically from using up
+// resources on operations bound to fail. An invalid breaker is logged and
+// not used.
+func WithPluginCircuitBreaker(breaker PluginCircuitBreaker) OperationExecutorOption {
+	return func(oe *operationExecutor) {
+		if err := breaker.validate(); err != nil {
+			glog.Errorf("Not using the volume plugin circuit breaker: %v", err)
+			return
+		}
+		oe.pluginCircuitBreakers = newPluginCircuitBreakers(breaker)
+	}
+}
+
+// EventRecorder records events about objects, it is implemented by
+// record.EventRecorder.
+type EventRecorder interface {
+	Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{})
+}
+
+// noopEventRecorder is the EventRecorder used if none is set, it drops all
+// events.
+type noopEventRecorder struct{}
+
+func (noopEventRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+}
+
+// MarkVolumeOpts is the volume mounted to a pod that MarkVolumeAsMounted
+// records. Information about the mount is added as a field here rather than
+// as a parameter of MarkVolumeAsMounted.
+type MarkVolumeOpts struct {
+	PodName             volumetypes.UniquePodName
+	PodUID              types.UID
+	VolumeName          v1.UniqueVolumeName
+	Mounter             volume.Mounter
+	OuterVolumeSpecName string
+	VolumeGidValue      string
+
+	// FSGroup is the pod's securityContext.fsGroup that volume ownership was
+	// applied with. It is nil if no fsGroup was requested.
+	FSGroup *int64
+}
+
 // ActualStateOfWorldMounterUpdater defines a set of operations updating the actual
 // state of the world cache after successful mount/unmount.
 type ActualStateOfWorldMounterUpdater interface {
 	// Marks the specified volume as mounted to the specified pod
-	MarkVolumeAsMounted(podName volumetypes.UniquePodName, podUID types.UID, volumeName v1.UniqueVolumeName, mounter volume.Mounter, outerVolumeSpecName string, volumeGidValue string) error
+	MarkVolumeAsMounted(markVolumeOpts MarkVolumeOpts) error
 
 	// Marks the specified volume as unmounted from the specified pod
 	MarkVolumeAsUnmounted(podName volumetypes.UniquePodName, volumeName v1.UniqueVolumeName) error
@@ -167,6 +400,54 @@ type ActualStateOfWorldAttacherUpdater interface {
 	AddVolumeToReportAsAttached(volumeName v1.UniqueVolumeName, nodeName types.NodeName)
 }
 
+// ActualStateOfWorldRediscoverer may optionally be implemented by an
+// ActualStateOfWorldAttacherUpdater that is able to repopulate the spec of an
+// attached volume, for example from the pods that reference it.
+type ActualStateOfWorldRediscoverer interface {
+	// Marks the specified volume as needing its spec to be rediscovered
+	// before it can be verified.
+	MarkVolumeForRediscovery(volumeName v1.UniqueVolumeName, nodeName types.NodeName)
+}
+
+// ActualStateOfWorldMountChecker may optionally be implemented by an
+// ActualStateOfWorldAttacherUpdater that also tracks the volumes mounted to
+// pods, for example the kubelet's actual state of world.
+type ActualStateOfWorldMountChecker interface {
+	// Returns the pods the specified volume is recorded as mounted to on the
+	// specified node.
+	GetPodsMountingVolume(volumeName v1.UniqueVolumeName, nodeName types.NodeName) []volumetypes.UniquePodName
+}
+
+// ActualStateOfWorldDevicePathGetter may optionally be implemented by an
+// ActualStateOfWorldMounterUpdater that records the device paths of the
+// volumes attached to the node, for example the kubelet's actual state of
+// world.
+type ActualStateOfWorldDevicePathGetter interface {
+	// Returns the device path the specified volume is currently recorded as
+	// attached at, and whether the volume is recorded as attached.
+	GetAttachedVolumeDevicePath(volumeName v1.UniqueVolumeName) (string, bool)
+}
+
+// NodeSerializedMountVolumePlugin may optionally be implemented by a volume
+// plugin whose volumes must be mounted one at a time on a node, even if the
+// plugin is not attachable, for example inline volumes whose driver keeps
+// per node state.
+type NodeSerializedMountVolumePlugin interface {
+	volume.VolumePlugin
+
+	// RequiresNodeSerializedMount returns true if mounts of the volumes of
+	// this plugin must not run in parallel for different pods.
+	RequiresNodeSerializedMount() bool
+}
+
+// PluginRequiresNodeSerializedMount returns true if plugin implements
+// NodeSerializedMountVolumePlugin and requires node serialized mounts. It is
+// used to set VolumeToMount.PluginRequiresNodeSerializedMount.
+func PluginRequiresNodeSerializedMount(plugin volume.VolumePlugin) bool {
+	serializedPlugin, ok := plugin.(NodeSerializedMountVolumePlugin)
+	return ok && serializedPlugin.RequiresNodeSerializedMount()
+}
+
 // VolumeToAttach represents a volume that should be attached to a node.
 type VolumeToAttach struct {
 	// VolumeName is the unique identifier for the volume that should be
@@ -216,6 +497,11 @@ type VolumeToMount struct {
 	// the volume.Attacher interface
 	PluginIsAttachable bool
 
+	// PluginRequiresNodeSerializedMount indicates that the plugin for this
+	// volume implements NodeSerializedMountVolumePlugin and requires mounts
+	// of the volume to be serialized on the node, regardless of pod.
+	PluginRequiresNodeSerializedMount bool
+
 	// VolumeGidValue contains the value of the GID annotation, if present.
 	VolumeGidValue string
 
@@ -226,6 +512,29 @@ type VolumeToMount struct {
 	// ReportedInUse indicates that the volume was successfully added to the
 	// VolumesInUse field in the node's status.
 	ReportedInUse bool
+
+	// Remount indicates that the volume is already mounted to the pod
+	// according to the actual state of the world and MountVolume is being
+	// called again to refresh the mount.
+	Remount bool
+
+	// MountedFSGroup is the fsGroup recorded in the MountedVolume for this
+	// pod. It is only meaningful when Remount is set, and is compared against
+	// the pod's current fsGroup to decide whether ownership must be
+	// re-applied.
+	MountedFSGroup *int64
+}
+
+// AsAttachedVolume returns the AttachedVolume for the volume to mount when it
+// is attached to the given node.
+func (volumeToMount VolumeToMount) AsAttachedVolume(nodeName types.NodeName) AttachedVolume {
+	return AttachedVolume{
+		VolumeName:         volumeToMount.VolumeName,
+		VolumeSpec:         volumeToMount.VolumeSpec,
+		NodeName:           nodeName,
+		PluginIsAttachable: volumeToMount.PluginIsAttachable,
+		DevicePath:         volumeToMount.DevicePath,
+	}
 }
 
 // AttachedVolume represents a volume that is attached to a node.
@@ -351,6 +660,85 @@ type MountedVolume struct {
 
 	// VolumeGidValue contains the value of the GID annotation, if present.
 	VolumeGidValue string
+
+	// FSGroup is the pod's securityContext.fsGroup that volume ownership was
+	// last applied with. It is nil if no fsGroup was requested.
+	FSGroup *int64
+}
+
+// nilVolumeSpecError is returned when an operation requires the spec of an
+// attached volume but the spec is nil. This happens when the attach/detach
+// controller recovers a volume from node status without a referencing pod.
+type nilVolumeSpecError struct {
+	volumeName v1.UniqueVolumeName
+	nodeName   types.NodeName
+}
+
+// NewNilVolumeSpecError returns an error indicating the spec of the given
+// volume attached to the given node is nil.
+func NewNilVolumeSpecError(volumeName v1.UniqueVolumeName, nodeName types.NodeName) error {
+	return nilVolumeSpecError{volumeName: volumeName, nodeName: nodeName}
+}
+
+func (err nilVolumeSpecError) Error() string {
+	return fmt.Sprintf("volume spec is nil for volume %q on node %q", err.volumeName, err.nodeName)
+}
+
+// operationCancelledError is returned by operations that were cancelled by
+// DrainOperationsForPlugin before they started.
+type operationCancelledError struct {
+	operationName string
+	volumeName    v1.UniqueVolumeName
+}
+
+var _ error = operationCancelledError{}
+
+func (err operationCancelledError) Error() string {
+	return fmt.Sprintf("%s for volume %q was cancelled because its plugin was reloaded", err.operationName, err.volumeName)
+}
+
+// newOperationCancelledError returns a new instance of operationCancelledError.
+func newOperationCancelledError(operationName string, volumeName v1.UniqueVolumeName) error {
+	return operationCancelledError{operationName: operationName, volumeName: volumeName}
+}
+
+// IsOperationCancelledError returns true if the specified error is an
+// operationCancelledError.
+func IsOperationCancelledError(err error) bool {
+	_, ok := err.(operationCancelledError)
+	return ok
+}
+
+// volumePausedError is returned for operations that were not started because
+// their volume is paused by PauseVolume.
+type volumePausedError struct {
+	operationName string
+	volumeName    v1.UniqueVolumeName
+}
+
+var _ error = volumePausedError{}
+
+func (err volumePausedError) Error() string {
+	return fmt.Sprintf("%s for volume %q was not started because the volume is paused", err.operationName, err.volumeName)
+}
+
+// newVolumePausedError returns a new instance of volumePausedError.
+func newVolumePausedError(operationName string, volumeName v1.UniqueVolumeName) error {
+	return volumePausedError{operationName: operationName, volumeName: volumeName}
+}
+
+// IsVolumePausedError returns true if the specified error is a
+// volumePausedError.
+func IsVolumePausedError(err error) bool {
+	_, ok := err.(volumePausedError)
+	return ok
+}
+
+// IsNilVolumeSpecError returns true if the specified error is a
+// nilVolumeSpecError.
+func IsNilVolumeSpecError(err error) bool {
+	_, ok := err.(nilVolumeSpecError)
+	return ok
 }
 
 type operationExecutor struct {
@@ -361,6 +749,320 @@ type operationExecutor struct {
 	// operationGenerator is an interface that provides implementations for
 	// generating volume function
 	operationGenerator OperationGenerator
+
+	// deviceUnmountBackoff, if set, is the backoff applied to failed
+	// UnmountDevice operations on top of the pendingOperations backoff.
+	deviceUnmountBackoff *operationBackoff
+
+	// attachVerificationBackoff, if set, is the backoff applied to failed
+	// VerifyControllerAttachedVolume operations on top of the
+	// pendingOperations backoff.
+	attachVerificationBackoff *operationBackoff
+
+	// mountSemaphore, if set, limits the number of MountVolume operations
+	// running at the same time to its capacity.
+	mountSemaphore chan struct{}
+
+	// mountSlotTimeout, if greater than zero, is how long MountVolume
+	// operations wait for a slot of the mountSemaphore.
+	mountSlotTimeout time.Duration
+
+	// retries, if set, decides when failed operations are retried in place
+	// of the pendingOperations backoff.
+	retries *operationBackoff
+
+	// clock is used for backoffs and timeouts.
+	clock clock.Clock
+
+	// recorder records events about failed operations.
+	recorder EventRecorder
+
+	// tracer starts the spans of operations.
+	tracer Tracer
+
+	// operations are the operations that were not completed yet, so that
+	// they can be cancelled by DrainOperationsForPlugin. A cancelled
+	// operation is removed once it returned, like any other. operationsChanged
+	// is closed and replaced whenever operations are removed, see
+	// WaitForOperation.
+	operationsLock    sync.Mutex
+	operations        map[*trackedOperation]bool
+	operationsChanged chan struct{}
+
+	// pausedVolumes are the volumes no new operations are started on, see
+	// PauseVolume.
+	pausedVolumesLock sync.RWMutex
+	pausedVolumes     map[v1.UniqueVolumeName]bool
+
+	// mountDeduplicationWindow is how long successful MountVolume operations
+	// are remembered in recentMounts.
+	mountDeduplicationWindow time.Duration
+
+	// recentMounts, if set, are the MountVolume operations that succeeded
+	// within the mountDeduplicationWindow, keyed by volume and pod.
+	recentMounts *recentSuccesses
+
+	// failureInjector, if set, fails operations on purpose.
+	failureInjector *failureInjector
+
+	// pluginCircuitBreakers, if set, reject the operations of plugins that
+	// keep failing.
+	pluginCircuitBreakers *pluginCircuitBreakers
+
+	// lastErrors are the errors of the operations that failed last, keyed
+	// by volume and pod.
+	lastErrors *lastErrors
+}
+
+// trackedOperation is an operation on a volume that can be cancelled until it
+// starts. Its startTime is zero until it starts running, see markStarted.
+type trackedOperation struct {
+	operationName string
+	volumeName    v1.UniqueVolumeName
+	podName       volumetypes.UniquePodName
+	pluginName    string
+	span          spanTags
+	startTime     time.Time
+	cancelled     chan struct{}
+}
+
+// spanTags are the node and pod the span of an operation is tagged with, see
+// traceOperation. The pod may differ from the one the operation is pending
+// for, e.g. a MountVolume operation of an attachable volume is pending for
+// all pods of the volume but traced with the pod it mounts the volume to.
+type spanTags struct {
+	nodeName types.NodeName
+	podName  volumetypes.UniquePodName
+}
+
+// trackOperation registers a new operation on volumeName and podName.
+func (oe *operationExecutor) trackOperation(operationName string, volumeName v1.UniqueVolumeName, podName volumetypes.UniquePodName, span spanTags) *trackedOperation {
+	op := &trackedOperation{
+		operationName: operationName,
+		volumeName:    volumeName,
+		podName:       podName,
+		pluginName:    oe.pluginNameOfOperation(operationName, volumeName),
+		span:          span,
+		cancelled:     make(chan struct{}),
+	}
+	oe.operationsLock.Lock()
+	defer oe.operationsLock.Unlock()
+	oe.operations[op] = true
+	return op
+}
+
+// pluginNameOfOperation returns the name of the plugin of the operation on
+// volumeName, or an empty string for operations without a volume name.
+// BulkVerifyVolumes operations are pending with the plugin name as their
+// volume name.
+func (oe *operationExecutor) pluginNameOfOperation(operationName string, volumeName v1.UniqueVolumeName) string {
+	switch {
+	case volumeName == "":
+		return ""
+	case operationName == "BulkVerifyVolumes":
+		return string(volumeName)
+	}
+	return pluginNameOfVolume(oe.operationGenerator.GetVolumePluginMgr(), volumeName)
+}
+
+// markStarted returns a function that records when op starts running and then
+// runs operationFunc in the span of op.
+func (oe *operationExecutor) markStarted(op *trackedOperation, operationFunc func() error) func() error {
+	tracedFunc := traceOperation(oe.tracer, op.operationName, op.volumeName, op.span.nodeName, op.span.podName, operationFunc)
+	return func() error {
+		oe.operationsLock.Lock()
+		op.startTime = oe.clock.Now()
+		oe.operationsLock.Unlock()
+		return tracedFunc()
+	}
+}
+
+func (oe *operationExecutor) untrackOperation(op *trackedOperation) {
+	oe.operationsLock.Lock()
+	defer oe.operationsLock.Unlock()
+	if oe.operations[op] {
+		delete(oe.operations, op)
+		oe.notifyOperationsChangedLocked()
+	}
+}
+
+// notifyOperationsChangedLocked wakes up the callers of WaitForOperation. It
+// must be called with operationsLock held.
+func (oe *operationExecutor) notifyOperationsChangedLocked() {
+	close(oe.operationsChanged)
+	oe.operationsChanged = make(chan struct{})
+}
+
+// operationCompletePollInterval is how often WaitForOperation checks whether
+// the pendingOperations forgot an operation that is no longer tracked. An
+// operation is untracked as the last thing it does, so this is only waited
+// for briefly.
+const operationCompletePollInterval = 5 * time.Millisecond
+
+// WaitForOperation is answered by the pendingOperations, like
+// IsOperationPending, so that an operation can be issued again as soon as it
+// returns. It is woken up when an operation is untracked, which happens just
+// before the pendingOperations forget it, and only polls for the rest.
+func (oe *operationExecutor) WaitForOperation(ctx context.Context, volumeName v1.UniqueVolumeName, podName volumetypes.UniquePodName) error {
+	for {
+		oe.operationsLock.Lock()
+		tracked := oe.isOperationTrackedLocked(volumeName, podName)
+		changed := oe.operationsChanged
+		oe.operationsLock.Unlock()
+
+		if !oe.pendingOperations.IsOperationPending(volumeName, podName) {
+			return nil
+		}
+		var completed <-chan time.Time
+		if !tracked {
+			completed = time.After(operationCompletePollInterval)
+		}
+		select {
+		case <-changed:
+		case <-completed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// isOperationTrackedLocked returns true if an operation on volumeName and
+// podName was not completed yet. Like the pending operations, an operation
+// without a pod name conflicts with the operations on all pods of the volume.
+// It must be called with operationsLock held.
+func (oe *operationExecutor) isOperationTrackedLocked(volumeName v1.UniqueVolumeName, podName volumetypes.UniquePodName) bool {
+	for op := range oe.operations {
+		if op.volumeName == volumeName && (op.podName == "" || podName == "" || op.podName == podName) {
+			return true
+		}
+	}
+	return false
+}
+
+func (oe *operationExecutor) PauseVolume(volumeName v1.UniqueVolumeName) {
+	oe.pausedVolumesLock.Lock()
+	defer oe.pausedVolumesLock.Unlock()
+	oe.pausedVolumes[volumeName] = true
+}
+
+func (oe *operationExecutor) ResumeVolume(volumeName v1.UniqueVolumeName) {
+	oe.pausedVolumesLock.Lock()
+	defer oe.pausedVolumesLock.Unlock()
+	delete(oe.pausedVolumes, volumeName)
+}
+
+func (oe *operationExecutor) isVolumePaused(volumeName v1.UniqueVolumeName) bool {
+	oe.pausedVolumesLock.RLock()
+	defer oe.pausedVolumesLock.RUnlock()
+	return oe.pausedVolumes[volumeName]
+}
+
+// checkVolumeNotPaused returns a volumePausedError if volumeName is paused.
+// Operations check it before they touch deduplication or backoff state.
+func (oe *operationExecutor) checkVolumeNotPaused(operationName string, volumeName v1.UniqueVolumeName) error {
+	if !oe.isVolumePaused(volumeName) {
+		return nil
+	}
+	glog.V(4).Infof("Skipping %s for paused volume %q", operationName, volumeName)
+	return newVolumePausedError(operationName, volumeName)
+}
+
+func (oe *operationExecutor) DrainOperationsForPlugin(pluginName string) {
+	oe.operationsLock.Lock()
+	defer oe.operationsLock.Unlock()
+	for op := range oe.operations {
+		if op.pluginName == pluginName {
+			select {
+			case <-op.cancelled:
+				// Cancelled by an earlier drain.
+			default:
+				glog.V(2).Infof("Cancelling pending operation for volume %q of reloaded plugin %q", op.volumeName, pluginName)
+				close(op.cancelled)
+			}
+		}
+	}
+}
+
+// run runs operationFunc as the pending operation on volumeName and podName,
+// subject to the retry policy if one is set, in a span tagged with span.
+// Operations without a volume name may run in parallel and are not tracked by
+// the retry policy.
+func (oe *operationExecutor) run(
+	operationName string,
+	volumeName v1.UniqueVolumeName,
+	podName volumetypes.UniquePodName,
+	span spanTags,
+	operationFunc func() error) error {
+	op := oe.trackOperation(operationName, volumeName, podName, span)
+	return oe.runTracked(op, operationName, volumeName, podName, oe.markStarted(op, operationFunc))
+}
+
+// runTracked is run for an operation registered with trackOperation, whose
+// operationFunc reports when it starts with markStarted. The operation fails
+// without running operationFunc if it is cancelled before it starts.
+func (oe *operationExecutor) runTracked(
+	op *trackedOperation,
+	operationName string,
+	volumeName v1.UniqueVolumeName,
+	podName volumetypes.UniquePodName,
+	operationFunc func() error) error {
+	if err := oe.checkVolumeNotPaused(operationName, volumeName); err != nil {
+		oe.untrackOperation(op)
+		return err
+	}
+	if oe.failureInjector != nil {
+		if err := oe.failureInjector.injectedError(operationName); err != nil {
+			oe.untrackOperation(op)
+			glog.V(4).Infof("Injected failure of %s for volume %q: %v", operationName, volumeName, err)
+			return err
+		}
+	}
+	if oe.retries != nil && volumeName != "" {
+		if err := oe.retries.safeToRetry(operationName, volumeName, podName); err != nil {
+			oe.untrackOperation(op)
+			return err
+		}
+		operationFunc = oe.retries.wrap(volumeName, podName, operationFunc)
+	}
+	pluginName, trial := "", false
+	if oe.pluginCircuitBreakers != nil && volumeName != "" && pluginCircuitBreakerOperations.Has(operationName) {
+		pluginName = op.pluginName
+		var err error
+		if trial, err = oe.pluginCircuitBreakers.allow(operationName, pluginName); err != nil {
+			oe.untrackOperation(op)
+			return err
+		}
+		operationFunc = oe.pluginCircuitBreakers.wrap(pluginName, trial, operationFunc)
+	}
+	operationFunc = oe.lastErrors.wrap(volumeName, podName, operationFunc)
+	trackedFunc := func() error {
+		defer oe.untrackOperation(op)
+		err := newOperationCancelledError(operationName, volumeName)
+		select {
+		case <-op.cancelled:
+		default:
+			err = operationFunc()
+		}
+		if IsOperationCancelledError(err) {
+			// A cancelled operation did not fail, it is regenerated without
+			// the pendingOperations backoff.
+			glog.V(4).Infof("%v", err)
+			return nil
+		}
+		return err
+	}
+	err := oe.pendingOperations.Run(volumeName, podName, trackedFunc)
+	if err != nil {
+		oe.untrackOperation(op)
+		if trial {
+			oe.pluginCircuitBreakers.release(pluginName)
+		}
+	}
+	return err
+}
+
+func (oe *operationExecutor) LastError(volumeName v1.UniqueVolumeName, podName volumetypes.UniquePodName) error {
+	return oe.lastErrors.get(volumeName, podName)
 }
 
 func (oe *operationExecutor) IsOperationPending(volumeName v1.UniqueVolumeName, podName volumetypes.UniquePodName) bool {
@@ -376,8 +1078,11 @@ func (oe *operationExecutor) AttachVolume(
 		return err
 	}
 
-	return oe.pendingOperations.Run(
-		volumeToAttach.VolumeName, "" /* podName */, attachFunc)
+	attachFunc = measureOperation(oe.clock, oe.operationGenerator.GetVolumePluginMgr(),
+		"AttachVolume", volumeToAttach.VolumeSpec, attachFunc)
+
+	return oe.run(
+		"AttachVolume", volumeToAttach.VolumeName, "" /* podName */, spanTags{nodeName: volumeToAttach.NodeName}, attachFunc)
 }
 
 func (oe *operationExecutor) DetachVolume(
@@ -390,8 +1095,8 @@ func (oe *operationExecutor) DetachVolume(
 		return err
 	}
 
-	return oe.pendingOperations.Run(
-		volumeToDetach.VolumeName, "" /* podName */, detachFunc)
+	return oe.run(
+		"DetachVolume", volumeToDetach.VolumeName, "" /* podName */, spanTags{nodeName: volumeToDetach.NodeName}, detachFunc)
 }
 func (oe *operationExecutor) VerifyVolumesAreAttached(
 	attachedVolumes map[types.NodeName][]AttachedVolume,
@@ -400,24 +1105,34 @@ func (oe *operationExecutor) VerifyVolumesAreAttached(
 	// A map of plugin names and nodes on which they exist with volumes they manage
 	bulkVerifyPluginsByNode := make(map[string]map[types.NodeName][]*volume.Spec)
 	volumeSpecMapByPlugin := make(map[string]map[*volume.Spec]v1.UniqueVolumeName)
+	// A volume attached to several nodes has the same spec on all of them,
+	// so each spec only needs to be resolved to its plugin once.
+	volumePluginBySpec := make(map[*volume.Spec]volume.VolumePlugin)
 
 	for node, nodeAttachedVolumes := range attachedVolumes {
 		for _, volumeAttached := range nodeAttachedVolumes {
 			if volumeAttached.VolumeSpec == nil {
-				glog.Errorf("VerifyVolumesAreAttached: nil spec for volume %s", volumeAttached.VolumeName)
+				// Without a spec the volume can not be verified, so record
+				// it rather than letting it stay marked attached forever.
+				oe.recordNilVolumeSpec(volumeAttached, node, actualStateOfWorld)
 				continue
 			}
-			volumePlugin, err :=
-				oe.operationGenerator.GetVolumePluginMgr().FindPluginBySpec(volumeAttached.VolumeSpec)
-
-			if err != nil || volumePlugin == nil {
-				glog.Errorf(
-					"VolumesAreAttached.FindPluginBySpec failed for volume %q (spec.Name: %q) on node %q with error: %v",
-					volumeAttached.VolumeName,
-					volumeAttached.VolumeSpec.Name(),
-					volumeAttached.NodeName,
-					err)
-				continue
+			volumePlugin, resolved := volumePluginBySpec[volumeAttached.VolumeSpec]
+			if !resolved {
+				var err error
+				volumePlugin, err =
+					oe.operationGenerator.GetVolumePluginMgr().FindPluginBySpec(volumeAttached.VolumeSpec)
+
+				if err != nil || volumePlugin == nil {
+					glog.Errorf(
+						"VolumesAreAttached.FindPluginBySpec failed for volume %q (spec.Name: %q) on node %q with error: %v",
+						volumeAttached.VolumeName,
+						volumeAttached.VolumeSpec.Name(),
+						volumeAttached.NodeName,
+						err)
+					continue
+				}
+				volumePluginBySpec[volumeAttached.VolumeSpec] = volumePlugin
 			}
 
 			pluginName := volumePlugin.GetPluginName()
@@ -467,13 +1182,32 @@ func (oe *operationExecutor) VerifyVolumesAreAttached(
 		}
 		// Ugly hack to ensure - we don't do parallel bulk polling of same volume plugin
 		uniquePluginName := v1.UniqueVolumeName(pluginName)
-		err = oe.pendingOperations.Run(uniquePluginName, "" /* Pod Name */, bulkVerifyVolumeFunc)
+		err = oe.run("BulkVerifyVolumes", uniquePluginName, "" /* Pod Name */, spanTags{}, bulkVerifyVolumeFunc)
 		if err != nil {
 			glog.Errorf("BulkVerifyVolumes.Run Error bulk volume verification for plugin %q  with %v", pluginName, err)
 		}
 	}
 }
 
+// recordNilVolumeSpec surfaces an attached volume that can not be verified
+// because its spec is nil. If the actual state of world supports it, the
+// volume is marked for rediscovery so that its spec can be repopulated.
+func (oe *operationExecutor) recordNilVolumeSpec(
+	volumeAttached AttachedVolume,
+	nodeName types.NodeName,
+	actualStateOfWorld ActualStateOfWorldAttacherUpdater) {
+	err := NewNilVolumeSpecError(volumeAttached.VolumeName, nodeName)
+	nilVolumeSpecCounter.Inc()
+
+	rediscoverer, ok := actualStateOfWorld.(ActualStateOfWorldRediscoverer)
+	if !ok {
+		glog.Errorf("VerifyVolumesAreAttached skipped verification: %v", err)
+		return
+	}
+	rediscoverer.MarkVolumeForRediscovery(volumeAttached.VolumeName, nodeName)
+	glog.Errorf("VerifyVolumesAreAttached skipped verification, volume marked for rediscovery: %v", err)
+}
+
 func (oe *operationExecutor) VerifyVolumesAreAttachedPerNode(
 	attachedVolumes []AttachedVolume,
 	nodeName types.NodeName,
@@ -483,35 +1217,63 @@ func (oe *operationExecutor) VerifyVolumesAreAttachedPerNode(
 	if err != nil {
 		return err
 	}
+
 	// Give an empty UniqueVolumeName so that this operation could be executed concurrently.
-	return oe.pendingOperations.Run("" /* volumeName */, "" /* podName */, volumesAreAttachedFunc)
+	return oe.run("VerifyVolumesAreAttached", "" /* volumeName */, "" /* podName */, spanTags{nodeName: nodeName}, volumesAreAttachedFunc)
 }
 
 func (oe *operationExecutor) MountVolume(
 	waitForAttachTimeout time.Duration,
 	volumeToMount VolumeToMount,
 	actualStateOfWorld ActualStateOfWorldMounterUpdater) error {
+	if err := oe.checkVolumeNotPaused("MountVolume", volumeToMount.VolumeName); err != nil {
+		return err
+	}
+	uniquePodName := volumehelper.GetUniquePodName(volumeToMount.Pod)
+	if oe.recentMounts != nil && !volumeToMount.Remount && oe.recentMounts.succeededRecently(volumeToMount.VolumeName, uniquePodName) {
+		glog.V(5).Infof("Skipping MountVolume for volume %q (pod %q), it succeeded less than %v ago", volumeToMount.VolumeName, uniquePodName, oe.mountDeduplicationWindow)
+		return nil
+	}
 	mountFunc, err := oe.operationGenerator.GenerateMountVolumeFunc(
 		waitForAttachTimeout, volumeToMount, actualStateOfWorld)
 	if err != nil {
 		return err
 	}
+	mountFunc = measureOperation(oe.clock, oe.operationGenerator.GetVolumePluginMgr(),
+		"MountVolume", volumeToMount.VolumeSpec, mountFunc)
+	if oe.recentMounts != nil {
+		mountFunc = oe.recentMounts.wrap(volumeToMount.VolumeName, uniquePodName, mountFunc)
+	}
 
 	podName := nestedpendingoperations.EmptyUniquePodName
 	// TODO: remove this -- not necessary
-	if !volumeToMount.PluginIsAttachable {
+	if !volumeToMount.PluginIsAttachable && !volumeToMount.PluginRequiresNodeSerializedMount {
 		// Non-attachable volume plugins can execute mount for multiple pods
-		// referencing the same volume in parallel
-		podName = volumehelper.GetUniquePodName(volumeToMount.Pod)
+		// referencing the same volume in parallel, unless they require mounts
+		// to be serialized on the node
+		podName = uniquePodName
+	}
+
+	op := oe.trackOperation("MountVolume", volumeToMount.VolumeName, podName, spanTags{
+		nodeName: types.NodeName(volumeToMount.Pod.Spec.NodeName),
+		podName:  uniquePodName,
+	})
+	// A mount waiting for a slot has not started yet.
+	mountFunc = oe.markStarted(op, mountFunc)
+	if oe.mountSemaphore != nil {
+		mountFunc = oe.limitMountConcurrency(volumeToMount, op.cancelled, mountFunc)
 	}
 
-	return oe.pendingOperations.Run(
-		volumeToMount.VolumeName, podName, mountFunc)
+	return oe.runTracked(
+		op, "MountVolume", volumeToMount.VolumeName, podName, mountFunc)
 }
 
 func (oe *operationExecutor) UnmountVolume(
 	volumeToUnmount MountedVolume,
 	actualStateOfWorld ActualStateOfWorldMounterUpdater) error {
+	if err := oe.checkVolumeNotPaused("UnmountVolume", volumeToUnmount.VolumeName); err != nil {
+		return err
+	}
 
 	unmountFunc, err :=
 		oe.operationGenerator.GenerateUnmountVolumeFunc(volumeToUnmount, actualStateOfWorld)
@@ -522,53 +1284,234 @@ func (oe *operationExecutor) UnmountVolume(
 	// All volume plugins can execute mount for multiple pods referencing the
 	// same volume in parallel
 	podName := volumetypes.UniquePodName(volumeToUnmount.PodUID)
+	if oe.recentMounts != nil {
+		// The volume must be mounted again after it is unmounted.
+		oe.recentMounts.forget(volumeToUnmount.VolumeName, podName)
+	}
 
-	return oe.pendingOperations.Run(
-		volumeToUnmount.VolumeName, podName, unmountFunc)
+	return oe.run(
+		"UnmountVolume", volumeToUnmount.VolumeName, podName, spanTags{podName: podName}, unmountFunc)
 }
 
 func (oe *operationExecutor) UnmountDevice(
 	deviceToDetach AttachedVolume,
 	actualStateOfWorld ActualStateOfWorldMounterUpdater,
 	mounter mount.Interface) error {
+	if err := oe.checkVolumeNotPaused("UnmountDevice", deviceToDetach.VolumeName); err != nil {
+		return err
+	}
+	if oe.deviceUnmountBackoff != nil {
+		if err := oe.deviceUnmountBackoff.safeToRetry("UnmountDevice", deviceToDetach.VolumeName, "" /* podName */); err != nil {
+			return err
+		}
+	}
+
 	unmountDeviceFunc, err :=
 		oe.operationGenerator.GenerateUnmountDeviceFunc(deviceToDetach, actualStateOfWorld, mounter)
 	if err != nil {
 		return err
 	}
+	if oe.deviceUnmountBackoff != nil {
+		unmountDeviceFunc = oe.deviceUnmountBackoff.wrap(deviceToDetach.VolumeName, "" /* podName */, unmountDeviceFunc)
+	}
 
-	return oe.pendingOperations.Run(
-		deviceToDetach.VolumeName, "" /* podName */, unmountDeviceFunc)
+	return oe.run(
+		"UnmountDevice", deviceToDetach.VolumeName, "" /* podName */, spanTags{nodeName: deviceToDetach.NodeName}, unmountDeviceFunc)
 }
 
 func (oe *operationExecutor) VerifyControllerAttachedVolume(
 	volumeToMount VolumeToMount,
 	nodeName types.NodeName,
 	actualStateOfWorld ActualStateOfWorldAttacherUpdater) error {
+	if err := oe.checkVolumeNotPaused("VerifyControllerAttachedVolume", volumeToMount.VolumeName); err != nil {
+		return err
+	}
+	if oe.attachVerificationBackoff != nil {
+		if err := oe.attachVerificationBackoff.safeToRetry("VerifyControllerAttachedVolume", volumeToMount.VolumeName, "" /* podName */); err != nil {
+			return err
+		}
+	}
+
 	verifyControllerAttachedVolumeFunc, err :=
 		oe.operationGenerator.GenerateVerifyControllerAttachedVolumeFunc(volumeToMount, nodeName, actualStateOfWorld)
 	if err != nil {
 		return err
 	}
 
-	return oe.pendingOperations.Run(
-		volumeToMount.VolumeName, "" /* podName */, verifyControllerAttachedVolumeFunc)
+	if oe.attachVerificationBackoff != nil {
+		verifyControllerAttachedVolumeFunc = oe.attachVerificationBackoff.wrap(volumeToMount.VolumeName, "" /* podName */, verifyControllerAttachedVolumeFunc)
+	}
+
+	return oe.run(
+		"VerifyControllerAttachedVolume", volumeToMount.VolumeName, "" /* podName */, spanTags{
+			nodeName: nodeName,
+			podName:  volumehelper.GetUniquePodName(volumeToMount.Pod),
+		}, verifyControllerAttachedVolumeFunc)
 }
 
-// TODO: this is a workaround for the unmount device issue caused by gci mounter.
-// In GCI cluster, if gci mounter is used for mounting, the container started by mounter
-// script will cause additional mounts created in the container. Since these mounts are
-// irrelavant to the original mounts, they should be not considered when checking the
-// mount references. Current solution is to filter out those mount paths that contain
-// the string of original mount path.
-// Plan to work on better approach to solve this issue.
+// podVolume identifies a volume mounted, or to be mounted, to a pod.
+type podVolume struct {
+	podName    volumetypes.UniquePodName
+	volumeName v1.UniqueVolumeName
+}
+
+// ReconcileCheck compares the volumes that should be mounted to pods with the
+// volumes that are mounted to pods and returns the volumes that need to be
+// mounted and the volumes that need to be unmounted to bring the actual state
+// in line with the desired state. Volumes are matched by pod and volume name
+// and the results preserve the order of the input, so the result is
+// deterministic for a given input.
+func ReconcileCheck(
+	desired []VolumeToMount,
+	actualMounted []MountedVolume) (toMount []VolumeToMount, toUnmount []MountedVolume) {
+	return reconcileCheck(desired, actualMounted, nil /* mounter */)
+}
+
+// ReconcileCheckVerifyingMounts is ReconcileCheck, except that it does not
+// trust the actual state of world blindly: a volume it reports as mounted,
+// e.g. because the mount disappeared while kubelet was down, is mounted again
+// if mounter does not find its path. Only missing paths are mounted again,
+// since the paths of volumes such as emptyDir, hostPath, configMap or secret
+// are never mount points. This costs a path lookup per mounted volume, so
+// reconcilers only use it if verification is enabled.
+func ReconcileCheckVerifyingMounts(
+	desired []VolumeToMount,
+	actualMounted []MountedVolume,
+	mounter mount.Interface) (toMount []VolumeToMount, toUnmount []MountedVolume) {
+	return reconcileCheck(desired, actualMounted, mounter)
+}
+
+// reconcileCheck implements ReconcileCheck, verifying the paths of the
+// mounted volumes with mounter if it is not nil.
+func reconcileCheck(
+	desired []VolumeToMount,
+	actualMounted []MountedVolume,
+	mounter mount.Interface) (toMount []VolumeToMount, toUnmount []MountedVolume) {
+	mounted := make(map[podVolume]bool, len(actualMounted))
+	for _, mountedVolume := range actualMounted {
+		if mounter != nil && !isMountPathPresent(mountedVolume, mounter) {
+			continue
+		}
+		mounted[podVolume{mountedVolume.PodName, mountedVolume.VolumeName}] = true
+	}
 
-func hasMountRefs(mountPath string, mountRefs []string) bool {
-	count := 0
-	for _, ref := range mountRefs {
-		if !strings.Contains(ref, mountPath) {
-			count = count + 1
+	wanted := make(map[podVolume]bool, len(desired))
+	for _, volumeToMount := range desired {
+		key := podVolume{volumeToMount.PodName, volumeToMount.VolumeName}
+		if wanted[key] {
+			continue
+		}
+		wanted[key] = true
+		if !mounted[key] {
+			toMount = append(toMount, volumeToMount)
+		}
+	}
+
+	for _, mountedVolume := range actualMounted {
+		if !wanted[podVolume{mountedVolume.PodName, mountedVolume.VolumeName}] {
+			toUnmount = append(toUnmount, mountedVolume)
+		}
+	}
+
+	return toMount, toUnmount
+}
+
+// nodeVolume identifies a volume attached, or to be attached, to a node.
+type nodeVolume struct {
+	nodeName   types.NodeName
+	volumeName v1.UniqueVolumeName
+}
+
+// DiffAttachedVolumes compares the volumes that should be attached to nodes
+// with the volumes that are attached to nodes and returns the volumes that
+// need to be attached and the volumes that need to be detached to bring the
+// actual state in line with the desired state. Volumes are matched by node
+// and volume name and, like for ReconcileCheck, the results preserve the
+// order of the input.
+func DiffAttachedVolumes(
+	desired []AttachedVolume,
+	actual []AttachedVolume) (toAttach []AttachedVolume, toDetach []AttachedVolume) {
+	attached := make(map[nodeVolume]bool, len(actual))
+	for _, attachedVolume := range actual {
+		attached[nodeVolume{attachedVolume.NodeName, attachedVolume.VolumeName}] = true
+	}
+
+	wanted := make(map[nodeVolume]bool, len(desired))
+	for _, volumeToAttach := range desired {
+		key := nodeVolume{volumeToAttach.NodeName, volumeToAttach.VolumeName}
+		if wanted[key] {
+			continue
+		}
+		wanted[key] = true
+		if !attached[key] {
+			toAttach = append(toAttach, volumeToAttach)
+		}
+	}
+
+	detaching := make(map[nodeVolume]bool)
+	for _, attachedVolume := range actual {
+		key := nodeVolume{attachedVolume.NodeName, attachedVolume.VolumeName}
+		if !wanted[key] && !detaching[key] {
+			detaching[key] = true
+			toDetach = append(toDetach, attachedVolume)
+		}
+	}
+
+	return toAttach, toDetach
+}
+
+// isMountPathPresent returns false if mounter is sure that the path of
+// mountedVolume does not exist. A path that exists but is not a mount point
+// is present, since volumes of plugins that do not mount anything are never
+// mount points. If it can not tell, the volume is assumed to be mounted, as
+// the actual state of world says.
+func isMountPathPresent(mountedVolume MountedVolume, mounter mount.Interface) bool {
+	if mountedVolume.Mounter == nil {
+		return true
+	}
+	path := mountedVolume.Mounter.GetPath()
+	_, err := mounter.IsLikelyNotMountPoint(path)
+	if os.IsNotExist(err) {
+		glog.Warningf("Volume %q (pod %q) is mounted in the actual state of world, but its path %q is missing", mountedVolume.VolumeName, mountedVolume.PodName, path)
+		return false
+	}
+	if err != nil {
+		glog.Warningf("Could not verify path %q of volume %q (pod %q), assuming it is mounted: %v", path, mountedVolume.VolumeName, mountedVolume.PodName, err)
+	}
+	return true
+}
+
+// limitMountConcurrency returns a function that runs mountFunc once it
+// acquired a slot of the mount semaphore. If the mountSlotTimeout is greater
+// than zero and no slot becomes free within it, the mount fails without running mountFunc
+// and a FailedMountVolume event is recorded for the pod. The mount also fails
+// if cancelled is closed while it waits.
+func (oe *operationExecutor) limitMountConcurrency(
+	volumeToMount VolumeToMount,
+	cancelled <-chan struct{},
+	mountFunc func() error) func() error {
+	return func() error {
+		var timedOut <-chan time.Time
+		if oe.mountSlotTimeout > 0 {
+			timedOut = oe.clock.After(oe.mountSlotTimeout)
+		}
+		select {
+		case oe.mountSemaphore <- struct{}{}:
+		case <-cancelled:
+			return newOperationCancelledError("MountVolume", volumeToMount.VolumeName)
+		case <-timedOut:
+			err := fmt.Errorf(
+				"MountVolume for volume %q (spec.Name: %q) pod %q (UID: %q) timed out after %v waiting for one of %d concurrent mounts to complete",
+				volumeToMount.VolumeName,
+				volumeToMount.OuterVolumeSpecName,
+				volumeToMount.PodName,
+				volumeToMount.Pod.UID,
+				oe.mountSlotTimeout,
+				cap(oe.mountSemaphore))
+			oe.recorder.Eventf(volumeToMount.Pod, v1.EventTypeWarning, kevents.FailedMountVolume, err.Error())
+			return err
 		}
+		defer func() { <-oe.mountSemaphore }()
+		return mountFunc()
 	}
-	return count > 0
 }
@@ -17,16 +17,31 @@ limitations under the License.
 package operationexecutor
 
 import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/clock"
 	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/api/v1"
+	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/util/goroutinemap/exponentialbackoff"
 	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/util/mount"
 	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/volume"
+	volumetesting "github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/volume/testing"
 	volumetypes "github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/volume/util/types"
 )
 
@@ -69,6 +84,34 @@ func TestOperationExecutor_MountVolume_ConcurrentMountForNonAttachablePlugins(t
 	}
 }
 
+func TestOperationExecutor_MountVolume_SerialMountForNodeSerializedPlugins(t *testing.T) {
+	// Arrange
+	ch, quit, oe := setup()
+	plugin := &fakeNodeSerializedMountPlugin{FakeVolumePlugin: &volumetesting.FakeVolumePlugin{PluginName: "fake-inline-plugin"}}
+	volumesToMount := make([]VolumeToMount, numVolumesToMount)
+	secretName := "secret-volume"
+	volumeName := v1.UniqueVolumeName(secretName)
+
+	// Act
+	for i := range volumesToMount {
+		podName := "pod-" + strconv.Itoa((i + 1))
+		pod := getTestPodWithSecret(podName, secretName)
+		volumesToMount[i] = VolumeToMount{
+			Pod:                               pod,
+			VolumeName:                        volumeName,
+			PluginIsAttachable:                false,
+			PluginRequiresNodeSerializedMount: PluginRequiresNodeSerializedMount(plugin),
+			ReportedInUse:                     true,
+		}
+		oe.MountVolume(0 /* waitForAttachTimeOut */, volumesToMount[i], nil /* actualStateOfWorldMounterUpdater */)
+	}
+
+	// Assert
+	if !isOperationRunSerially(ch, quit) {
+		t.Fatalf("Mount operations should not start concurrently for plugins requiring node serialized mounts")
+	}
+}
+
 func TestOperationExecutor_MountVolume_ConcurrentMountForAttachablePlugins(t *testing.T) {
 	// Arrange
 	ch, quit, oe := setup()
@@ -150,6 +193,392 @@ func TestOperationExecutor_UnmountDeviceConcurrently(t *testing.T) {
 	}
 }
 
+func TestOperationExecutor_MountVolume_MaxConcurrentMounts(t *testing.T) {
+	// Arrange
+	maxConcurrentMounts := 2
+	numMounts := 5
+	numAttaches := 3
+	ch, quit := make(chan interface{}), make(chan interface{})
+	oe := NewOperationExecutor(newFakeOperationGenerator(ch, quit), WithMaxConcurrentMounts(maxConcurrentMounts))
+	secretName := "secret-volume"
+
+	// Act
+	for i := 0; i < numMounts; i++ {
+		podName := "pod-" + strconv.Itoa((i + 1))
+		volumeToMount := VolumeToMount{
+			Pod:                getTestPodWithSecret(podName, secretName),
+			VolumeName:         v1.UniqueVolumeName(secretName),
+			PluginIsAttachable: false,
+			ReportedInUse:      true,
+		}
+		oe.MountVolume(0 /* waitForAttachTimeOut */, volumeToMount, nil /* actualStateOfWorldMounterUpdater */)
+	}
+	for i := 0; i < numAttaches; i++ {
+		volumeToAttach := VolumeToAttach{
+			VolumeName: v1.UniqueVolumeName("pd-volume-" + strconv.Itoa(i)),
+			NodeName:   "node",
+		}
+		oe.AttachVolume(volumeToAttach, nil /* actualStateOfWorldAttacherUpdater */)
+	}
+
+	// Assert
+	if started := numOperationsStarted(ch, quit); started != maxConcurrentMounts+numAttaches {
+		t.Fatalf("expected %d mounts and %d attaches to run concurrently, got %d operations", maxConcurrentMounts, numAttaches, started)
+	}
+}
+
+func TestOperationExecutor_MountVolume_TimesOutWaitingForConcurrentMounts(t *testing.T) {
+	// Arrange
+	ch, quit := make(chan interface{}), make(chan interface{})
+	defer close(quit)
+	fakeClock := clock.NewFakeClock(time.Now())
+	recorder := &fakeEventRecorder{}
+	oe := NewOperationExecutor(
+		newFakeOperationGenerator(ch, quit),
+		WithMaxConcurrentMounts(1),
+		WithMountSlotTimeout(time.Minute),
+		WithClock(fakeClock),
+		WithEventRecorder(recorder))
+	volumesToMount := make([]VolumeToMount, 2)
+	for i := range volumesToMount {
+		pdName := "pd-volume-" + strconv.Itoa(i)
+		volumesToMount[i] = VolumeToMount{
+			Pod:                getTestPodWithGCEPD("pod-"+strconv.Itoa(i), pdName),
+			VolumeName:         v1.UniqueVolumeName(pdName),
+			PluginIsAttachable: true,
+			ReportedInUse:      true,
+		}
+	}
+
+	// Act: the second mount waits for the first one, which blocks
+	oe.MountVolume(0 /* waitForAttachTimeOut */, volumesToMount[0], nil /* actualStateOfWorldMounterUpdater */)
+	<-ch
+	oe.MountVolume(0 /* waitForAttachTimeOut */, volumesToMount[1], nil /* actualStateOfWorldMounterUpdater */)
+	err := wait.Poll(10*time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
+		return fakeClock.HasWaiters(), nil
+	})
+	if err != nil {
+		t.Fatalf("expected the second mount to wait for a concurrent mount slot: %v", err)
+	}
+	fakeClock.Step(time.Minute)
+
+	// Assert
+	waitForOperationToComplete(t, oe, volumesToMount[1].VolumeName, "" /* podName */)
+	if !oe.IsOperationPending(volumesToMount[0].VolumeName, "" /* podName */) {
+		t.Errorf("expected the first mount to still be running")
+	}
+	if events := recorder.getEvents(); len(events) != 1 || !strings.Contains(events[0], "timed out") {
+		t.Errorf("expected one mount timeout event, got %v", events)
+	}
+}
+
+func TestOperationExecutor_DrainOperationsForPlugin(t *testing.T) {
+	// Arrange
+	ch, quit := make(chan interface{}), make(chan interface{})
+	defer close(quit)
+	oe := NewOperationExecutor(newFakeOperationGenerator(ch, quit), WithMaxConcurrentMounts(1))
+	newVolumeToMount := func(volumeName v1.UniqueVolumeName) VolumeToMount {
+		return VolumeToMount{
+			Pod:                getTestPodWithGCEPD("pod-"+string(uuid.NewUUID()), "pd-volume"),
+			VolumeName:         volumeName,
+			PluginIsAttachable: true,
+			ReportedInUse:      true,
+		}
+	}
+	runningMount := newVolumeToMount("kubernetes.io/other-plugin/running-volume")
+	reloadedMount := newVolumeToMount("kubernetes.io/reloaded-plugin/volume")
+	otherMount := newVolumeToMount("kubernetes.io/other-plugin/waiting-volume")
+	// The name of this plugin starts with the one of the reloaded plugin.
+	nestedMount := newVolumeToMount("kubernetes.io/reloaded-plugin/v2/volume")
+
+	// Act: one mount runs, the others wait for it
+	oe.MountVolume(0 /* waitForAttachTimeOut */, runningMount, nil /* actualStateOfWorldMounterUpdater */)
+	<-ch
+	oe.MountVolume(0 /* waitForAttachTimeOut */, reloadedMount, nil /* actualStateOfWorldMounterUpdater */)
+	oe.MountVolume(0 /* waitForAttachTimeOut */, otherMount, nil /* actualStateOfWorldMounterUpdater */)
+	oe.MountVolume(0 /* waitForAttachTimeOut */, nestedMount, nil /* actualStateOfWorldMounterUpdater */)
+	oe.DrainOperationsForPlugin("kubernetes.io/reloaded-plugin")
+
+	// Assert
+	waitForOperationToComplete(t, oe, reloadedMount.VolumeName, "" /* podName */)
+	if !oe.IsOperationPending(runningMount.VolumeName, "" /* podName */) {
+		t.Errorf("expected the running mount of another plugin to remain pending")
+	}
+	if !oe.IsOperationPending(otherMount.VolumeName, "" /* podName */) {
+		t.Errorf("expected the waiting mount of another plugin to remain pending")
+	}
+	if !oe.IsOperationPending(nestedMount.VolumeName, "" /* podName */) {
+		t.Errorf("expected the waiting mount of a plugin sharing the name prefix to remain pending")
+	}
+}
+
+func TestOperationExecutor_DrainOperationsForPlugin_RegeneratesWithoutBackoff(t *testing.T) {
+	// Arrange
+	ch, quit := make(chan interface{}), make(chan interface{})
+	oe := NewOperationExecutor(newFakeOperationGenerator(ch, quit), WithMaxConcurrentMounts(1))
+	runningMount := VolumeToMount{
+		Pod:                getTestPodWithGCEPD("pod1", "pd-volume"),
+		VolumeName:         "kubernetes.io/other-plugin/running-volume",
+		PluginIsAttachable: true,
+	}
+	reloadedMount := VolumeToMount{
+		Pod:                getTestPodWithGCEPD("pod2", "pd-volume"),
+		VolumeName:         "kubernetes.io/reloaded-plugin/volume",
+		PluginIsAttachable: true,
+	}
+	oe.MountVolume(0 /* waitForAttachTimeOut */, runningMount, nil /* actualStateOfWorldMounterUpdater */)
+	<-ch
+	oe.MountVolume(0 /* waitForAttachTimeOut */, reloadedMount, nil /* actualStateOfWorldMounterUpdater */)
+
+	// Act
+	oe.DrainOperationsForPlugin("kubernetes.io/reloaded-plugin")
+
+	// Assert: the cancelled mount is regenerated as soon as it is forgotten
+	err := wait.Poll(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		err := oe.MountVolume(0 /* waitForAttachTimeOut */, reloadedMount, nil /* actualStateOfWorldMounterUpdater */)
+		if exponentialbackoff.IsExponentialBackoff(err) {
+			return false, err
+		}
+		return err == nil, nil
+	})
+	if err != nil {
+		t.Errorf("expected the cancelled mount to be regenerated without backoff, got %v", err)
+	}
+	close(quit)
+	waitForOperationToStart(t, ch)
+}
+
+func TestOperationExecutor_PauseVolume(t *testing.T) {
+	// Arrange
+	ch, quit := make(chan interface{}), make(chan interface{})
+	oe := NewOperationExecutor(newFakeOperationGenerator(ch, quit))
+	pausedVolume := AttachedVolume{VolumeName: "pd-volume-paused", NodeName: "node"}
+	otherVolume := AttachedVolume{VolumeName: "pd-volume-other", NodeName: "node"}
+	oe.PauseVolume(pausedVolume.VolumeName)
+
+	// Act
+	pausedErr := oe.DetachVolume(pausedVolume, false /* verifySafeToDetach */, nil /* actualStateOfWorld */)
+	otherErr := oe.DetachVolume(otherVolume, false /* verifySafeToDetach */, nil /* actualStateOfWorld */)
+
+	// Assert
+	if !IsVolumePausedError(pausedErr) {
+		t.Errorf("expected DetachVolume of the paused volume to be skipped, got %v", pausedErr)
+	}
+	if oe.IsOperationPending(pausedVolume.VolumeName, "" /* podName */) {
+		t.Errorf("expected no pending operation for the paused volume")
+	}
+	if otherErr != nil {
+		t.Errorf("expected DetachVolume of another volume to proceed, got %v", otherErr)
+	}
+	oe.ResumeVolume(pausedVolume.VolumeName)
+	if err := oe.DetachVolume(pausedVolume, false /* verifySafeToDetach */, nil /* actualStateOfWorld */); err != nil {
+		t.Errorf("expected DetachVolume of the resumed volume to proceed, got %v", err)
+	}
+	if started := numOperationsStarted(ch, quit); started != 2 {
+		t.Errorf("expected 2 detach operations to run, got %d", started)
+	}
+}
+
+func TestOperationExecutor_PauseVolume_KeepsDeduplicationState(t *testing.T) {
+	// Arrange
+	generator := newFakeOperationGenerator(nil /* ch */, nil /* quit */)
+	generator.setErr("MountVolume", nil)
+	oe := NewOperationExecutor(generator, WithMountDeduplicationWindow(time.Hour))
+	pod := getTestPodWithGCEPD("pod1", "pd-volume")
+	volumeToMount := VolumeToMount{Pod: pod, VolumeName: v1.UniqueVolumeName("pd-volume"), PluginIsAttachable: true}
+	volumeToUnmount := MountedVolume{PodUID: pod.UID, VolumeName: volumeToMount.VolumeName}
+	if err := oe.MountVolume(0 /* waitForAttachTimeOut */, volumeToMount, nil /* actualStateOfWorldMounterUpdater */); err != nil {
+		t.Fatalf("MountVolume failed: %v", err)
+	}
+	waitForOperationToComplete(t, oe, volumeToMount.VolumeName, "" /* podName */)
+
+	// Act
+	oe.PauseVolume(volumeToMount.VolumeName)
+	unmountErr := oe.UnmountVolume(volumeToUnmount, nil /* actualStateOfWorld */)
+	oe.ResumeVolume(volumeToMount.VolumeName)
+	mountErr := oe.MountVolume(0 /* waitForAttachTimeOut */, volumeToMount, nil /* actualStateOfWorldMounterUpdater */)
+
+	// Assert
+	if !IsVolumePausedError(unmountErr) {
+		t.Errorf("expected UnmountVolume of the paused volume to be skipped, got %v", unmountErr)
+	}
+	if mountErr != nil {
+		t.Errorf("MountVolume failed: %v", mountErr)
+	}
+	if calls := generator.runCount("MountVolume"); calls != 1 {
+		t.Errorf("expected the skipped unmount to keep the recent mount, got %d mounts", calls)
+	}
+}
+
+func TestOperationExecutor_WaitForOperation(t *testing.T) {
+	// Arrange
+	ch, quit, oe := setup()
+	volumeName := v1.UniqueVolumeName("pd-volume")
+	if err := oe.WaitForOperation(context.Background(), volumeName, "" /* podName */); err != nil {
+		t.Fatalf("expected WaitForOperation to return without a pending operation, got %v", err)
+	}
+	if err := oe.DetachVolume(AttachedVolume{VolumeName: volumeName, NodeName: "node"}, false /* verifySafeToDetach */, nil /* actualStateOfWorld */); err != nil {
+		t.Fatalf("DetachVolume failed: %v", err)
+	}
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the detach operation to start")
+	}
+
+	// Act & Assert: waiting for the blocked operation times out
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := oe.WaitForOperation(ctx, volumeName, "" /* podName */); err != context.DeadlineExceeded {
+		t.Errorf("expected WaitForOperation to return when ctx is done, got %v", err)
+	}
+
+	// Act & Assert: waiting returns promptly once the operation completes
+	close(quit)
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := oe.WaitForOperation(ctx, volumeName, "" /* podName */); err != nil {
+		t.Fatalf("expected WaitForOperation to return after the operation completed, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected WaitForOperation to return promptly, took %v", elapsed)
+	}
+	if oe.IsOperationPending(volumeName, "" /* podName */) {
+		t.Errorf("expected no pending operation after WaitForOperation returned")
+	}
+}
+
+func TestOperationExecutor_WaitForOperation_AllowsReissue(t *testing.T) {
+	// Arrange
+	generator := newFakeOperationGenerator(nil /* ch */, nil /* quit */)
+	generator.setErr("DetachVolume", nil)
+	oe := NewOperationExecutor(generator)
+	volumeToDetach := AttachedVolume{VolumeName: "pd-volume", NodeName: "node"}
+
+	for i := 0; i < 100; i++ {
+		// Act
+		if err := oe.DetachVolume(volumeToDetach, false /* verifySafeToDetach */, nil /* actualStateOfWorld */); err != nil {
+			t.Fatalf("DetachVolume %d failed: %v", i, err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := oe.WaitForOperation(ctx, volumeToDetach.VolumeName, "" /* podName */)
+		cancel()
+
+		// Assert: the next DetachVolume is not rejected as already pending
+		if err != nil {
+			t.Fatalf("expected WaitForOperation to return after DetachVolume %d completed, got %v", i, err)
+		}
+		if oe.IsOperationPending(volumeToDetach.VolumeName, "" /* podName */) {
+			t.Fatalf("expected no pending operation after WaitForOperation returned")
+		}
+	}
+}
+
+func TestOperationExecutor_LastError(t *testing.T) {
+	// Arrange
+	generator := newFakeOperationGenerator(nil /* ch */, nil /* quit */)
+	oe := NewOperationExecutor(generator, WithRetryPolicy(&giveUpAfterRetryPolicy{maxAttempts: 10}))
+	volumeToDetach := AttachedVolume{VolumeName: "pd-volume", NodeName: "node"}
+	detachVolume := func() {
+		if err := oe.DetachVolume(volumeToDetach, false /* verifySafeToDetach */, nil /* actualStateOfWorld */); err != nil {
+			t.Fatalf("DetachVolume failed: %v", err)
+		}
+		waitForOperationToComplete(t, oe, volumeToDetach.VolumeName, "" /* podName */)
+	}
+	if err := oe.LastError(volumeToDetach.VolumeName, "" /* podName */); err != nil {
+		t.Errorf("expected no last error before any operation ran, got %v", err)
+	}
+
+	// Act & Assert: a failure populates the last error
+	detachErr := fmt.Errorf("detach failed")
+	generator.setErr("DetachVolume", detachErr)
+	detachVolume()
+	if err := oe.LastError(volumeToDetach.VolumeName, "" /* podName */); err != detachErr {
+		t.Errorf("expected the last error to be %v, got %v", detachErr, err)
+	}
+	if err := oe.LastError("other-volume", "" /* podName */); err != nil {
+		t.Errorf("expected no last error for another volume, got %v", err)
+	}
+
+	// Act & Assert: a success clears it
+	generator.setErr("DetachVolume", nil)
+	detachVolume()
+	if err := oe.LastError(volumeToDetach.VolumeName, "" /* podName */); err != nil {
+		t.Errorf("expected the last error to be cleared by a success, got %v", err)
+	}
+}
+
+func TestOperationExecutor_MountVolume_SkipsReissueWithinDeduplicationWindow(t *testing.T) {
+	// Arrange
+	generator := newFakeOperationGenerator(nil /* ch */, nil /* quit */)
+	generator.setErr("MountVolume", nil)
+	fakeClock := clock.NewFakeClock(time.Now())
+	oe := NewOperationExecutor(
+		generator,
+		WithClock(fakeClock),
+		WithMountDeduplicationWindow(time.Second))
+	volumeToMount := VolumeToMount{
+		Pod:                getTestPodWithGCEPD("pod1", "pd-volume"),
+		VolumeName:         v1.UniqueVolumeName("pd-volume"),
+		PluginIsAttachable: true,
+		ReportedInUse:      true,
+	}
+	mountVolume := func() {
+		if err := oe.MountVolume(0 /* waitForAttachTimeOut */, volumeToMount, nil /* actualStateOfWorldMounterUpdater */); err != nil {
+			t.Fatalf("MountVolume failed: %v", err)
+		}
+		waitForOperationToComplete(t, oe, volumeToMount.VolumeName, "" /* podName */)
+	}
+
+	// Act & Assert: the mount is skipped when reissued within the window
+	mountVolume()
+	mountVolume()
+	if calls := generator.runCount("MountVolume"); calls != 1 {
+		t.Errorf("expected the reissued mount within the window to be skipped, got %d mounts", calls)
+	}
+
+	// Act & Assert: the mount runs again after the window
+	fakeClock.Step(time.Second)
+	mountVolume()
+	if calls := generator.runCount("MountVolume"); calls != 2 {
+		t.Errorf("expected the reissued mount after the window to run, got %d mounts", calls)
+	}
+}
+
+func TestOperationExecutor_MountVolume_DoesNotSkipRemountWithinDeduplicationWindow(t *testing.T) {
+	// Arrange
+	generator := newFakeOperationGenerator(nil /* ch */, nil /* quit */)
+	generator.setErr("MountVolume", nil)
+	oe := NewOperationExecutor(
+		generator,
+		WithClock(clock.NewFakeClock(time.Now())),
+		WithMountDeduplicationWindow(time.Second))
+	volumeToMount := VolumeToMount{
+		Pod:                getTestPodWithGCEPD("pod1", "pd-volume"),
+		VolumeName:         v1.UniqueVolumeName("pd-volume"),
+		PluginIsAttachable: true,
+		ReportedInUse:      true,
+	}
+	mountVolume := func(volumeToMount VolumeToMount) {
+		if err := oe.MountVolume(0 /* waitForAttachTimeOut */, volumeToMount, nil /* actualStateOfWorldMounterUpdater */); err != nil {
+			t.Fatalf("MountVolume failed: %v", err)
+		}
+		waitForOperationToComplete(t, oe, volumeToMount.VolumeName, "" /* podName */)
+	}
+	mountVolume(volumeToMount)
+
+	// Act
+	remount := volumeToMount
+	remount.Remount = true
+	mountVolume(remount)
+
+	// Assert
+	if calls := generator.runCount("MountVolume"); calls != 2 {
+		t.Errorf("expected the remount within the window to run, got %d mounts", calls)
+	}
+}
+
 func TestOperationExecutor_AttachVolumeConcurrently(t *testing.T) {
 	// Arrange
 	ch, quit, oe := setup()
@@ -227,59 +656,269 @@ func TestOperationExecutor_VerifyControllerAttachedVolumeConcurrently(t *testing
 	}
 }
 
+func TestOperationExecutor_VerifyVolumesAreAttached_NilVolumeSpec(t *testing.T) {
+	// Arrange
+	_, quit, oe := setup()
+	defer close(quit)
+	nodeName := types.NodeName("node-name")
+	volumeName := v1.UniqueVolumeName("pd-volume")
+	attachedVolumes := map[types.NodeName][]AttachedVolume{
+		nodeName: {{VolumeName: volumeName, NodeName: nodeName}},
+	}
+	asw := newFakeAttacherActualStateOfWorld()
+	countBefore := getCounterValue(t, nilVolumeSpecCounter)
+
+	// Act
+	oe.VerifyVolumesAreAttached(attachedVolumes, asw)
+
+	// Assert
+	if count := getCounterValue(t, nilVolumeSpecCounter) - countBefore; count != 1 {
+		t.Errorf("Expected nil volume spec counter to be incremented once, got %v", count)
+	}
+	if !asw.volumesToRediscover[volumeName] {
+		t.Errorf("Expected volume %q with nil spec to be marked for rediscovery", volumeName)
+	}
+	if asw.volumesDetached[volumeName] {
+		t.Errorf("Volume %q with nil spec should not be marked as detached", volumeName)
+	}
+}
+
+func TestIsNilVolumeSpecError(t *testing.T) {
+	err := NewNilVolumeSpecError("pd-volume", "node-name")
+	if !IsNilVolumeSpecError(err) {
+		t.Errorf("Expected %v to be a nil volume spec error", err)
+	}
+	if IsNilVolumeSpecError(fmt.Errorf("some other error")) {
+		t.Errorf("Expected other errors not to be nil volume spec errors")
+	}
+}
+
+func TestOperationExecutor_VerifyVolumesAreAttached_ResolvesEachSpecOnce(t *testing.T) {
+	// Arrange
+	plugins := newFakeBulkVerifyPlugins(3)
+	oe := NewOperationExecutor(newVerifyAttachedOperationGenerator(t, plugins))
+	attachedVolumes := newAttachedVolumesOnNodes(plugins, 1 /* volumesPerPlugin */, 2 /* nodes */, true /* shareSpecs */)
+
+	// Act
+	oe.VerifyVolumesAreAttached(attachedVolumes, newFakeAttacherActualStateOfWorld())
+
+	// Assert
+	for _, plugin := range plugins {
+		// Every plugin is asked once whether it supports each of the specs.
+		if calls := plugin.getCanSupportCalls(); calls != len(plugins) {
+			t.Errorf("Expected plugin %q to be asked about %d specs, got %d lookups", plugin.PluginName, len(plugins), calls)
+		}
+	}
+}
+
+const (
+	benchmarkAttachedVolumes = 500
+	benchmarkAttachPlugins   = 3
+	benchmarkAttachNodes     = 3
+)
+
+// BenchmarkVerifyVolumesAreAttached_DistinctSpecs is the baseline for
+// BenchmarkVerifyVolumesAreAttached_SharedSpecs: every node has its own specs,
+// so the plugin of every attached volume is resolved, as it was before the
+// plugins were remembered per spec.
+func BenchmarkVerifyVolumesAreAttached_DistinctSpecs(b *testing.B) {
+	benchmarkVerifyVolumesAreAttached(b, false /* shareSpecs */)
+}
+
+func BenchmarkVerifyVolumesAreAttached_SharedSpecs(b *testing.B) {
+	benchmarkVerifyVolumesAreAttached(b, true /* shareSpecs */)
+}
+
+func benchmarkVerifyVolumesAreAttached(b *testing.B, shareSpecs bool) {
+	plugins := newFakeBulkVerifyPlugins(benchmarkAttachPlugins)
+	oe := NewOperationExecutor(newVerifyAttachedOperationGenerator(b, plugins))
+	attachedVolumes := newAttachedVolumesOnNodes(plugins, benchmarkAttachedVolumes/benchmarkAttachPlugins, benchmarkAttachNodes, shareSpecs)
+	asw := newFakeAttacherActualStateOfWorld()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		oe.VerifyVolumesAreAttached(attachedVolumes, asw)
+	}
+}
+
+// newAttachedVolumesOnNodes returns volumesPerPlugin volumes of each of the
+// plugins, each attached to all of the nodes. If shareSpecs is true, a volume
+// has the same spec on all nodes, otherwise a copy of it on each node.
+func newAttachedVolumesOnNodes(plugins []*fakeBulkVerifyPlugin, volumesPerPlugin, nodes int, shareSpecs bool) map[types.NodeName][]AttachedVolume {
+	newSpecs := func() []*volume.Spec {
+		var specs []*volume.Spec
+		for _, plugin := range plugins {
+			for i := 0; i < volumesPerPlugin; i++ {
+				specs = append(specs, &volume.Spec{Volume: &v1.Volume{Name: fmt.Sprintf("%s-volume%d", plugin.PluginName, i)}})
+			}
+		}
+		return specs
+	}
+	specs := newSpecs()
+	attachedVolumes := make(map[types.NodeName][]AttachedVolume, nodes)
+	for i := 0; i < nodes; i++ {
+		nodeName := types.NodeName(fmt.Sprintf("node%d", i))
+		if i > 0 && !shareSpecs {
+			specs = newSpecs()
+		}
+		for _, spec := range specs {
+			attachedVolumes[nodeName] = append(attachedVolumes[nodeName], AttachedVolume{
+				VolumeName: v1.UniqueVolumeName(spec.Name()),
+				VolumeSpec: spec,
+				NodeName:   nodeName,
+			})
+		}
+	}
+	return attachedVolumes
+}
+
+// fakeBulkVerifyPlugin supports bulk volume verification of the specs whose
+// names start with its plugin name and counts how often it is asked whether
+// it supports a spec.
+type fakeBulkVerifyPlugin struct {
+	*volumetesting.FakeVolumePlugin
+
+	lock            sync.Mutex
+	canSupportCalls int
+}
+
+func newFakeBulkVerifyPlugins(count int) []*fakeBulkVerifyPlugin {
+	plugins := make([]*fakeBulkVerifyPlugin, 0, count)
+	for i := 0; i < count; i++ {
+		plugins = append(plugins, &fakeBulkVerifyPlugin{
+			FakeVolumePlugin: &volumetesting.FakeVolumePlugin{PluginName: fmt.Sprintf("fake-plugin-%d", i)},
+		})
+	}
+	return plugins
+}
+
+func (plugin *fakeBulkVerifyPlugin) CanSupport(spec *volume.Spec) bool {
+	plugin.lock.Lock()
+	defer plugin.lock.Unlock()
+	plugin.canSupportCalls++
+	return strings.HasPrefix(spec.Name(), plugin.PluginName+"-")
+}
+
+func (plugin *fakeBulkVerifyPlugin) SupportsBulkVolumeVerification() bool {
+	return true
+}
+
+func (plugin *fakeBulkVerifyPlugin) getCanSupportCalls() int {
+	plugin.lock.Lock()
+	defer plugin.lock.Unlock()
+	return plugin.canSupportCalls
+}
+
+// newVerifyAttachedOperationGenerator returns a fakeOperationGenerator that
+// resolves plugins with a plugin manager of the given plugins and whose
+// verification operations succeed right away.
+func newVerifyAttachedOperationGenerator(tb testing.TB, plugins []*fakeBulkVerifyPlugin) *fakeOperationGenerator {
+	volumePlugins := make([]volume.VolumePlugin, 0, len(plugins))
+	for _, plugin := range plugins {
+		volumePlugins = append(volumePlugins, plugin)
+	}
+	generator := newFakeOperationGenerator(nil /* ch */, nil /* quit */)
+	generator.volumePluginMgr = &volume.VolumePluginMgr{}
+	if err := generator.volumePluginMgr.InitPlugins(volumePlugins, nil /* host */); err != nil {
+		tb.Fatalf("Failed to initialize volume plugins: %v", err)
+	}
+	generator.setErr("VerifyVolumesAreAttached", nil)
+	generator.setErr("BulkVerifyVolumes", nil)
+	return generator
+}
+
+// fakeOperationGenerator generates operations that block in
+// startOperationAndBlock, unless the operations of their type were programmed
+// with setErr to return an error, or nil, right away. It counts how many
+// operations of each type it generated and ran. Operation types are named
+// after the OperationExecutor methods running them, e.g. "DetachVolume".
 type fakeOperationGenerator struct {
 	ch   chan interface{}
 	quit chan interface{}
+
+	// volumePluginMgr is returned by GetVolumePluginMgr.
+	volumePluginMgr *volume.VolumePluginMgr
+
+	lock      sync.Mutex
+	errs      map[string]error
+	generated map[string]int
+	ran       map[string]int
 }
 
-func newFakeOperationGenerator(ch chan interface{}, quit chan interface{}) OperationGenerator {
+func newFakeOperationGenerator(ch chan interface{}, quit chan interface{}) *fakeOperationGenerator {
 	return &fakeOperationGenerator{
-		ch:   ch,
-		quit: quit,
+		ch:        ch,
+		quit:      quit,
+		errs:      make(map[string]error),
+		generated: make(map[string]int),
+		ran:       make(map[string]int),
 	}
 }
 
-func (fopg *fakeOperationGenerator) GenerateMountVolumeFunc(waitForAttachTimeout time.Duration, volumeToMount VolumeToMount, actualStateOfWorldMounterUpdater ActualStateOfWorldMounterUpdater) (func() error, error) {
+// setErr makes the operations named operationName that are generated from
+// now on return err right away instead of blocking.
+func (fopg *fakeOperationGenerator) setErr(operationName string, err error) {
+	fopg.lock.Lock()
+	defer fopg.lock.Unlock()
+	fopg.errs[operationName] = err
+}
+
+// generateCount returns how many operations named operationName were
+// generated.
+func (fopg *fakeOperationGenerator) generateCount(operationName string) int {
+	fopg.lock.Lock()
+	defer fopg.lock.Unlock()
+	return fopg.generated[operationName]
+}
+
+// runCount returns how many operations named operationName started running.
+func (fopg *fakeOperationGenerator) runCount(operationName string) int {
+	fopg.lock.Lock()
+	defer fopg.lock.Unlock()
+	return fopg.ran[operationName]
+}
+
+func (fopg *fakeOperationGenerator) generate(operationName string) func() error {
+	fopg.lock.Lock()
+	defer fopg.lock.Unlock()
+	fopg.generated[operationName]++
+	err, programmed := fopg.errs[operationName]
 	return func() error {
-		startOperationAndBlock(fopg.ch, fopg.quit)
-		return nil
-	}, nil
+		fopg.lock.Lock()
+		fopg.ran[operationName]++
+		fopg.lock.Unlock()
+		if !programmed {
+			startOperationAndBlock(fopg.ch, fopg.quit)
+		}
+		return err
+	}
+}
+
+func (fopg *fakeOperationGenerator) GenerateMountVolumeFunc(waitForAttachTimeout time.Duration, volumeToMount VolumeToMount, actualStateOfWorldMounterUpdater ActualStateOfWorldMounterUpdater) (func() error, error) {
+	return fopg.generate("MountVolume"), nil
 }
 func (fopg *fakeOperationGenerator) GenerateUnmountVolumeFunc(volumeToUnmount MountedVolume, actualStateOfWorld ActualStateOfWorldMounterUpdater) (func() error, error) {
-	return func() error {
-		startOperationAndBlock(fopg.ch, fopg.quit)
-		return nil
-	}, nil
+	return fopg.generate("UnmountVolume"), nil
 }
 func (fopg *fakeOperationGenerator) GenerateAttachVolumeFunc(volumeToAttach VolumeToAttach, actualStateOfWorld ActualStateOfWorldAttacherUpdater) (func() error, error) {
+	attachFunc := fopg.generate("AttachVolume")
 	return func() error {
-		startOperationAndBlock(fopg.ch, fopg.quit)
-		return nil
+		if err := attachFunc(); err != nil || actualStateOfWorld == nil {
+			return err
+		}
+		return actualStateOfWorld.MarkVolumeAsAttached(volumeToAttach.VolumeName, volumeToAttach.VolumeSpec, volumeToAttach.NodeName, "" /* devicePath */)
 	}, nil
 }
 func (fopg *fakeOperationGenerator) GenerateDetachVolumeFunc(volumeToDetach AttachedVolume, verifySafeToDetach bool, actualStateOfWorld ActualStateOfWorldAttacherUpdater) (func() error, error) {
-	return func() error {
-		startOperationAndBlock(fopg.ch, fopg.quit)
-		return nil
-	}, nil
+	return fopg.generate("DetachVolume"), nil
 }
 func (fopg *fakeOperationGenerator) GenerateVolumesAreAttachedFunc(attachedVolumes []AttachedVolume, nodeName types.NodeName, actualStateOfWorld ActualStateOfWorldAttacherUpdater) (func() error, error) {
-	return func() error {
-		startOperationAndBlock(fopg.ch, fopg.quit)
-		return nil
-	}, nil
+	return fopg.generate("VerifyVolumesAreAttached"), nil
 }
 func (fopg *fakeOperationGenerator) GenerateUnmountDeviceFunc(deviceToDetach AttachedVolume, actualStateOfWorld ActualStateOfWorldMounterUpdater, mounter mount.Interface) (func() error, error) {
-	return func() error {
-		startOperationAndBlock(fopg.ch, fopg.quit)
-		return nil
-	}, nil
+	return fopg.generate("UnmountDevice"), nil
 }
 func (fopg *fakeOperationGenerator) GenerateVerifyControllerAttachedVolumeFunc(volumeToMount VolumeToMount, nodeName types.NodeName, actualStateOfWorld ActualStateOfWorldAttacherUpdater) (func() error, error) {
-	return func() error {
-		startOperationAndBlock(fopg.ch, fopg.quit)
-		return nil
-	}, nil
+	return fopg.generate("VerifyControllerAttachedVolume"), nil
 }
 
 func (fopg *fakeOperationGenerator) GenerateBulkVolumeVerifyFunc(
@@ -287,14 +926,20 @@ func (fopg *fakeOperationGenerator) GenerateBulkVolumeVerifyFunc(
 	pluginNane string,
 	volumeSpecMap map[*volume.Spec]v1.UniqueVolumeName,
 	actualStateOfWorldAttacherUpdater ActualStateOfWorldAttacherUpdater) (func() error, error) {
-	return func() error {
-		startOperationAndBlock(fopg.ch, fopg.quit)
-		return nil
-	}, nil
+	return fopg.generate("BulkVerifyVolumes"), nil
 }
 
 func (fopg *fakeOperationGenerator) GetVolumePluginMgr() *volume.VolumePluginMgr {
-	return nil
+	return fopg.volumePluginMgr
+}
+
+// newFailingUnmountOperationGenerator returns a fakeOperationGenerator whose
+// UnmountVolume and UnmountDevice operations fail right away.
+func newFailingUnmountOperationGenerator() *fakeOperationGenerator {
+	generator := newFakeOperationGenerator(nil /* ch */, nil /* quit */)
+	generator.setErr("UnmountVolume", fmt.Errorf("volume busy"))
+	generator.setErr("UnmountDevice", fmt.Errorf("device busy"))
+	return generator
 }
 
 func getTestPodWithSecret(podName, secretName string) *v1.Pod {
@@ -373,6 +1018,353 @@ func getTestPodWithGCEPD(podName, pdName string) *v1.Pod {
 	}
 }
 
+func TestVolumeToMount_AsAttachedVolume(t *testing.T) {
+	pod := getTestPodWithGCEPD("pod1", "pd-volume")
+	volumeToMount := VolumeToMount{
+		VolumeName:         "fake-plugin/pd-volume",
+		PodName:            volumetypes.UniquePodName(pod.UID),
+		VolumeSpec:         volume.NewSpecFromVolume(&pod.Spec.Volumes[0]),
+		Pod:                pod,
+		PluginIsAttachable: true,
+		DevicePath:         "/dev/sdb",
+	}
+
+	expected := AttachedVolume{
+		VolumeName:         volumeToMount.VolumeName,
+		VolumeSpec:         volumeToMount.VolumeSpec,
+		NodeName:           "node1",
+		PluginIsAttachable: true,
+		DevicePath:         "/dev/sdb",
+	}
+	if actual := volumeToMount.AsAttachedVolume("node1"); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %+v, got %+v", expected, actual)
+	}
+}
+
+func TestReconcileCheck(t *testing.T) {
+	volume1Pod1 := VolumeToMount{PodName: "pod1", VolumeName: "volume1"}
+	volume2Pod1 := VolumeToMount{PodName: "pod1", VolumeName: "volume2"}
+	volume1Pod2 := VolumeToMount{PodName: "pod2", VolumeName: "volume1"}
+	mountedVolume1Pod1 := MountedVolume{PodName: "pod1", VolumeName: "volume1"}
+	mountedVolume2Pod1 := MountedVolume{PodName: "pod1", VolumeName: "volume2"}
+	mountedVolume1Pod2 := MountedVolume{PodName: "pod2", VolumeName: "volume1"}
+
+	testCases := map[string]struct {
+		desired           []VolumeToMount
+		actualMounted     []MountedVolume
+		expectedToMount   []VolumeToMount
+		expectedToUnmount []MountedVolume
+	}{
+		"add": {
+			desired:         []VolumeToMount{volume1Pod1, volume2Pod1, volume1Pod2},
+			actualMounted:   []MountedVolume{mountedVolume1Pod1},
+			expectedToMount: []VolumeToMount{volume2Pod1, volume1Pod2},
+		},
+		"remove": {
+			desired:           []VolumeToMount{volume1Pod1},
+			actualMounted:     []MountedVolume{mountedVolume1Pod1, mountedVolume2Pod1, mountedVolume1Pod2},
+			expectedToUnmount: []MountedVolume{mountedVolume2Pod1, mountedVolume1Pod2},
+		},
+		"add and remove": {
+			desired:           []VolumeToMount{volume2Pod1},
+			actualMounted:     []MountedVolume{mountedVolume1Pod2},
+			expectedToMount:   []VolumeToMount{volume2Pod1},
+			expectedToUnmount: []MountedVolume{mountedVolume1Pod2},
+		},
+		"steady state": {
+			desired:       []VolumeToMount{volume1Pod1, volume1Pod2},
+			actualMounted: []MountedVolume{mountedVolume1Pod2, mountedVolume1Pod1},
+		},
+		"duplicate desired volume": {
+			desired:         []VolumeToMount{volume2Pod1, volume2Pod1},
+			expectedToMount: []VolumeToMount{volume2Pod1},
+		},
+	}
+
+	for name, tc := range testCases {
+		toMount, toUnmount := ReconcileCheck(tc.desired, tc.actualMounted)
+		if !reflect.DeepEqual(toMount, tc.expectedToMount) {
+			t.Errorf("%s: expected volumes to mount %+v, got %+v", name, tc.expectedToMount, toMount)
+		}
+		if !reflect.DeepEqual(toUnmount, tc.expectedToUnmount) {
+			t.Errorf("%s: expected volumes to unmount %+v, got %+v", name, tc.expectedToUnmount, toUnmount)
+		}
+	}
+}
+
+func TestDiffAttachedVolumes(t *testing.T) {
+	volume1Node1 := AttachedVolume{NodeName: "node1", VolumeName: "volume1"}
+	volume2Node1 := AttachedVolume{NodeName: "node1", VolumeName: "volume2"}
+	volume1Node2 := AttachedVolume{NodeName: "node2", VolumeName: "volume1"}
+	attachedVolume1Node1 := AttachedVolume{NodeName: "node1", VolumeName: "volume1", DevicePath: "/dev/sdb"}
+
+	testCases := map[string]struct {
+		desired          []AttachedVolume
+		actual           []AttachedVolume
+		expectedToAttach []AttachedVolume
+		expectedToDetach []AttachedVolume
+	}{
+		"attach only": {
+			desired:          []AttachedVolume{volume1Node1, volume2Node1, volume1Node2},
+			actual:           []AttachedVolume{attachedVolume1Node1},
+			expectedToAttach: []AttachedVolume{volume2Node1, volume1Node2},
+		},
+		"detach only": {
+			desired:          []AttachedVolume{volume2Node1},
+			actual:           []AttachedVolume{attachedVolume1Node1, volume2Node1, volume1Node2},
+			expectedToDetach: []AttachedVolume{attachedVolume1Node1, volume1Node2},
+		},
+		"attach and detach": {
+			desired:          []AttachedVolume{volume1Node2},
+			actual:           []AttachedVolume{attachedVolume1Node1},
+			expectedToAttach: []AttachedVolume{volume1Node2},
+			expectedToDetach: []AttachedVolume{attachedVolume1Node1},
+		},
+		"steady state": {
+			desired: []AttachedVolume{volume1Node1, volume1Node2},
+			actual:  []AttachedVolume{volume1Node2, attachedVolume1Node1},
+		},
+		"duplicates": {
+			desired:          []AttachedVolume{volume2Node1, volume2Node1},
+			actual:           []AttachedVolume{volume1Node2, volume1Node2},
+			expectedToAttach: []AttachedVolume{volume2Node1},
+			expectedToDetach: []AttachedVolume{volume1Node2},
+		},
+	}
+
+	for name, tc := range testCases {
+		toAttach, toDetach := DiffAttachedVolumes(tc.desired, tc.actual)
+		if !reflect.DeepEqual(toAttach, tc.expectedToAttach) {
+			t.Errorf("%s: expected volumes to attach %+v, got %+v", name, tc.expectedToAttach, toAttach)
+		}
+		if !reflect.DeepEqual(toDetach, tc.expectedToDetach) {
+			t.Errorf("%s: expected volumes to detach %+v, got %+v", name, tc.expectedToDetach, toDetach)
+		}
+	}
+}
+
+func TestReconcileCheckVerifyingMounts(t *testing.T) {
+	mountedPath, err := ioutil.TempDir("", "reconcile-check")
+	if err != nil {
+		t.Fatalf("can't make a temp dir: %v", err)
+	}
+	defer os.RemoveAll(mountedPath)
+	missingPath := filepath.Join(mountedPath, "missing")
+	// Like the path of an emptyDir volume, this path exists but is not a
+	// mount point.
+	unmountedPath := filepath.Join(mountedPath, "empty-dir")
+	if err := os.Mkdir(unmountedPath, 0750); err != nil {
+		t.Fatalf("can't make a temp dir: %v", err)
+	}
+	mounter := &mount.FakeMounter{
+		MountPoints: []mount.MountPoint{{Device: "/dev/sdb", Path: mountedPath}},
+	}
+
+	volume1Pod1 := VolumeToMount{PodName: "pod1", VolumeName: "volume1"}
+	volume2Pod1 := VolumeToMount{PodName: "pod1", VolumeName: "volume2"}
+	mountedVolume1Pod1 := MountedVolume{PodName: "pod1", VolumeName: "volume1", Mounter: &fakePathMounter{path: mountedPath}}
+	mountedVolume2Pod1 := MountedVolume{PodName: "pod1", VolumeName: "volume2", Mounter: &fakePathMounter{path: missingPath}}
+	volume3Pod1 := VolumeToMount{PodName: "pod1", VolumeName: "volume3"}
+	mountedVolume3Pod1 := MountedVolume{PodName: "pod1", VolumeName: "volume3", Mounter: &fakePathMounter{path: unmountedPath}}
+	desired := []VolumeToMount{volume1Pod1, volume2Pod1, volume3Pod1}
+	actualMounted := []MountedVolume{mountedVolume1Pod1, mountedVolume2Pod1, mountedVolume3Pod1}
+
+	// Without verification the actual state of world is trusted.
+	toMount, toUnmount := ReconcileCheck(desired, actualMounted)
+	if len(toMount) != 0 || len(toUnmount) != 0 {
+		t.Errorf("expected nothing to mount or unmount, got %+v and %+v", toMount, toUnmount)
+	}
+
+	toMount, toUnmount = ReconcileCheckVerifyingMounts(desired, actualMounted, mounter)
+	if expected := []VolumeToMount{volume2Pod1}; !reflect.DeepEqual(toMount, expected) {
+		t.Errorf("expected volumes to mount %+v, got %+v", expected, toMount)
+	}
+	if len(toUnmount) != 0 {
+		t.Errorf("expected no volumes to unmount, got %+v", toUnmount)
+	}
+}
+
+// fakePathMounter is a volume mounter of a volume mounted at path.
+type fakePathMounter struct {
+	volume.Mounter
+	path string
+}
+
+func (m *fakePathMounter) GetPath() string {
+	return m.path
+}
+
+func TestOperationExecutor_UnmountDevice_UsesDeviceUnmountBackoff(t *testing.T) {
+	// Arrange
+	generator := newFailingUnmountOperationGenerator()
+	oe := NewOperationExecutor(generator, WithDeviceUnmountBackoff(OperationBackoff{
+		InitialDelay: 10 * time.Minute,
+		MaxDelay:     30 * time.Minute,
+	})).(*operationExecutor)
+	fakeClock := clock.NewFakeClock(time.Now())
+	oe.deviceUnmountBackoff.clock = fakeClock
+	pod := getTestPodWithGCEPD("pod1", "pd-volume")
+	deviceToDetach := AttachedVolume{VolumeName: "fake-plugin/pd-volume", NodeName: "node1"}
+	volumeToUnmount := MountedVolume{PodName: volumetypes.UniquePodName(pod.UID), VolumeName: "fake-plugin/pd-volume"}
+
+	// Act: fail both operations once
+	if err := oe.UnmountDevice(deviceToDetach, nil /* actualStateOfWorld */, nil /* mounter */); err != nil {
+		t.Fatalf("UnmountDevice failed: %v", err)
+	}
+	waitForOperationToComplete(t, oe, deviceToDetach.VolumeName, "" /* podName */)
+	if err := oe.UnmountVolume(volumeToUnmount, nil /* actualStateOfWorld */); err != nil {
+		t.Fatalf("UnmountVolume failed: %v", err)
+	}
+	waitForOperationToComplete(t, oe, volumeToUnmount.VolumeName, volumeToUnmount.PodName)
+
+	// Assert: UnmountDevice waits for the device specific backoff
+	if err := oe.UnmountDevice(deviceToDetach, nil /* actualStateOfWorld */, nil /* mounter */); !IsOperationBackoffError(err) {
+		t.Errorf("expected UnmountDevice to be rejected by the device unmount backoff, got %v", err)
+	}
+	if err := oe.UnmountVolume(volumeToUnmount, nil /* actualStateOfWorld */); IsOperationBackoffError(err) {
+		t.Errorf("expected UnmountVolume not to use the device unmount backoff, got %v", err)
+	}
+	if calls := generator.generateCount("UnmountDevice"); calls != 1 {
+		t.Errorf("expected 1 generated UnmountDevice operation, got %d", calls)
+	}
+
+	fakeClock.Step(10 * time.Minute)
+	if err := oe.deviceUnmountBackoff.safeToRetry("UnmountDevice", deviceToDetach.VolumeName, "" /* podName */); err != nil {
+		t.Errorf("expected UnmountDevice to be permitted after the backoff, got %v", err)
+	}
+}
+
+func TestOperationExecutor_VerifyControllerAttachedVolume_UsesAttachVerificationBackoff(t *testing.T) {
+	// Arrange
+	fakeClock := clock.NewFakeClock(time.Now())
+	generator := newFakeOperationGenerator(nil /* ch */, nil /* quit */)
+	generator.setErr("VerifyControllerAttachedVolume", fmt.Errorf("volume is not yet attached according to node status"))
+	oe := NewOperationExecutor(generator,
+		WithClock(fakeClock),
+		WithAttachVerificationBackoff(OperationBackoff{
+			InitialDelay: 30 * time.Second,
+			MaxDelay:     time.Minute,
+		})).(*operationExecutor)
+	pod := getTestPodWithGCEPD("pod1", "pd-volume")
+	volumeToMount := VolumeToMount{
+		VolumeName: "fake-plugin/pd-volume",
+		PodName:    volumetypes.UniquePodName(pod.UID),
+		Pod:        pod,
+	}
+
+	// Act: the first verification fails
+	if err := oe.VerifyControllerAttachedVolume(volumeToMount, "node1", nil /* actualStateOfWorld */); err != nil {
+		t.Fatalf("VerifyControllerAttachedVolume failed: %v", err)
+	}
+	waitForOperationToComplete(t, oe, volumeToMount.VolumeName, "" /* podName */)
+
+	// Assert: the verification is not retried before the configured interval
+	if err := oe.VerifyControllerAttachedVolume(volumeToMount, "node1", nil /* actualStateOfWorld */); !IsOperationBackoffError(err) {
+		t.Errorf("expected VerifyControllerAttachedVolume to be rejected by the attach verification backoff, got %v", err)
+	}
+	if calls := generator.generateCount("VerifyControllerAttachedVolume"); calls != 1 {
+		t.Errorf("expected 1 generated VerifyControllerAttachedVolume operation, got %d", calls)
+	}
+	fakeClock.Step(29 * time.Second)
+	if err := oe.attachVerificationBackoff.safeToRetry("VerifyControllerAttachedVolume", volumeToMount.VolumeName, "" /* podName */); err == nil {
+		t.Errorf("expected VerifyControllerAttachedVolume to be rejected before the interval passed")
+	}
+	fakeClock.Step(time.Second)
+	if err := oe.attachVerificationBackoff.safeToRetry("VerifyControllerAttachedVolume", volumeToMount.VolumeName, "" /* podName */); err != nil {
+		t.Errorf("expected VerifyControllerAttachedVolume to be permitted after the interval, got %v", err)
+	}
+}
+
+func waitForOperationToComplete(t *testing.T, oe OperationExecutor, volumeName v1.UniqueVolumeName, podName volumetypes.UniquePodName) {
+	err := wait.Poll(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		return !oe.IsOperationPending(volumeName, podName), nil
+	})
+	if err != nil {
+		t.Fatalf("operation for volume %q pod %q did not complete: %v", volumeName, podName, err)
+	}
+}
+
+// fakeNodeSerializedMountPlugin is a non-attachable plugin requiring node
+// serialized mounts.
+type fakeNodeSerializedMountPlugin struct {
+	*volumetesting.FakeVolumePlugin
+}
+
+var _ NodeSerializedMountVolumePlugin = &fakeNodeSerializedMountPlugin{}
+
+func (plugin *fakeNodeSerializedMountPlugin) RequiresNodeSerializedMount() bool {
+	return true
+}
+
+// fakeAttacherActualStateOfWorld records the updates made by the executor.
+type fakeAttacherActualStateOfWorld struct {
+	volumesDetached     map[v1.UniqueVolumeName]bool
+	volumesToRediscover map[v1.UniqueVolumeName]bool
+	mountedPods         map[v1.UniqueVolumeName][]volumetypes.UniquePodName
+}
+
+var _ ActualStateOfWorldAttacherUpdater = &fakeAttacherActualStateOfWorld{}
+var _ ActualStateOfWorldRediscoverer = &fakeAttacherActualStateOfWorld{}
+var _ ActualStateOfWorldMountChecker = &fakeAttacherActualStateOfWorld{}
+
+func newFakeAttacherActualStateOfWorld() *fakeAttacherActualStateOfWorld {
+	return &fakeAttacherActualStateOfWorld{
+		volumesDetached:     make(map[v1.UniqueVolumeName]bool),
+		volumesToRediscover: make(map[v1.UniqueVolumeName]bool),
+		mountedPods:         make(map[v1.UniqueVolumeName][]volumetypes.UniquePodName),
+	}
+}
+
+func (asw *fakeAttacherActualStateOfWorld) MarkVolumeAsAttached(volumeName v1.UniqueVolumeName, volumeSpec *volume.Spec, nodeName types.NodeName, devicePath string) error {
+	delete(asw.volumesDetached, volumeName)
+	return nil
+}
+
+func (asw *fakeAttacherActualStateOfWorld) MarkVolumeAsDetached(volumeName v1.UniqueVolumeName, nodeName types.NodeName) {
+	asw.volumesDetached[volumeName] = true
+}
+
+func (asw *fakeAttacherActualStateOfWorld) RemoveVolumeFromReportAsAttached(volumeName v1.UniqueVolumeName, nodeName types.NodeName) error {
+	return nil
+}
+
+func (asw *fakeAttacherActualStateOfWorld) AddVolumeToReportAsAttached(volumeName v1.UniqueVolumeName, nodeName types.NodeName) {
+}
+
+func (asw *fakeAttacherActualStateOfWorld) MarkVolumeForRediscovery(volumeName v1.UniqueVolumeName, nodeName types.NodeName) {
+	asw.volumesToRediscover[volumeName] = true
+}
+
+func (asw *fakeAttacherActualStateOfWorld) GetPodsMountingVolume(volumeName v1.UniqueVolumeName, nodeName types.NodeName) []volumetypes.UniquePodName {
+	return asw.mountedPods[volumeName]
+}
+
+// fakeEventRecorder records the reasons and messages of events.
+type fakeEventRecorder struct {
+	lock   sync.Mutex
+	events []string
+}
+
+func (r *fakeEventRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.events = append(r.events, reason+": "+fmt.Sprintf(messageFmt, args...))
+}
+
+func (r *fakeEventRecorder) getEvents() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]string{}, r.events...)
+}
+
+func getCounterValue(t *testing.T, counter prometheus.Counter) float64 {
+	metric := &dto.Metric{}
+	if err := counter.Write(metric); err != nil {
+		t.Fatalf("Failed to read counter: %v", err)
+	}
+	return metric.GetCounter().GetValue()
+}
+
 func isOperationRunSerially(ch <-chan interface{}, quit chan<- interface{}) bool {
 	defer close(quit)
 	numOperationsStarted := 0
@@ -409,6 +1401,19 @@ loop:
 	return false
 }
 
+func numOperationsStarted(ch <-chan interface{}, quit chan<- interface{}) int {
+	defer close(quit)
+	numOperationsStarted := 0
+	for {
+		select {
+		case <-ch:
+			numOperationsStarted++
+		case <-time.After(5 * time.Second):
+			return numOperationsStarted
+		}
+	}
+}
+
 func setup() (chan interface{}, chan interface{}, OperationExecutor) {
 	ch, quit := make(chan interface{}), make(chan interface{})
 	return ch, quit, NewOperationExecutor(newFakeOperationGenerator(ch, quit))
@@ -18,6 +18,9 @@ package operationexecutor
 
 import (
 	"fmt"
+	"os"
+	"path"
+	"strings"
 	"time"
 
 	"github.com/golang/glog"
@@ -29,10 +32,15 @@ import (
 	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/client/clientset_generated/clientset"
 	kevents "github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/kubelet/events"
 	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/util/mount"
+	utilstrings "github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/util/strings"
 	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/volume"
 	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/volume/util/volumehelper"
 )
 
+// DefaultKubeletRootDir is the kubelet root directory mount paths are
+// expected under when none is configured.
+const DefaultKubeletRootDir = "/var/lib/kubelet"
+
 var _ OperationGenerator = &operationGenerator{}
 
 type operationGenerator struct {
@@ -51,19 +59,111 @@ type operationGenerator struct {
 	// which verifies that the components (binaries, etc.) required to mount
 	// the volume are available on the underlying node before attempting mount.
 	checkNodeCapabilitiesBeforeMount bool
+
+	// ownershipChangeMode controls how fsGroup ownership is re-applied when
+	// a pod's fsGroup changes on an already-mounted volume.
+	ownershipChangeMode OwnershipChangeMode
+
+	// applyOwnership re-applies fsGroup ownership to a mounted volume. It is
+	// a field so that tests can observe the ownership step.
+	applyOwnership func(mounter volume.Mounter, fsGroup *int64, mode OwnershipChangeMode) error
+
+	// rootDir is the kubelet root directory (--root-dir) that the device
+	// mount paths returned by plugins are expected under.
+	rootDir string
+
+	// rootDirErr is set if the rootDir given to WithRootDir is invalid. The
+	// operations using the rootDir are not generated then.
+	rootDirErr error
+
+	// mountRefChecker decides whether a device mount path is still in use
+	// before the device is unmounted.
+	mountRefChecker MountRefChecker
 }
 
+// OwnershipChangeMode controls how volume ownership is re-applied on remount
+// when the pod's securityContext.fsGroup has changed.
+type OwnershipChangeMode string
+
+const (
+	// OwnershipChangeRecursive re-applies ownership to every file in the
+	// volume. This is the default, but may be slow for large volumes.
+	OwnershipChangeRecursive OwnershipChangeMode = "Recursive"
+
+	// OwnershipChangeRootOnly only re-applies ownership to the root directory
+	// of the volume, avoiding a recursive walk of large volumes.
+	OwnershipChangeRootOnly OwnershipChangeMode = "RootOnly"
+
+	// OwnershipChangeDisabled never re-applies ownership on remount.
+	OwnershipChangeDisabled OwnershipChangeMode = "Disabled"
+)
+
 // NewOperationGenerator is returns instance of operationGenerator
+// Without options, the GCIMounterMountRefChecker is used, device mount paths
+// are expected under DefaultKubeletRootDir and ownership is re-applied with
+// OwnershipChangeRecursive.
 func NewOperationGenerator(kubeClient clientset.Interface,
 	volumePluginMgr *volume.VolumePluginMgr,
 	recorder record.EventRecorder,
-	checkNodeCapabilitiesBeforeMount bool) OperationGenerator {
+	checkNodeCapabilitiesBeforeMount bool,
+	options ...OperationGeneratorOption) OperationGenerator {
 
-	return &operationGenerator{
-		kubeClient:      kubeClient,
-		volumePluginMgr: volumePluginMgr,
-		recorder:        recorder,
+	og := &operationGenerator{
+		kubeClient:                       kubeClient,
+		volumePluginMgr:                  volumePluginMgr,
+		recorder:                         recorder,
 		checkNodeCapabilitiesBeforeMount: checkNodeCapabilitiesBeforeMount,
+		ownershipChangeMode:              OwnershipChangeRecursive,
+		applyOwnership:                   applyVolumeOwnership,
+		rootDir:                          DefaultKubeletRootDir,
+		mountRefChecker:                  GCIMounterMountRefChecker{},
+	}
+	for _, option := range options {
+		option(og)
+	}
+	return og
+}
+
+// OperationGeneratorOption sets an optional dependency of the
+// OperationGenerator returned by NewOperationGenerator.
+type OperationGeneratorOption func(*operationGenerator)
+
+// WithMountRefChecker sets the checker that decides whether a device mount
+// path is still in use before the device is unmounted.
+func WithMountRefChecker(checker MountRefChecker) OperationGeneratorOption {
+	return func(og *operationGenerator) {
+		og.mountRefChecker = checker
+	}
+}
+
+// WithOwnershipChangeMode sets how fsGroup ownership is re-applied when a
+// pod's fsGroup changes on an already mounted volume. An empty mode keeps
+// OwnershipChangeRecursive.
+func WithOwnershipChangeMode(mode OwnershipChangeMode) OperationGeneratorOption {
+	return func(og *operationGenerator) {
+		og.ownershipChangeMode = OwnershipChangeRecursive
+		if mode != "" {
+			og.ownershipChangeMode = mode
+		}
+	}
+}
+
+// WithRootDir sets the kubelet root directory (--root-dir) that the device
+// mount paths returned by plugins are expected under. An empty rootDir keeps
+// DefaultKubeletRootDir. A rootDir that is not an absolute path is invalid,
+// GenerateMountVolumeFunc and GenerateUnmountDeviceFunc return an error for
+// it then.
+func WithRootDir(rootDir string) OperationGeneratorOption {
+	return func(og *operationGenerator) {
+		og.rootDir, og.rootDirErr = DefaultKubeletRootDir, nil
+		if rootDir == "" {
+			return
+		}
+		if !path.IsAbs(rootDir) {
+			og.rootDirErr = fmt.Errorf("kubelet root directory %q is not an absolute path", rootDir)
+			return
+		}
+		og.rootDir = rootDir
 	}
 }
 
@@ -364,7 +464,7 @@ func (og *operationGenerator) GenerateDetachVolumeFunc(
 	return func() error {
 		var err error
 		if verifySafeToDetach {
-			err = og.verifyVolumeIsSafeToDetach(volumeToDetach)
+			err = og.verifyVolumeIsSafeToDetach(volumeToDetach, actualStateOfWorld)
 		}
 		if err == nil {
 			err = volumeDetacher.Detach(volumeName, volumeToDetach.NodeName)
@@ -397,6 +497,16 @@ func (og *operationGenerator) GenerateMountVolumeFunc(
 	waitForAttachTimeout time.Duration,
 	volumeToMount VolumeToMount,
 	actualStateOfWorld ActualStateOfWorldMounterUpdater) (func() error, error) {
+	if og.rootDirErr != nil {
+		return nil, fmt.Errorf(
+			"MountVolume failed for volume %q (spec.Name: %q) pod %q (UID: %q) with: %v",
+			volumeToMount.VolumeName,
+			volumeToMount.VolumeSpec.Name(),
+			volumeToMount.PodName,
+			volumeToMount.Pod.UID,
+			og.rootDirErr)
+	}
+
 	// Get mounter plugin
 	volumePlugin, err :=
 		og.volumePluginMgr.FindPluginBySpec(volumeToMount.VolumeSpec)
@@ -490,6 +600,17 @@ func (og *operationGenerator) GenerateMountVolumeFunc(
 					err)
 			}
 
+			if !og.isUnderRootDir(deviceMountPath) {
+				glog.Warningf(
+					"MountVolume.GetDeviceMountPath returned %q for volume %q (spec.Name: %q) pod %q (UID: %q), which is outside of the kubelet root directory %q",
+					deviceMountPath,
+					volumeToMount.VolumeName,
+					volumeToMount.VolumeSpec.Name(),
+					volumeToMount.PodName,
+					volumeToMount.Pod.UID,
+					og.rootDir)
+			}
+
 			// Mount device to global mount path
 			err = volumeAttacher.MountDevice(
 				volumeToMount.VolumeSpec,
@@ -562,14 +683,42 @@ func (og *operationGenerator) GenerateMountVolumeFunc(
 			volumeToMount.PodName,
 			volumeToMount.Pod.UID)
 
+		// SetUp is a no-op for most plugins when the volume is already
+		// mounted, so a changed fsGroup has to be applied explicitly.
+		if volumeToMount.Remount && fsGroupChanged(volumeToMount.MountedFSGroup, fsGroup) {
+			ownershipErr := og.applyOwnership(volumeMounter, fsGroup, og.ownershipChangeMode)
+			if ownershipErr != nil {
+				// On failure, return error. Caller will log and retry.
+				err := fmt.Errorf(
+					"MountVolume.SetVolumeOwnership failed for volume %q (spec.Name: %q) pod %q (UID: %q) with: %v",
+					volumeToMount.VolumeName,
+					volumeToMount.VolumeSpec.Name(),
+					volumeToMount.PodName,
+					volumeToMount.Pod.UID,
+					ownershipErr)
+				og.recorder.Eventf(volumeToMount.Pod, v1.EventTypeWarning, kevents.FailedMountVolume, err.Error())
+				return err
+			}
+
+			glog.Infof(
+				"MountVolume.SetVolumeOwnership succeeded for volume %q (spec.Name: %q) pod %q (UID: %q) with mode %q.",
+				volumeToMount.VolumeName,
+				volumeToMount.VolumeSpec.Name(),
+				volumeToMount.PodName,
+				volumeToMount.Pod.UID,
+				og.ownershipChangeMode)
+		}
+
 		// Update actual state of world
-		markVolMountedErr := actualStateOfWorld.MarkVolumeAsMounted(
-			volumeToMount.PodName,
-			volumeToMount.Pod.UID,
-			volumeToMount.VolumeName,
-			volumeMounter,
-			volumeToMount.OuterVolumeSpecName,
-			volumeToMount.VolumeGidValue)
+		markVolMountedErr := actualStateOfWorld.MarkVolumeAsMounted(MarkVolumeOpts{
+			PodName:             volumeToMount.PodName,
+			PodUID:              volumeToMount.Pod.UID,
+			VolumeName:          volumeToMount.VolumeName,
+			Mounter:             volumeMounter,
+			OuterVolumeSpecName: volumeToMount.OuterVolumeSpecName,
+			VolumeGidValue:      volumeToMount.VolumeGidValue,
+			FSGroup:             fsGroup,
+		})
 		if markVolMountedErr != nil {
 			// On failure, return error. Caller will log and retry.
 			return fmt.Errorf(
@@ -655,10 +804,40 @@ func (og *operationGenerator) GenerateUnmountVolumeFunc(
 	}, nil
 }
 
+// currentDevicePath returns the device path the volume is currently attached
+// at. The volume may have been re-attached at a different path since
+// deviceToDetach was queued, for example by a cloud provider, in which case
+// the path recorded in the actual state of world is used if it has one.
+func currentDevicePath(deviceToDetach AttachedVolume, actualStateOfWorld ActualStateOfWorldMounterUpdater) string {
+	devicePathGetter, ok := actualStateOfWorld.(ActualStateOfWorldDevicePathGetter)
+	if !ok {
+		return deviceToDetach.DevicePath
+	}
+	devicePath, attached := devicePathGetter.GetAttachedVolumeDevicePath(deviceToDetach.VolumeName)
+	if !attached || devicePath == deviceToDetach.DevicePath {
+		return deviceToDetach.DevicePath
+	}
+	glog.V(2).Infof(
+		"UnmountDevice: device path of volume %q (spec.Name: %q) changed from %q to %q",
+		deviceToDetach.VolumeName,
+		deviceToDetach.VolumeSpec.Name(),
+		deviceToDetach.DevicePath,
+		devicePath)
+	return devicePath
+}
+
 func (og *operationGenerator) GenerateUnmountDeviceFunc(
 	deviceToDetach AttachedVolume,
 	actualStateOfWorld ActualStateOfWorldMounterUpdater,
 	mounter mount.Interface) (func() error, error) {
+	if og.rootDirErr != nil {
+		return nil, fmt.Errorf(
+			"UnmountDevice failed for volume %q (spec.Name: %q) with: %v",
+			deviceToDetach.VolumeName,
+			deviceToDetach.VolumeSpec.Name(),
+			og.rootDirErr)
+	}
+
 	// Get attacher plugin
 	attachableVolumePlugin, err :=
 		og.volumePluginMgr.FindAttachablePluginBySpec(deviceToDetach.VolumeSpec)
@@ -699,9 +878,17 @@ func (og *operationGenerator) GenerateUnmountDeviceFunc(
 				deviceToDetach.VolumeSpec.Name(),
 				err)
 		}
+		if !og.isUnderRootDir(deviceMountPath) {
+			glog.Warningf(
+				"UnmountDevice.GetDeviceMountPath returned %q for volume %q (spec.Name: %q), which is outside of the kubelet root directory %q",
+				deviceMountPath,
+				deviceToDetach.VolumeName,
+				deviceToDetach.VolumeSpec.Name(),
+				og.rootDir)
+		}
 		refs, err := attachableVolumePlugin.GetDeviceMountRefs(deviceMountPath)
 
-		if err != nil || hasMountRefs(deviceMountPath, refs) {
+		if err != nil || og.mountRefChecker.HasMountRefs(deviceMountPath, refs) {
 			if err == nil {
 				err = fmt.Errorf("The device mount path %q is still mounted by other references %v", deviceMountPath, refs)
 			}
@@ -725,16 +912,17 @@ func (og *operationGenerator) GenerateUnmountDeviceFunc(
 		// use mounter.PathIsDevice to check if the path is a device,
 		// if so use mounter.DeviceOpened to check if the device is in use anywhere
 		// else on the system. Retry if it returns true.
-		isDevicePath, devicePathErr := mounter.PathIsDevice(deviceToDetach.DevicePath)
+		devicePath := currentDevicePath(deviceToDetach, actualStateOfWorld)
+		isDevicePath, devicePathErr := mounter.PathIsDevice(devicePath)
 		var deviceOpened bool
 		var deviceOpenedErr error
 		if !isDevicePath && devicePathErr == nil {
 			// not a device path or path doesn't exist
 			//TODO: refer to #36092
-			glog.V(3).Infof("Not checking device path %s", deviceToDetach.DevicePath)
+			glog.V(3).Infof("Not checking device path %s", devicePath)
 			deviceOpened = false
 		} else {
-			deviceOpened, deviceOpenedErr = mounter.DeviceOpened(deviceToDetach.DevicePath)
+			deviceOpened, deviceOpenedErr = mounter.DeviceOpened(devicePath)
 			if deviceOpenedErr != nil {
 				return fmt.Errorf(
 					"UnmountDevice.DeviceOpened failed for volume %q (spec.Name: %q) with: %v",
@@ -869,27 +1057,34 @@ func (og *operationGenerator) GenerateVerifyControllerAttachedVolumeFunc(
 	}, nil
 }
 
+// verifyVolumeIsSafeToDetach returns an error listing the DetachBlockers of
+// the volume if it is still in use, either because the actual state of world
+// still records it as mounted to a pod on the node or according to the Node
+// status. The former is checked first, without calling the API server, and is
+// independent of the node's VolumesInUse, which may lag behind local state.
 func (og *operationGenerator) verifyVolumeIsSafeToDetach(
-	volumeToDetach AttachedVolume) error {
+	volumeToDetach AttachedVolume,
+	actualStateOfWorld ActualStateOfWorldAttacherUpdater) error {
+	if blockers := podsMountingVolume(volumeToDetach, actualStateOfWorld); len(blockers) > 0 {
+		return newVolumeInUseError(volumeToDetach, blockers)
+	}
+
 	// Fetch current node object
 	node, fetchErr := og.kubeClient.Core().Nodes().Get(string(volumeToDetach.NodeName), metav1.GetOptions{})
 	if fetchErr != nil {
-		if errors.IsNotFound(fetchErr) {
-			glog.Warningf("Node %q not found on API server. DetachVolume will skip safe to detach check.",
+		if !errors.IsNotFound(fetchErr) {
+			// On failure, return error. Caller will log and retry.
+			return fmt.Errorf(
+				"DetachVolume failed fetching node from API server for volume %q from node %q with: %v",
+				volumeToDetach.VolumeName,
 				volumeToDetach.NodeName,
-				volumeToDetach.VolumeName)
-			return nil
+				fetchErr)
 		}
-
-		// On failure, return error. Caller will log and retry.
-		return fmt.Errorf(
-			"DetachVolume failed fetching node from API server for volume %q from node %q with: %v",
-			volumeToDetach.VolumeName,
+		glog.Warningf("Node %q not found on API server. DetachVolume will skip the Node status part of the safe to detach check for volume %q.",
 			volumeToDetach.NodeName,
-			fetchErr)
-	}
-
-	if node == nil {
+			volumeToDetach.VolumeName)
+		node = nil
+	} else if node == nil {
 		// On failure, return error. Caller will log and retry.
 		return fmt.Errorf(
 			"DetachVolume failed fetching node from API server for volume %q from node %q. Error: node object retrieved from API server is nil",
@@ -897,21 +1092,72 @@ func (og *operationGenerator) verifyVolumeIsSafeToDetach(
 			volumeToDetach.NodeName)
 	}
 
-	for _, inUseVolume := range node.Status.VolumesInUse {
-		if inUseVolume == volumeToDetach.VolumeName {
-			return fmt.Errorf("DetachVolume failed for volume %q from node %q. Error: volume is still in use by node, according to Node status",
-				volumeToDetach.VolumeName,
-				volumeToDetach.NodeName)
-		}
+	if blockers := nodeUsingVolume(volumeToDetach.VolumeName, node); len(blockers) > 0 {
+		return newVolumeInUseError(volumeToDetach, blockers)
 	}
 
-	// Volume is not marked as in use by node
+	// Volume is not in use
 	glog.Infof("Verified volume is safe to detach for volume %q from node %q.",
 		volumeToDetach.VolumeName,
 		volumeToDetach.NodeName)
 	return nil
 }
 
+func newVolumeInUseError(volumeToDetach AttachedVolume, blockers []string) error {
+	return fmt.Errorf("DetachVolume failed for volume %q from node %q. Error: volume is still in use by %v",
+		volumeToDetach.VolumeName,
+		volumeToDetach.NodeName,
+		blockers)
+}
+
+// DetachBlockers returns the identifiers of what prevents volumeToDetach from
+// being detached: the pods the actual state of world still records the volume
+// as mounted to, in the form "pod/<name>", and the node, in the form
+// "node/<name>", if its status still reports the volume in VolumesInUse. node
+// may be nil if it is not known. It returns nil if nothing prevents the
+// detach.
+func DetachBlockers(
+	volumeToDetach AttachedVolume,
+	node *v1.Node,
+	actualStateOfWorld ActualStateOfWorldAttacherUpdater) []string {
+	blockers := podsMountingVolume(volumeToDetach, actualStateOfWorld)
+	return append(blockers, nodeUsingVolume(volumeToDetach.VolumeName, node)...)
+}
+
+// nodeUsingVolume returns "node/<name>" if the status of node still reports
+// volumeName in VolumesInUse, and nil otherwise or if node is nil.
+func nodeUsingVolume(volumeName v1.UniqueVolumeName, node *v1.Node) []string {
+	if node == nil {
+		return nil
+	}
+	var blockers []string
+	for _, inUseVolume := range node.Status.VolumesInUse {
+		if inUseVolume == volumeName {
+			blockers = append(blockers, "node/"+node.Name)
+			break
+		}
+	}
+	return blockers
+}
+
+// podsMountingVolume returns the pods the actual state of world still records
+// the volume as mounted to on the node, in the form "pod/<name>", if it
+// tracks mounts at all.
+func podsMountingVolume(
+	volumeToDetach AttachedVolume,
+	actualStateOfWorld ActualStateOfWorldAttacherUpdater) []string {
+	mountChecker, ok := actualStateOfWorld.(ActualStateOfWorldMountChecker)
+	if !ok {
+		return nil
+	}
+
+	var blockers []string
+	for _, podName := range mountChecker.GetPodsMountingVolume(volumeToDetach.VolumeName, volumeToDetach.NodeName) {
+		blockers = append(blockers, "pod/"+string(podName))
+	}
+	return blockers
+}
+
 func checkMountOptionSupport(og *operationGenerator, volumeToMount VolumeToMount, plugin volume.VolumePlugin) error {
 	mountOptions := volume.MountOptionFromSpec(volumeToMount.VolumeSpec)
 
@@ -928,3 +1174,69 @@ func checkMountOptionSupport(og *operationGenerator, volumeToMount VolumeToMount
 	}
 	return nil
 }
+
+// ParseMountPath is the inverse of the layout of the paths volumes are mounted
+// to for pods, {rootDir}/pods/{podUID}/volumes/{escapeQualifiedPluginName}/{volumeName},
+// e.g. to map the mounts found on disk after a kubelet restart back to the
+// volumes of the actual state of the world. The plugin name is returned
+// unescaped and the volume name is the outer volume spec name. An empty
+// rootDir means DefaultKubeletRootDir.
+func ParseMountPath(mountPath, rootDir string) (podUID, pluginName, outerVolumeSpecName string, err error) {
+	if rootDir == "" {
+		rootDir = DefaultKubeletRootDir
+	}
+	podsDir := path.Join(path.Clean(rootDir), "pods") + "/"
+	cleanPath := path.Clean(mountPath)
+	if !strings.HasPrefix(cleanPath, podsDir) {
+		return "", "", "", fmt.Errorf("mount path %q is not in the pods directory %q", mountPath, podsDir)
+	}
+	parts := strings.Split(strings.TrimPrefix(cleanPath, podsDir), "/")
+	if len(parts) != 4 || parts[1] != "volumes" {
+		return "", "", "", fmt.Errorf("mount path %q does not match %s{podUID}/volumes/{pluginName}/{volumeName}", mountPath, podsDir)
+	}
+	return parts[0], utilstrings.UnescapeQualifiedNameForDisk(parts[2]), parts[3], nil
+}
+
+// isUnderRootDir returns true if mountPath is located under the configured
+// kubelet root directory.
+func (og *operationGenerator) isUnderRootDir(mountPath string) bool {
+	rel := path.Clean(mountPath)
+	root := path.Clean(og.rootDir)
+	return rel == root || strings.HasPrefix(rel, root+"/")
+}
+
+// fsGroupChanged returns true if the fsGroup a volume was mounted with differs
+// from the fsGroup currently requested by the pod.
+func fsGroupChanged(mountedFSGroup, fsGroup *int64) bool {
+	if mountedFSGroup == nil || fsGroup == nil {
+		return mountedFSGroup != fsGroup
+	}
+	return *mountedFSGroup != *fsGroup
+}
+
+// applyVolumeOwnership re-applies fsGroup ownership to the volume mounted by
+// mounter according to mode. Like the plugins' own SetUp, it leaves read-only
+// and unmanaged volumes alone.
+func applyVolumeOwnership(mounter volume.Mounter, fsGroup *int64, mode OwnershipChangeMode) error {
+	attributes := mounter.GetAttributes()
+	if fsGroup == nil || attributes.ReadOnly || !attributes.Managed {
+		return nil
+	}
+
+	switch mode {
+	case OwnershipChangeDisabled:
+		return nil
+	case OwnershipChangeRootOnly:
+		path := mounter.GetPath()
+		if err := os.Lchown(path, -1, int(*fsGroup)); err != nil {
+			return err
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		return os.Chmod(path, info.Mode()|os.ModeSetgid)
+	default:
+		return volume.SetVolumeOwnership(mounter, fsGroup)
+	}
+}
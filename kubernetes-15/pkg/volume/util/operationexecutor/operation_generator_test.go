@@ -0,0 +1,560 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operationexecutor
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/api/v1"
+	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/client/clientset_generated/clientset/fake"
+	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/util/mount"
+	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/volume"
+	volumetesting "github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/volume/testing"
+	volumetypes "github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/volume/util/types"
+)
+
+func TestOperationGenerator_MountVolume_ReappliesChangedFSGroup(t *testing.T) {
+	testCases := map[string]struct {
+		remount        bool
+		mountedFSGroup *int64
+		fsGroup        *int64
+		expectApplied  bool
+	}{
+		"first mount": {
+			remount:       false,
+			fsGroup:       int64Ptr(2000),
+			expectApplied: false,
+		},
+		"remount with unchanged fsGroup": {
+			remount:        true,
+			mountedFSGroup: int64Ptr(2000),
+			fsGroup:        int64Ptr(2000),
+			expectApplied:  false,
+		},
+		"remount with changed fsGroup": {
+			remount:        true,
+			mountedFSGroup: int64Ptr(1000),
+			fsGroup:        int64Ptr(2000),
+			expectApplied:  true,
+		},
+		"remount with newly set fsGroup": {
+			remount:       true,
+			fsGroup:       int64Ptr(2000),
+			expectApplied: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		og, fakePlugin := newTestOperationGenerator(t)
+		var appliedFSGroups []int64
+		og.applyOwnership = func(mounter volume.Mounter, fsGroup *int64, mode OwnershipChangeMode) error {
+			appliedFSGroups = append(appliedFSGroups, *fsGroup)
+			return nil
+		}
+
+		pod := getTestPodWithGCEPD("pod1", "pd-volume")
+		pod.Spec.SecurityContext = &v1.PodSecurityContext{FSGroup: tc.fsGroup}
+		volumeToMount := VolumeToMount{
+			VolumeName:     v1.UniqueVolumeName("fake-plugin/pd-volume"),
+			PodName:        volumetypes.UniquePodName(pod.UID),
+			VolumeSpec:     volume.NewSpecFromVolume(&pod.Spec.Volumes[0]),
+			Pod:            pod,
+			Remount:        tc.remount,
+			MountedFSGroup: tc.mountedFSGroup,
+		}
+		asw := newFakeActualStateOfWorld()
+
+		mountFunc, err := og.GenerateMountVolumeFunc(0 /* waitForAttachTimeout */, volumeToMount, asw)
+		if err != nil {
+			t.Fatalf("%s: GenerateMountVolumeFunc failed: %v", name, err)
+		}
+		if err := mountFunc(); err != nil {
+			t.Fatalf("%s: mount failed: %v", name, err)
+		}
+
+		if err := volumetesting.VerifySetUpCallCount(1 /* expectedSetUpCallCount */, fakePlugin); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if tc.expectApplied {
+			if len(appliedFSGroups) != 1 || appliedFSGroups[0] != *tc.fsGroup {
+				t.Errorf("%s: expected ownership to be re-applied with fsGroup %d, got %v", name, *tc.fsGroup, appliedFSGroups)
+			}
+		} else if len(appliedFSGroups) != 0 {
+			t.Errorf("%s: expected ownership not to be re-applied, got %v", name, appliedFSGroups)
+		}
+		if recorded := asw.mountedFSGroups[volumeToMount.PodName]; !int64PtrEqual(recorded, tc.fsGroup) {
+			t.Errorf("%s: expected fsGroup %v to be recorded in the actual state of world, got %v", name, tc.fsGroup, recorded)
+		}
+	}
+}
+
+func TestOperationGenerator_DetachVolume_RefusesWhileMountedInActualStateOfWorld(t *testing.T) {
+	testCases := map[string]struct {
+		mountedPods  []volumetypes.UniquePodName
+		expectDetach bool
+	}{
+		"not mounted": {
+			expectDetach: true,
+		},
+		"mounted to a pod": {
+			mountedPods:  []volumetypes.UniquePodName{"pod1"},
+			expectDetach: false,
+		},
+	}
+
+	for name, tc := range testCases {
+		og, _ := newTestOperationGenerator(t)
+		pod := getTestPodWithGCEPD("pod1", "pd-volume")
+		volumeToDetach := AttachedVolume{
+			VolumeName: v1.UniqueVolumeName("fake-plugin/pd-volume"),
+			VolumeSpec: volume.NewSpecFromVolume(&pod.Spec.Volumes[0]),
+			NodeName:   "node1",
+		}
+		asw := newFakeAttacherActualStateOfWorld()
+		if tc.mountedPods != nil {
+			asw.mountedPods[volumeToDetach.VolumeName] = tc.mountedPods
+		}
+
+		detachFunc, err := og.GenerateDetachVolumeFunc(volumeToDetach, true /* verifySafeToDetach */, asw)
+		if err != nil {
+			t.Fatalf("%s: GenerateDetachVolumeFunc failed: %v", name, err)
+		}
+		err = detachFunc()
+
+		if tc.expectDetach {
+			if err != nil {
+				t.Errorf("%s: expected detach to succeed, got %v", name, err)
+			}
+		} else if err == nil {
+			t.Errorf("%s: expected detach to be refused while the volume is mounted", name)
+		}
+		if asw.volumesDetached[volumeToDetach.VolumeName] != tc.expectDetach {
+			t.Errorf("%s: expected volume detached to be %v, got %v", name, tc.expectDetach, asw.volumesDetached[volumeToDetach.VolumeName])
+		}
+	}
+}
+
+func TestOperationGenerator_DetachVolume_ReportsDetachBlockers(t *testing.T) {
+	volumeName := v1.UniqueVolumeName("fake-plugin/pd-volume")
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+		Status: v1.NodeStatus{
+			VolumesInUse: []v1.UniqueVolumeName{"fake-plugin/other-volume", volumeName},
+		},
+	}
+
+	pod := getTestPodWithGCEPD("pod1", "pd-volume")
+	volumeToDetach := AttachedVolume{
+		VolumeName: volumeName,
+		VolumeSpec: volume.NewSpecFromVolume(&pod.Spec.Volumes[0]),
+		NodeName:   "node1",
+	}
+	unusedVolume := volumeToDetach
+	unusedVolume.VolumeName = "fake-plugin/unused-volume"
+	asw := newFakeAttacherActualStateOfWorld()
+	asw.mountedPods[volumeName] = []volumetypes.UniquePodName{"pod1"}
+
+	if blockers, expected := DetachBlockers(volumeToDetach, node, asw), []string{"pod/pod1", "node/node1"}; !reflect.DeepEqual(blockers, expected) {
+		t.Errorf("expected detach blockers %v, got %v", expected, blockers)
+	}
+	if blockers := DetachBlockers(unusedVolume, node, asw); len(blockers) != 0 {
+		t.Errorf("expected no detach blockers for a volume not in use, got %v", blockers)
+	}
+	if blockers, expected := DetachBlockers(volumeToDetach, nil, asw), []string{"pod/pod1"}; !reflect.DeepEqual(blockers, expected) {
+		t.Errorf("expected detach blockers %v without a node, got %v", expected, blockers)
+	}
+
+	testCases := map[string]struct {
+		mountedPods      []volumetypes.UniquePodName
+		expectedBlockers []string
+		expectNodeGet    bool
+	}{
+		"mounted to a pod": {
+			mountedPods:      []volumetypes.UniquePodName{"pod1"},
+			expectedBlockers: []string{"pod/pod1"},
+			expectNodeGet:    false,
+		},
+		"only in use according to the node status": {
+			expectedBlockers: []string{"node/node1"},
+			expectNodeGet:    true,
+		},
+	}
+	for name, tc := range testCases {
+		og, _ := newTestOperationGenerator(t)
+		client := fake.NewSimpleClientset(node)
+		og.kubeClient = client
+		asw := newFakeAttacherActualStateOfWorld()
+		if tc.mountedPods != nil {
+			asw.mountedPods[volumeName] = tc.mountedPods
+		}
+
+		detachFunc, err := og.GenerateDetachVolumeFunc(volumeToDetach, true /* verifySafeToDetach */, asw)
+		if err != nil {
+			t.Fatalf("%s: GenerateDetachVolumeFunc failed: %v", name, err)
+		}
+		err = detachFunc()
+		if err == nil {
+			t.Fatalf("%s: expected detach to be refused while the volume is in use", name)
+		}
+		for _, blocker := range tc.expectedBlockers {
+			if !strings.Contains(err.Error(), blocker) {
+				t.Errorf("%s: expected the error to name %q, got %v", name, blocker, err)
+			}
+		}
+		if nodeGet := len(client.Actions()) > 0; nodeGet != tc.expectNodeGet {
+			t.Errorf("%s: expected the node to be fetched: %v, got %v", name, tc.expectNodeGet, nodeGet)
+		}
+		if asw.volumesDetached[volumeName] {
+			t.Errorf("%s: expected volume not to be detached", name)
+		}
+	}
+}
+
+func TestOperationGenerator_UnmountDevice_UsesCurrentDevicePath(t *testing.T) {
+	testCases := map[string]struct {
+		currentDevicePath string
+		expectUnmounted   bool
+	}{
+		"device path unchanged": {
+			currentDevicePath: "",
+			expectUnmounted:   false,
+		},
+		"device path changed since attach": {
+			currentDevicePath: "/dev/sdc",
+			expectUnmounted:   true,
+		},
+	}
+
+	for name, tc := range testCases {
+		og, _ := newTestOperationGenerator(t)
+		pod := getTestPodWithGCEPD("pod1", "pd-volume")
+		deviceToDetach := AttachedVolume{
+			VolumeName: v1.UniqueVolumeName("fake-plugin/pd-volume"),
+			VolumeSpec: volume.NewSpecFromVolume(&pod.Spec.Volumes[0]),
+			NodeName:   "node1",
+			// The volume was attached at /dev/sdb, which is now used by a
+			// different, mounted, device.
+			DevicePath: "/dev/sdb",
+		}
+		asw := newFakeActualStateOfWorld()
+		asw.devicesMounted[deviceToDetach.VolumeName] = true
+		if tc.currentDevicePath != "" {
+			asw.devicePaths[deviceToDetach.VolumeName] = tc.currentDevicePath
+		}
+		mounter := &mount.FakeMounter{
+			MountPoints: []mount.MountPoint{{Device: "/dev/sdb", Path: "/mnt/other"}},
+		}
+
+		unmountDeviceFunc, err := og.GenerateUnmountDeviceFunc(deviceToDetach, asw, mounter)
+		if err != nil {
+			t.Fatalf("%s: GenerateUnmountDeviceFunc failed: %v", name, err)
+		}
+		err = unmountDeviceFunc()
+
+		if tc.expectUnmounted && err != nil {
+			t.Errorf("%s: expected unmount device to succeed, got %v", name, err)
+		}
+		if !tc.expectUnmounted && err == nil {
+			t.Errorf("%s: expected unmount device to fail while the recorded device is in use", name)
+		}
+		if asw.devicesMounted[deviceToDetach.VolumeName] == tc.expectUnmounted {
+			t.Errorf("%s: expected device unmounted to be %v", name, tc.expectUnmounted)
+		}
+	}
+}
+
+func TestOperationGenerator_UnmountDevice_UsesMountRefChecker(t *testing.T) {
+	og, _ := newTestOperationGenerator(t)
+	checker := &fakeMountRefChecker{hasMountRefs: true}
+	WithMountRefChecker(checker)(og)
+	pod := getTestPodWithGCEPD("pod1", "pd-volume")
+	deviceToDetach := AttachedVolume{
+		VolumeName: v1.UniqueVolumeName("fake-plugin/pd-volume"),
+		VolumeSpec: volume.NewSpecFromVolume(&pod.Spec.Volumes[0]),
+		NodeName:   "node1",
+		DevicePath: "/dev/sdb",
+	}
+	asw := newFakeActualStateOfWorld()
+	asw.devicesMounted[deviceToDetach.VolumeName] = true
+
+	unmountDeviceFunc, err := og.GenerateUnmountDeviceFunc(deviceToDetach, asw, &mount.FakeMounter{})
+	if err != nil {
+		t.Fatalf("GenerateUnmountDeviceFunc failed: %v", err)
+	}
+	if err := unmountDeviceFunc(); err == nil {
+		t.Errorf("expected unmount device to fail while the checker reports mount references")
+	}
+	if checker.calls != 1 {
+		t.Errorf("expected the mount ref checker to be called once, got %d calls", checker.calls)
+	}
+	if !asw.devicesMounted[deviceToDetach.VolumeName] {
+		t.Errorf("expected device to remain mounted")
+	}
+}
+
+// fakeMountRefChecker is a MountRefChecker that returns a fixed result.
+type fakeMountRefChecker struct {
+	hasMountRefs bool
+	calls        int
+}
+
+func (c *fakeMountRefChecker) HasMountRefs(mountPath string, mountRefs []string) bool {
+	c.calls++
+	return c.hasMountRefs
+}
+
+func TestFSGroupChanged(t *testing.T) {
+	testCases := []struct {
+		mountedFSGroup *int64
+		fsGroup        *int64
+		expected       bool
+	}{
+		{nil, nil, false},
+		{nil, int64Ptr(1000), true},
+		{int64Ptr(1000), nil, true},
+		{int64Ptr(1000), int64Ptr(1000), false},
+		{int64Ptr(1000), int64Ptr(2000), true},
+	}
+
+	for _, tc := range testCases {
+		if actual := fsGroupChanged(tc.mountedFSGroup, tc.fsGroup); actual != tc.expected {
+			t.Errorf("fsGroupChanged(%v, %v): expected %v, got %v", tc.mountedFSGroup, tc.fsGroup, tc.expected, actual)
+		}
+	}
+}
+
+func TestOperationGenerator_IsUnderRootDir(t *testing.T) {
+	testCases := []struct {
+		rootDir   string
+		mountPath string
+		expected  bool
+	}{
+		{"", "/var/lib/kubelet/plugins/kubernetes.io/gce-pd/mounts/pd-volume", true},
+		{"", "/mnt/kubelet/plugins/kubernetes.io/gce-pd/mounts/pd-volume", false},
+		{"/mnt/kubelet", "/mnt/kubelet/plugins/kubernetes.io/gce-pd/mounts/pd-volume", true},
+		{"/mnt/kubelet/", "/mnt/kubelet", true},
+		{"/mnt/kubelet", "/var/lib/kubelet/plugins/kubernetes.io/gce-pd/mounts/pd-volume", false},
+		{"/var/lib/kubelet", "/var/lib/kubelet-other/plugins", false},
+	}
+
+	for _, tc := range testCases {
+		volumePluginMgr, _ := volumetesting.GetTestVolumePluginMgr(t)
+		og := NewOperationGenerator(
+			fake.NewSimpleClientset(),
+			volumePluginMgr,
+			record.NewFakeRecorder(100),
+			false, /* checkNodeCapabilitiesBeforeMount */
+			WithRootDir(tc.rootDir)).(*operationGenerator)
+
+		if actual := og.isUnderRootDir(tc.mountPath); actual != tc.expected {
+			t.Errorf("rootDir %q: expected isUnderRootDir(%q) to be %v, got %v", tc.rootDir, tc.mountPath, tc.expected, actual)
+		}
+	}
+}
+
+func TestOperationGenerator_WithOwnershipChangeMode(t *testing.T) {
+	testCases := map[OwnershipChangeMode]OwnershipChangeMode{
+		"":                       OwnershipChangeRecursive,
+		OwnershipChangeRecursive: OwnershipChangeRecursive,
+		OwnershipChangeRootOnly:  OwnershipChangeRootOnly,
+		OwnershipChangeDisabled:  OwnershipChangeDisabled,
+	}
+
+	for mode, expected := range testCases {
+		volumePluginMgr, _ := volumetesting.GetTestVolumePluginMgr(t)
+		og := NewOperationGenerator(
+			fake.NewSimpleClientset(),
+			volumePluginMgr,
+			record.NewFakeRecorder(100),
+			false, /* checkNodeCapabilitiesBeforeMount */
+			WithOwnershipChangeMode(mode)).(*operationGenerator)
+
+		if og.ownershipChangeMode != expected {
+			t.Errorf("WithOwnershipChangeMode(%q): expected mode %q, got %q", mode, expected, og.ownershipChangeMode)
+		}
+	}
+}
+
+func TestOperationGenerator_InvalidRootDir(t *testing.T) {
+	volumePluginMgr, _ := volumetesting.GetTestVolumePluginMgr(t)
+	og := NewOperationGenerator(
+		fake.NewSimpleClientset(),
+		volumePluginMgr,
+		record.NewFakeRecorder(100),
+		false, /* checkNodeCapabilitiesBeforeMount */
+		WithRootDir("var/lib/kubelet"))
+	volumeSpec := &volume.Spec{Volume: &v1.Volume{Name: "pd-volume"}}
+
+	if _, err := og.GenerateMountVolumeFunc(0 /* waitForAttachTimeout */, VolumeToMount{
+		VolumeName: "pd-volume",
+		VolumeSpec: volumeSpec,
+		Pod:        &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod1", UID: "pod-uid"}},
+	}, nil /* actualStateOfWorld */); err == nil {
+		t.Errorf("expected GenerateMountVolumeFunc to fail for a relative root dir")
+	}
+	if _, err := og.GenerateUnmountDeviceFunc(AttachedVolume{
+		VolumeName: "pd-volume",
+		VolumeSpec: volumeSpec,
+	}, nil /* actualStateOfWorld */, nil /* mounter */); err == nil {
+		t.Errorf("expected GenerateUnmountDeviceFunc to fail for a relative root dir")
+	}
+}
+
+func TestParseMountPath(t *testing.T) {
+	testCases := map[string]struct {
+		mountPath                   string
+		rootDir                     string
+		expectError                 bool
+		expectedPodUID              string
+		expectedPluginName          string
+		expectedOuterVolumeSpecName string
+	}{
+		"standard path": {
+			mountPath:                   "/var/lib/kubelet/pods/pod-uid/volumes/kubernetes.io~gce-pd/pd-volume",
+			rootDir:                     "/var/lib/kubelet",
+			expectedPodUID:              "pod-uid",
+			expectedPluginName:          "kubernetes.io/gce-pd",
+			expectedOuterVolumeSpecName: "pd-volume",
+		},
+		"default root dir": {
+			mountPath:                   "/var/lib/kubelet/pods/pod-uid/volumes/kubernetes.io~gce-pd/pd-volume",
+			expectedPodUID:              "pod-uid",
+			expectedPluginName:          "kubernetes.io/gce-pd",
+			expectedOuterVolumeSpecName: "pd-volume",
+		},
+		"escaped plugin name of a flex volume": {
+			mountPath:                   "/mnt/kubelet/pods/pod-uid/volumes/example.com~nfs/data",
+			rootDir:                     "/mnt/kubelet/",
+			expectedPodUID:              "pod-uid",
+			expectedPluginName:          "example.com/nfs",
+			expectedOuterVolumeSpecName: "data",
+		},
+		"plugin name without a domain": {
+			mountPath:                   "/var/lib/kubelet/pods/pod-uid/volumes/nfs/data/",
+			expectedPodUID:              "pod-uid",
+			expectedPluginName:          "nfs",
+			expectedOuterVolumeSpecName: "data",
+		},
+		"path under another root dir": {
+			mountPath:   "/var/lib/kubelet-other/pods/pod-uid/volumes/kubernetes.io~gce-pd/pd-volume",
+			expectError: true,
+		},
+		"global mount path": {
+			mountPath:   "/var/lib/kubelet/plugins/kubernetes.io/gce-pd/mounts/pd-volume",
+			expectError: true,
+		},
+		"pod volumes directory": {
+			mountPath:   "/var/lib/kubelet/pods/pod-uid/volumes/kubernetes.io~gce-pd",
+			expectError: true,
+		},
+		"path below the volume": {
+			mountPath:   "/var/lib/kubelet/pods/pod-uid/volumes/kubernetes.io~gce-pd/pd-volume/data",
+			expectError: true,
+		},
+		"pod plugin directory": {
+			mountPath:   "/var/lib/kubelet/pods/pod-uid/plugins/kubernetes.io~gce-pd/pd-volume",
+			expectError: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		podUID, pluginName, outerVolumeSpecName, err := ParseMountPath(tc.mountPath, tc.rootDir)
+		if tc.expectError {
+			if err == nil {
+				t.Errorf("%s: expected an error, got pod UID %q, plugin %q, volume %q", name, podUID, pluginName, outerVolumeSpecName)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+			continue
+		}
+		if podUID != tc.expectedPodUID || pluginName != tc.expectedPluginName || outerVolumeSpecName != tc.expectedOuterVolumeSpecName {
+			t.Errorf("%s: expected pod UID %q, plugin %q, volume %q, got %q, %q, %q", name,
+				tc.expectedPodUID, tc.expectedPluginName, tc.expectedOuterVolumeSpecName,
+				podUID, pluginName, outerVolumeSpecName)
+		}
+	}
+}
+
+func newTestOperationGenerator(t *testing.T) (*operationGenerator, *volumetesting.FakeVolumePlugin) {
+	volumePluginMgr, fakePlugin := volumetesting.GetTestVolumePluginMgr(t)
+	og := NewOperationGenerator(
+		fake.NewSimpleClientset(),
+		volumePluginMgr,
+		record.NewFakeRecorder(100),
+		false /* checkNodeCapabilitiesBeforeMount */)
+	return og.(*operationGenerator), fakePlugin
+}
+
+// fakeActualStateOfWorld records the updates made by generated operations.
+type fakeActualStateOfWorld struct {
+	mountedFSGroups map[volumetypes.UniquePodName]*int64
+	devicesMounted  map[v1.UniqueVolumeName]bool
+	devicePaths     map[v1.UniqueVolumeName]string
+}
+
+var _ ActualStateOfWorldMounterUpdater = &fakeActualStateOfWorld{}
+var _ ActualStateOfWorldDevicePathGetter = &fakeActualStateOfWorld{}
+
+func newFakeActualStateOfWorld() *fakeActualStateOfWorld {
+	return &fakeActualStateOfWorld{
+		mountedFSGroups: make(map[volumetypes.UniquePodName]*int64),
+		devicesMounted:  make(map[v1.UniqueVolumeName]bool),
+		devicePaths:     make(map[v1.UniqueVolumeName]string),
+	}
+}
+
+func (asw *fakeActualStateOfWorld) GetAttachedVolumeDevicePath(volumeName v1.UniqueVolumeName) (string, bool) {
+	devicePath, attached := asw.devicePaths[volumeName]
+	return devicePath, attached
+}
+
+func (asw *fakeActualStateOfWorld) MarkVolumeAsMounted(markVolumeOpts MarkVolumeOpts) error {
+	asw.mountedFSGroups[markVolumeOpts.PodName] = markVolumeOpts.FSGroup
+	return nil
+}
+
+func (asw *fakeActualStateOfWorld) MarkVolumeAsUnmounted(podName volumetypes.UniquePodName, volumeName v1.UniqueVolumeName) error {
+	delete(asw.mountedFSGroups, podName)
+	return nil
+}
+
+func (asw *fakeActualStateOfWorld) MarkDeviceAsMounted(volumeName v1.UniqueVolumeName) error {
+	asw.devicesMounted[volumeName] = true
+	return nil
+}
+
+func (asw *fakeActualStateOfWorld) MarkDeviceAsUnmounted(volumeName v1.UniqueVolumeName) error {
+	delete(asw.devicesMounted, volumeName)
+	return nil
+}
+
+func int64Ptr(i int64) *int64 {
+	return &i
+}
+
+func int64PtrEqual(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
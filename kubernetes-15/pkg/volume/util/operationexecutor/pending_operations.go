@@ -0,0 +1,113 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operationexecutor
+
+import (
+	"sort"
+	"time"
+
+	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/api/v1"
+	volumetypes "github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/volume/util/types"
+)
+
+// PendingOperationRecord describes an operation that was started by the
+// OperationExecutor and did not complete yet, see SnapshotPending.
+type PendingOperationRecord struct {
+	// OperationName is the name of the operation, e.g. "MountVolume".
+	OperationName string `json:"operationName"`
+
+	// VolumeName is the unique name of the volume the operation is on. It is
+	// empty for operations that are not on a single volume.
+	VolumeName v1.UniqueVolumeName `json:"volumeName,omitempty"`
+
+	// PodName is the unique name of the pod the operation is on. It is empty
+	// for operations that are not specific to a pod.
+	PodName volumetypes.UniquePodName `json:"podName,omitempty"`
+
+	// StartTime is when the operation started running. It is zero while the
+	// operation waits to run, e.g. for one of the concurrent mount slots.
+	StartTime time.Time `json:"startTime"`
+}
+
+func (oe *operationExecutor) SnapshotPending() []PendingOperationRecord {
+	oe.operationsLock.Lock()
+	records := make([]PendingOperationRecord, 0, len(oe.operations))
+	for op := range oe.operations {
+		records = append(records, PendingOperationRecord{
+			OperationName: op.operationName,
+			VolumeName:    op.volumeName,
+			PodName:       op.podName,
+			StartTime:     op.startTime,
+		})
+	}
+	oe.operationsLock.Unlock()
+
+	sort.Sort(byVolumePodAndOperation(records))
+	return records
+}
+
+func (oe *operationExecutor) StaleOperations(olderThan time.Duration) []PendingOperationRecord {
+	var stale []PendingOperationRecord
+	for _, record := range oe.SnapshotPending() {
+		if !record.StartTime.IsZero() && oe.clock.Since(record.StartTime) > olderThan {
+			stale = append(stale, record)
+		}
+	}
+	return stale
+}
+
+type byVolumePodAndOperation []PendingOperationRecord
+
+func (r byVolumePodAndOperation) Len() int      { return len(r) }
+func (r byVolumePodAndOperation) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r byVolumePodAndOperation) Less(i, j int) bool {
+	if r[i].VolumeName != r[j].VolumeName {
+		return r[i].VolumeName < r[j].VolumeName
+	}
+	if r[i].PodName != r[j].PodName {
+		return r[i].PodName < r[j].PodName
+	}
+	if r[i].OperationName != r[j].OperationName {
+		return r[i].OperationName < r[j].OperationName
+	}
+	return r[i].StartTime.Before(r[j].StartTime)
+}
+
+// PartitionPendingOperations compares the records of a snapshot taken before
+// a restart with the volumes of the desired state of the world after it.
+// Records of volumes that are still desired are returned in desired, their
+// operations were interrupted and the actual state of the volume must be
+// verified before it is rebuilt. The other records are returned in
+// undesired, their volumes may need to be cleaned up. Records without a
+// volume name are left out.
+func PartitionPendingOperations(records []PendingOperationRecord, desiredVolumes []v1.UniqueVolumeName) (desired, undesired []PendingOperationRecord) {
+	isDesired := make(map[v1.UniqueVolumeName]bool, len(desiredVolumes))
+	for _, volumeName := range desiredVolumes {
+		isDesired[volumeName] = true
+	}
+	for _, record := range records {
+		switch {
+		case record.VolumeName == "":
+			continue
+		case isDesired[record.VolumeName]:
+			desired = append(desired, record)
+		default:
+			undesired = append(undesired, record)
+		}
+	}
+	return desired, undesired
+}
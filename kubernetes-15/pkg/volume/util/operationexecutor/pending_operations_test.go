@@ -0,0 +1,212 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operationexecutor
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/util/clock"
+	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/api/v1"
+)
+
+func TestOperationExecutor_SnapshotPending(t *testing.T) {
+	// Arrange
+	ch, quit := make(chan interface{}), make(chan interface{})
+	fakeClock := clock.NewFakeClock(time.Now())
+	oe := NewOperationExecutor(
+		newFakeOperationGenerator(ch, quit),
+		WithClock(fakeClock))
+	detachStart := fakeClock.Now()
+	if err := oe.DetachVolume(AttachedVolume{VolumeName: "pd-volume-b", NodeName: "node"}, false /* verifySafeToDetach */, nil /* actualStateOfWorld */); err != nil {
+		t.Fatalf("DetachVolume failed: %v", err)
+	}
+	waitForOperationToStart(t, ch)
+	fakeClock.Step(time.Second)
+	attachStart := fakeClock.Now()
+	if err := oe.AttachVolume(VolumeToAttach{VolumeName: "pd-volume-a", NodeName: "node"}, nil /* actualStateOfWorld */); err != nil {
+		t.Fatalf("AttachVolume failed: %v", err)
+	}
+	waitForOperationToStart(t, ch)
+
+	// Act
+	records := oe.SnapshotPending()
+
+	// Assert
+	expected := []PendingOperationRecord{
+		{OperationName: "AttachVolume", VolumeName: "pd-volume-a", StartTime: attachStart},
+		{OperationName: "DetachVolume", VolumeName: "pd-volume-b", StartTime: detachStart},
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("expected snapshot %+v, got %+v", expected, records)
+	}
+	data, err := json.Marshal(records)
+	if err != nil {
+		t.Fatalf("failed to serialize the snapshot: %v", err)
+	}
+	var restored []PendingOperationRecord
+	if err := json.Unmarshal(data, &restored); err != nil {
+		t.Fatalf("failed to deserialize the snapshot: %v", err)
+	}
+	if len(restored) != len(records) {
+		t.Fatalf("expected %d records after deserializing, got %+v", len(records), restored)
+	}
+	for i := range restored {
+		if restored[i].OperationName != records[i].OperationName ||
+			restored[i].VolumeName != records[i].VolumeName ||
+			!restored[i].StartTime.Equal(records[i].StartTime) {
+			t.Errorf("expected record %+v after deserializing, got %+v", records[i], restored[i])
+		}
+	}
+
+	close(quit)
+	waitForOperationToComplete(t, oe, "pd-volume-a", "" /* podName */)
+	waitForOperationToComplete(t, oe, "pd-volume-b", "" /* podName */)
+	if records := oe.SnapshotPending(); len(records) != 0 {
+		t.Errorf("expected an empty snapshot after the operations completed, got %+v", records)
+	}
+}
+
+func TestOperationExecutor_StaleOperations(t *testing.T) {
+	// Arrange
+	ch, quit := make(chan interface{}), make(chan interface{})
+	fakeClock := clock.NewFakeClock(time.Now())
+	oe := NewOperationExecutor(
+		newFakeOperationGenerator(ch, quit),
+		WithClock(fakeClock))
+	oldStart := fakeClock.Now()
+	if err := oe.DetachVolume(AttachedVolume{VolumeName: "pd-volume-old", NodeName: "node"}, false /* verifySafeToDetach */, nil /* actualStateOfWorld */); err != nil {
+		t.Fatalf("DetachVolume failed: %v", err)
+	}
+	waitForOperationToStart(t, ch)
+	fakeClock.Step(10 * time.Minute)
+	if err := oe.AttachVolume(VolumeToAttach{VolumeName: "pd-volume-new", NodeName: "node"}, nil /* actualStateOfWorld */); err != nil {
+		t.Fatalf("AttachVolume failed: %v", err)
+	}
+	waitForOperationToStart(t, ch)
+	fakeClock.Step(time.Minute)
+
+	// Act
+	stale := oe.StaleOperations(5 * time.Minute)
+
+	// Assert
+	expected := []PendingOperationRecord{
+		{OperationName: "DetachVolume", VolumeName: "pd-volume-old", StartTime: oldStart},
+	}
+	if !reflect.DeepEqual(stale, expected) {
+		t.Errorf("expected stale operations %+v, got %+v", expected, stale)
+	}
+
+	close(quit)
+	waitForOperationToComplete(t, oe, "pd-volume-old", "" /* podName */)
+	waitForOperationToComplete(t, oe, "pd-volume-new", "" /* podName */)
+	if stale := oe.StaleOperations(0); len(stale) != 0 {
+		t.Errorf("expected no stale operations after the operations completed, got %+v", stale)
+	}
+}
+
+func TestOperationExecutor_StaleOperationsIgnoresMountsWaitingForSlot(t *testing.T) {
+	// Arrange
+	ch, quit := make(chan interface{}), make(chan interface{})
+	fakeClock := clock.NewFakeClock(time.Now())
+	oe := NewOperationExecutor(
+		newFakeOperationGenerator(ch, quit),
+		WithClock(fakeClock),
+		WithMaxConcurrentMounts(1))
+	runningMount := VolumeToMount{
+		Pod:                getTestPodWithGCEPD("pod-1", "pd-volume-running"),
+		VolumeName:         "pd-volume-running",
+		PluginIsAttachable: true,
+	}
+	waitingMount := VolumeToMount{
+		Pod:                getTestPodWithGCEPD("pod-2", "pd-volume-waiting"),
+		VolumeName:         "pd-volume-waiting",
+		PluginIsAttachable: true,
+	}
+	runningStart := fakeClock.Now()
+	if err := oe.MountVolume(0 /* waitForAttachTimeOut */, runningMount, nil /* actualStateOfWorldMounterUpdater */); err != nil {
+		t.Fatalf("MountVolume failed: %v", err)
+	}
+	waitForOperationToStart(t, ch)
+	if err := oe.MountVolume(0 /* waitForAttachTimeOut */, waitingMount, nil /* actualStateOfWorldMounterUpdater */); err != nil {
+		t.Fatalf("MountVolume failed: %v", err)
+	}
+	fakeClock.Step(10 * time.Minute)
+
+	// Act
+	stale := oe.StaleOperations(5 * time.Minute)
+
+	// Assert
+	expected := []PendingOperationRecord{
+		{OperationName: "MountVolume", VolumeName: "pd-volume-running", StartTime: runningStart},
+	}
+	if !reflect.DeepEqual(stale, expected) {
+		t.Errorf("expected stale operations %+v, got %+v", expected, stale)
+	}
+
+	// The waiting mount starts once the running one completed.
+	close(quit)
+	waitForOperationToStart(t, ch)
+	waitForOperationToComplete(t, oe, "pd-volume-running", "" /* podName */)
+	waitForOperationToComplete(t, oe, "pd-volume-waiting", "" /* podName */)
+}
+
+func waitForOperationToStart(t *testing.T, ch <-chan interface{}) {
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected an operation to start")
+	}
+}
+
+func TestPartitionPendingOperations(t *testing.T) {
+	records := []PendingOperationRecord{
+		{OperationName: "MountVolume", VolumeName: "pd-volume-a"},
+		{OperationName: "UnmountVolume", VolumeName: "pd-volume-b", PodName: "pod-uid"},
+		{OperationName: "VerifyVolumesAreAttached"},
+		{OperationName: "UnmountDevice", VolumeName: "pd-volume-a"},
+	}
+	testCases := map[string]struct {
+		desiredVolumes    []v1.UniqueVolumeName
+		expectedDesired   []PendingOperationRecord
+		expectedUndesired []PendingOperationRecord
+	}{
+		"no desired volumes": {
+			expectedUndesired: []PendingOperationRecord{records[0], records[1], records[3]},
+		},
+		"some desired volumes": {
+			desiredVolumes:    []v1.UniqueVolumeName{"pd-volume-a", "pd-volume-c"},
+			expectedDesired:   []PendingOperationRecord{records[0], records[3]},
+			expectedUndesired: []PendingOperationRecord{records[1]},
+		},
+		"all desired volumes": {
+			desiredVolumes:  []v1.UniqueVolumeName{"pd-volume-a", "pd-volume-b"},
+			expectedDesired: []PendingOperationRecord{records[0], records[1], records[3]},
+		},
+	}
+	for name, tc := range testCases {
+		desired, undesired := PartitionPendingOperations(records, tc.desiredVolumes)
+		if !reflect.DeepEqual(desired, tc.expectedDesired) {
+			t.Errorf("%s: expected desired %+v, got %+v", name, tc.expectedDesired, desired)
+		}
+		if !reflect.DeepEqual(undesired, tc.expectedUndesired) {
+			t.Errorf("%s: expected undesired %+v, got %+v", name, tc.expectedUndesired, undesired)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operationexecutor
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/util/clock"
+	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/api/v1"
+	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/volume"
+)
+
+// PluginCircuitBreaker configures a circuit breaker per volume plugin that
+// stops starting operations on the volumes of a plugin that keeps failing,
+// e.g. during an outage of the cloud API behind it.
+type PluginCircuitBreaker struct {
+	// FailureThreshold is the number of operations of a plugin failing in a
+	// row after which the circuit breaker of the plugin opens.
+	FailureThreshold int
+
+	// Cooldown is how long new operations of the plugin are rejected after
+	// its circuit breaker opened. After it, a single trial operation is
+	// started. The circuit breaker closes if the trial succeeds and opens
+	// again if it fails.
+	Cooldown time.Duration
+}
+
+// validate returns an error if the circuit breaker would open on the first
+// failure or never close.
+func (b PluginCircuitBreaker) validate() error {
+	if b.FailureThreshold <= 0 {
+		return fmt.Errorf("plugin circuit breaker failure threshold must be positive, got %d", b.FailureThreshold)
+	}
+	if b.Cooldown < 0 {
+		return fmt.Errorf("plugin circuit breaker cooldown must not be negative, got %v", b.Cooldown)
+	}
+	return nil
+}
+
+// pluginCircuitBreakerOperations are the operations guarded by the circuit
+// breaker of their plugin. The other operations also fail when the plugin
+// works, e.g. VerifyControllerAttachedVolume until the volume is attached,
+// DetachVolume while the volume is still in use and UnmountDevice while the
+// device still is, so their failures would open the breaker for nothing.
+var pluginCircuitBreakerOperations = sets.NewString("AttachVolume", "MountVolume", "UnmountVolume")
+
+// pluginCircuitBreakers tracks the consecutive failures of the operations
+// per plugin and rejects operations of the plugins whose circuit is open.
+type pluginCircuitBreakers struct {
+	PluginCircuitBreaker
+
+	clock clock.Clock
+
+	lock     sync.Mutex
+	circuits map[string]*pluginCircuit
+}
+
+type pluginCircuit struct {
+	consecutiveFailures int
+	open                bool
+	openedTime          time.Time
+	trialStarted        bool
+}
+
+func newPluginCircuitBreakers(config PluginCircuitBreaker) *pluginCircuitBreakers {
+	return &pluginCircuitBreakers{
+		PluginCircuitBreaker: config,
+		clock:                clock.RealClock{},
+		circuits:             make(map[string]*pluginCircuit),
+	}
+}
+
+// allow returns an error if the circuit of pluginName is open and its
+// cooldown has not passed yet or its trial operation was started already.
+// Otherwise it returns whether the operation is the trial operation, which
+// must be released if it does not run after all.
+func (b *pluginCircuitBreakers) allow(operationName, pluginName string) (bool, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	circuit, exists := b.circuits[pluginName]
+	if !exists || !circuit.open {
+		return false, nil
+	}
+	retryTime := circuit.openedTime.Add(b.Cooldown)
+	if circuit.trialStarted || b.clock.Now().Before(retryTime) {
+		return false, newPluginCircuitOpenError(operationName, pluginName, retryTime)
+	}
+	circuit.trialStarted = true
+	return true, nil
+}
+
+// release lets another operation of pluginName be the trial operation after
+// the trial operation permitted by allow was not started.
+func (b *pluginCircuitBreakers) release(pluginName string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if circuit, exists := b.circuits[pluginName]; exists {
+		circuit.trialStarted = false
+	}
+}
+
+// wrap returns a function that runs operation and updates the circuit of
+// pluginName with its result.
+func (b *pluginCircuitBreakers) wrap(pluginName string, trial bool, operation func() error) func() error {
+	return func() error {
+		err := operation()
+
+		b.lock.Lock()
+		defer b.lock.Unlock()
+		if err == nil {
+			delete(b.circuits, pluginName)
+			return nil
+		}
+		circuit, exists := b.circuits[pluginName]
+		if !exists {
+			circuit = &pluginCircuit{}
+			b.circuits[pluginName] = circuit
+		}
+		if IsOperationCancelledError(err) {
+			// The operation did not run, so it did not fail either.
+			if trial {
+				circuit.trialStarted = false
+			}
+			return err
+		}
+		circuit.consecutiveFailures++
+		if trial || circuit.consecutiveFailures >= b.FailureThreshold {
+			if !circuit.open {
+				glog.Warningf("Opening the circuit breaker of volume plugin %q after %d failed operations in a row", pluginName, circuit.consecutiveFailures)
+			}
+			circuit.open = true
+			circuit.openedTime = b.clock.Now()
+			if trial {
+				circuit.trialStarted = false
+			}
+		}
+		return err
+	}
+}
+
+// pluginNameOfVolume returns the name of the plugin of the volume with the
+// unique name volumeName, which is the plugin name followed by a slash and
+// the name of the volume. Plugin names may contain
+// slashes themselves, so the shortest prefix of volumeName ending before a
+// slash that is the name of a plugin of pluginMgr is used. Without a match,
+// the part before the last slash is used.
+func pluginNameOfVolume(pluginMgr *volume.VolumePluginMgr, volumeName v1.UniqueVolumeName) string {
+	name := string(volumeName)
+	if pluginMgr != nil {
+		for i := strings.Index(name, "/"); i >= 0; {
+			if plugin, err := pluginMgr.FindPluginByName(name[:i]); err == nil && plugin != nil {
+				return name[:i]
+			}
+			next := strings.Index(name[i+1:], "/")
+			if next < 0 {
+				break
+			}
+			i += next + 1
+		}
+	}
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		return name[:i]
+	}
+	return name
+}
+
+// pluginCircuitOpenError is returned for operations that were not started
+// because the circuit breaker of their plugin is open.
+type pluginCircuitOpenError struct {
+	operationName string
+	pluginName    string
+	retryTime     time.Time
+}
+
+var _ error = pluginCircuitOpenError{}
+
+func (err pluginCircuitOpenError) Error() string {
+	return fmt.Sprintf(
+		"%s was not started because the circuit breaker of volume plugin %q is open. No operations permitted until %v",
+		err.operationName,
+		err.pluginName,
+		err.retryTime)
+}
+
+// newPluginCircuitOpenError returns a new instance of pluginCircuitOpenError.
+func newPluginCircuitOpenError(operationName, pluginName string, retryTime time.Time) error {
+	return pluginCircuitOpenError{
+		operationName: operationName,
+		pluginName:    pluginName,
+		retryTime:     retryTime,
+	}
+}
+
+// IsPluginCircuitOpenError returns true if an error returned from
+// OperationExecutor is a pluginCircuitOpenError.
+func IsPluginCircuitOpenError(err error) bool {
+	_, ok := err.(pluginCircuitOpenError)
+	return ok
+}
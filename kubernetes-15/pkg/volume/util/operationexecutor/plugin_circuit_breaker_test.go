@@ -0,0 +1,163 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operationexecutor
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/util/clock"
+	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/api/v1"
+)
+
+func TestOperationExecutor_PluginCircuitBreaker(t *testing.T) {
+	// Arrange
+	generator := newFakeOperationGenerator(nil /* ch */, nil /* quit */)
+	fakeClock := clock.NewFakeClock(time.Now())
+	oe := NewOperationExecutor(generator, WithRetryPolicy(&giveUpAfterRetryPolicy{maxAttempts: 100}),
+		WithClock(fakeClock),
+		WithPluginCircuitBreaker(PluginCircuitBreaker{FailureThreshold: 2, Cooldown: time.Minute}))
+	attachVolume := func(volumeName string) error {
+		volumeToAttach := VolumeToAttach{VolumeName: v1.UniqueVolumeName(volumeName), NodeName: "node"}
+		err := oe.AttachVolume(volumeToAttach, nil /* actualStateOfWorld */)
+		if err == nil {
+			waitForOperationToComplete(t, oe, volumeToAttach.VolumeName, "" /* podName */)
+		}
+		return err
+	}
+	generator.setErr("AttachVolume", fmt.Errorf("cloud API unavailable"))
+
+	// Act & Assert: the circuit opens after two failures in a row
+	for i := 0; i < 2; i++ {
+		if err := attachVolume("fake-plugin/pd-volume"); err != nil {
+			t.Fatalf("AttachVolume attempt %d failed: %v", i+1, err)
+		}
+	}
+	if err := attachVolume("fake-plugin/other-volume"); !IsPluginCircuitOpenError(err) {
+		t.Errorf("expected AttachVolume to be rejected by the open circuit of the plugin, got %v", err)
+	}
+	if err := attachVolume("other-plugin/pd-volume"); err != nil {
+		t.Errorf("expected AttachVolume of another plugin not to be rejected, got %v", err)
+	}
+
+	// the circuit stays open for the cooldown
+	fakeClock.Step(time.Minute - time.Second)
+	if err := attachVolume("fake-plugin/pd-volume"); !IsPluginCircuitOpenError(err) {
+		t.Errorf("expected AttachVolume to be rejected during the cooldown, got %v", err)
+	}
+
+	// a failed trial opens the circuit again
+	fakeClock.Step(time.Second)
+	if err := attachVolume("fake-plugin/pd-volume"); err != nil {
+		t.Errorf("expected a trial AttachVolume after the cooldown, got %v", err)
+	}
+	if err := attachVolume("fake-plugin/pd-volume"); !IsPluginCircuitOpenError(err) {
+		t.Errorf("expected AttachVolume to be rejected after the trial failed, got %v", err)
+	}
+
+	// a successful trial closes the circuit
+	generator.setErr("AttachVolume", nil)
+	fakeClock.Step(time.Minute)
+	for i := 0; i < 3; i++ {
+		if err := attachVolume("fake-plugin/pd-volume"); err != nil {
+			t.Errorf("expected AttachVolume attempt %d after a successful trial to be permitted, got %v", i+1, err)
+		}
+	}
+}
+
+func TestOperationExecutor_PluginCircuitBreakerIgnoresExpectedFailures(t *testing.T) {
+	// Arrange
+	generator := newFakeOperationGenerator(nil /* ch */, nil /* quit */)
+	oe := NewOperationExecutor(generator, WithRetryPolicy(&giveUpAfterRetryPolicy{maxAttempts: 100}),
+		WithPluginCircuitBreaker(PluginCircuitBreaker{FailureThreshold: 1, Cooldown: time.Minute})).(*operationExecutor)
+	generator.setErr("VerifyControllerAttachedVolume", fmt.Errorf("volume is not yet attached according to node status"))
+	generator.setErr("DetachVolume", fmt.Errorf("volume is still in use"))
+	generator.setErr("UnmountDevice", fmt.Errorf("device is in use"))
+	volumeName := v1.UniqueVolumeName("fake-plugin/pd-volume")
+
+	// Act
+	if err := oe.VerifyControllerAttachedVolume(VolumeToMount{VolumeName: volumeName, Pod: getTestPodWithGCEPD("pod1", "pd-volume")}, "node", nil /* actualStateOfWorld */); err != nil {
+		t.Fatalf("VerifyControllerAttachedVolume failed: %v", err)
+	}
+	waitForOperationToComplete(t, oe, volumeName, "" /* podName */)
+	if err := oe.DetachVolume(AttachedVolume{VolumeName: volumeName, NodeName: "node"}, true /* verifySafeToDetach */, nil /* actualStateOfWorld */); err != nil {
+		t.Fatalf("DetachVolume failed: %v", err)
+	}
+	waitForOperationToComplete(t, oe, volumeName, "" /* podName */)
+	if err := oe.UnmountDevice(AttachedVolume{VolumeName: volumeName, NodeName: "node"}, nil /* actualStateOfWorld */, nil /* mounter */); err != nil {
+		t.Fatalf("UnmountDevice failed: %v", err)
+	}
+	waitForOperationToComplete(t, oe, volumeName, "" /* podName */)
+
+	// Assert
+	if _, err := oe.pluginCircuitBreakers.allow("MountVolume", "fake-plugin"); err != nil {
+		t.Errorf("expected the circuit of the plugin to stay closed, got %v", err)
+	}
+}
+
+func TestWithPluginCircuitBreaker_IgnoresInvalidBreaker(t *testing.T) {
+	for _, breaker := range []PluginCircuitBreaker{
+		{FailureThreshold: 0, Cooldown: time.Minute},
+		{FailureThreshold: -1, Cooldown: time.Minute},
+		{FailureThreshold: 1, Cooldown: -time.Minute},
+	} {
+		oe := NewOperationExecutor(newFakeOperationGenerator(nil /* ch */, nil /* quit */),
+			WithPluginCircuitBreaker(breaker)).(*operationExecutor)
+		if oe.pluginCircuitBreakers != nil {
+			t.Errorf("expected the invalid breaker %+v not to be used", breaker)
+		}
+	}
+}
+
+func TestPluginCircuitBreakers_SingleTrial(t *testing.T) {
+	// Arrange
+	breakers := newPluginCircuitBreakers(PluginCircuitBreaker{FailureThreshold: 1, Cooldown: time.Minute})
+	fakeClock := clock.NewFakeClock(time.Now())
+	breakers.clock = fakeClock
+	fail := func() error { return fmt.Errorf("failed") }
+	breakers.wrap("plugin", false /* trial */, fail)()
+	fakeClock.Step(time.Minute)
+
+	// Act & Assert: only one trial operation is permitted at a time
+	trial, err := breakers.allow("MountVolume", "plugin")
+	if err != nil || !trial {
+		t.Fatalf("expected a trial operation after the cooldown, got trial %v and error %v", trial, err)
+	}
+	if _, err := breakers.allow("MountVolume", "plugin"); !IsPluginCircuitOpenError(err) {
+		t.Errorf("expected a second operation to be rejected during the trial, got %v", err)
+	}
+
+	// a released trial permits another one
+	breakers.release("plugin")
+	if trial, err := breakers.allow("MountVolume", "plugin"); err != nil || !trial {
+		t.Errorf("expected another trial operation after the release, got trial %v and error %v", trial, err)
+	}
+}
+
+func TestPluginNameOfVolume(t *testing.T) {
+	tests := map[string]string{
+		"kubernetes.io/gce-pd/pd-volume": "kubernetes.io/gce-pd",
+		"fake-plugin/pd-volume":          "fake-plugin",
+		"fake-plugin":                    "fake-plugin",
+	}
+	for volumeName, expected := range tests {
+		if actual := pluginNameOfVolume(nil /* pluginMgr */, v1.UniqueVolumeName(volumeName)); actual != expected {
+			t.Errorf("expected plugin name %q for volume %q, got %q", expected, volumeName, actual)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operationexecutor
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/client-go/util/clock"
+	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/api/v1"
+	volumetypes "github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/volume/util/types"
+)
+
+// DefaultMountDeduplicationWindow is how long after a MountVolume operation
+// succeeded an identical MountVolume operation is skipped by default.
+const DefaultMountDeduplicationWindow = 1 * time.Second
+
+// recentSuccesses remembers the operations that succeeded within the last
+// window, so that reissuing one of them right away can be skipped.
+type recentSuccesses struct {
+	window time.Duration
+
+	clock clock.Clock
+
+	lock      sync.Mutex
+	succeeded map[operationKey]time.Time
+}
+
+func newRecentSuccesses(window time.Duration, clock clock.Clock) *recentSuccesses {
+	return &recentSuccesses{
+		window:    window,
+		clock:     clock,
+		succeeded: make(map[operationKey]time.Time),
+	}
+}
+
+// succeededRecently returns true if the operation on volumeName and podName
+// succeeded less than the window ago.
+func (r *recentSuccesses) succeededRecently(volumeName v1.UniqueVolumeName, podName volumetypes.UniquePodName) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	key := operationKey{volumeName, podName}
+	succeeded, exists := r.succeeded[key]
+	if !exists {
+		return false
+	}
+	if r.clock.Since(succeeded) >= r.window {
+		delete(r.succeeded, key)
+		return false
+	}
+	return true
+}
+
+// forget drops the success of the operation on volumeName and podName, e.g.
+// once an operation undoing it was issued.
+func (r *recentSuccesses) forget(volumeName v1.UniqueVolumeName, podName volumetypes.UniquePodName) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.succeeded, operationKey{volumeName, podName})
+}
+
+// wrap returns a function that runs operation and remembers when it
+// succeeded for volumeName and podName.
+func (r *recentSuccesses) wrap(volumeName v1.UniqueVolumeName, podName volumetypes.UniquePodName, operation func() error) func() error {
+	return func() error {
+		if err := operation(); err != nil {
+			return err
+		}
+
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		now := r.clock.Now()
+		for key, succeeded := range r.succeeded {
+			if now.Sub(succeeded) >= r.window {
+				delete(r.succeeded, key)
+			}
+		}
+		r.succeeded[operationKey{volumeName, podName}] = now
+		return nil
+	}
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operationexecutor
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/api/v1"
+)
+
+// RetryPolicy decides whether and when a failed operation is retried.
+type RetryPolicy interface {
+	// NextBackoff is called after an operation failed attempt times in a
+	// row, the last time with err. It returns the time to wait before the
+	// operation may run again, or false to give up on it. Operations that
+	// were given up on start over after failureExpiry.
+	NextBackoff(attempt int, err error) (time.Duration, bool)
+}
+
+// newRetryPolicyBackoff returns a backoff that retries failed operations as
+// policy permits.
+func newRetryPolicyBackoff(policy RetryPolicy) *operationBackoff {
+	return newOperationBackoffFunc(func(attempts int, _ time.Duration, err error) (time.Duration, bool) {
+		return policy.NextBackoff(attempts, err)
+	})
+}
+
+// retriesExhaustedError is returned when an operation is rejected because
+// the retry policy gave up on it.
+type retriesExhaustedError struct {
+	operationName string
+	volumeName    v1.UniqueVolumeName
+	attempts      int
+	retryTime     time.Time
+}
+
+var _ error = retriesExhaustedError{}
+
+func (err retriesExhaustedError) Error() string {
+	return fmt.Sprintf(
+		"%s for volume %q failed %d times. The retry policy permits no retries until %v",
+		err.operationName,
+		err.volumeName,
+		err.attempts,
+		err.retryTime)
+}
+
+// newRetriesExhaustedError returns a new instance of retriesExhaustedError.
+func newRetriesExhaustedError(operationName string, volumeName v1.UniqueVolumeName, attempts int, retryTime time.Time) error {
+	return retriesExhaustedError{
+		operationName: operationName,
+		volumeName:    volumeName,
+		attempts:      attempts,
+		retryTime:     retryTime,
+	}
+}
+
+// IsRetriesExhaustedError returns true if an error returned from
+// OperationExecutor is a retriesExhaustedError.
+func IsRetriesExhaustedError(err error) bool {
+	_, ok := err.(retriesExhaustedError)
+	return ok
+}
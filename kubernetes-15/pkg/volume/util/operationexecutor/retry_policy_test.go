@@ -0,0 +1,174 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operationexecutor
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/util/clock"
+)
+
+// giveUpAfterRetryPolicy retries failed operations after delay, immediately
+// by default, until they failed maxAttempts times.
+type giveUpAfterRetryPolicy struct {
+	maxAttempts int
+	delay       time.Duration
+	errs        []error
+}
+
+func (p *giveUpAfterRetryPolicy) NextBackoff(attempt int, err error) (time.Duration, bool) {
+	p.errs = append(p.errs, err)
+	return p.delay, attempt < p.maxAttempts
+}
+
+// delaysRetryPolicy waits delays[attempt-1] before retrying and keeps using
+// the last delay once all have been used.
+type delaysRetryPolicy struct {
+	delays   []time.Duration
+	attempts []int
+}
+
+func (p *delaysRetryPolicy) NextBackoff(attempt int, err error) (time.Duration, bool) {
+	p.attempts = append(p.attempts, attempt)
+	if attempt > len(p.delays) {
+		return p.delays[len(p.delays)-1], true
+	}
+	return p.delays[attempt-1], true
+}
+
+func TestOperationExecutor_RetryPolicyGivesUpAfterThreeAttempts(t *testing.T) {
+	// Arrange
+	generator := newFailingUnmountOperationGenerator()
+	policy := &giveUpAfterRetryPolicy{maxAttempts: 3}
+	oe := NewOperationExecutor(generator, WithRetryPolicy(policy))
+	deviceToDetach := AttachedVolume{VolumeName: "fake-plugin/pd-volume", NodeName: "node1"}
+
+	// Act: fail the operation until the policy gives up
+	for i := 0; i < 3; i++ {
+		if err := oe.UnmountDevice(deviceToDetach, nil /* actualStateOfWorld */, nil /* mounter */); err != nil {
+			t.Fatalf("UnmountDevice attempt %d failed: %v", i+1, err)
+		}
+		waitForOperationToComplete(t, oe, deviceToDetach.VolumeName, "" /* podName */)
+	}
+
+	// Assert
+	if err := oe.UnmountDevice(deviceToDetach, nil /* actualStateOfWorld */, nil /* mounter */); !IsRetriesExhaustedError(err) {
+		t.Errorf("expected UnmountDevice to be rejected after 3 attempts, got %v", err)
+	}
+	if len(policy.errs) != 3 || policy.errs[2] == nil || policy.errs[2].Error() != "device busy" {
+		t.Errorf("expected the policy to be called with the 3 operation errors, got %v", policy.errs)
+	}
+}
+
+func TestOperationExecutor_RetryPolicyCustomDelays(t *testing.T) {
+	// Arrange
+	policy := &delaysRetryPolicy{delays: []time.Duration{time.Minute, 5 * time.Minute}}
+	oe := NewOperationExecutor(newFailingUnmountOperationGenerator(), WithRetryPolicy(policy)).(*operationExecutor)
+	fakeClock := clock.NewFakeClock(time.Now())
+	oe.retries.clock = fakeClock
+	deviceToDetach := AttachedVolume{VolumeName: "fake-plugin/pd-volume", NodeName: "node1"}
+	unmountDevice := func() error {
+		return oe.UnmountDevice(deviceToDetach, nil /* actualStateOfWorld */, nil /* mounter */)
+	}
+
+	// Act & Assert: the first retry waits for the first delay
+	if err := unmountDevice(); err != nil {
+		t.Fatalf("UnmountDevice failed: %v", err)
+	}
+	waitForOperationToComplete(t, oe, deviceToDetach.VolumeName, "" /* podName */)
+	if err := unmountDevice(); !IsOperationBackoffError(err) {
+		t.Errorf("expected UnmountDevice to wait for the first delay, got %v", err)
+	}
+	fakeClock.Step(time.Minute)
+	if err := unmountDevice(); err != nil {
+		t.Fatalf("expected UnmountDevice to be permitted after the first delay, got %v", err)
+	}
+	waitForOperationToComplete(t, oe, deviceToDetach.VolumeName, "" /* podName */)
+
+	// the second retry waits for the second delay
+	fakeClock.Step(time.Minute)
+	if err := unmountDevice(); !IsOperationBackoffError(err) {
+		t.Errorf("expected UnmountDevice to wait for the second delay, got %v", err)
+	}
+	fakeClock.Step(4 * time.Minute)
+	if err := unmountDevice(); err != nil {
+		t.Errorf("expected UnmountDevice to be permitted after the second delay, got %v", err)
+	}
+	waitForOperationToComplete(t, oe, deviceToDetach.VolumeName, "" /* podName */)
+	if expected := []int{1, 2, 3}; !reflect.DeepEqual(policy.attempts, expected) {
+		t.Errorf("expected the policy to be called for attempts %v, got %v", expected, policy.attempts)
+	}
+}
+
+func TestOperationExecutor_RetryPolicyGiveUpExpires(t *testing.T) {
+	// Arrange
+	policy := &giveUpAfterRetryPolicy{maxAttempts: 1, delay: time.Minute}
+	oe := NewOperationExecutor(newFailingUnmountOperationGenerator(), WithRetryPolicy(policy)).(*operationExecutor)
+	fakeClock := clock.NewFakeClock(time.Now())
+	oe.retries.clock = fakeClock
+	deviceToDetach := AttachedVolume{VolumeName: "fake-plugin/pd-volume", NodeName: "node1"}
+	unmountDevice := func() error {
+		return oe.UnmountDevice(deviceToDetach, nil /* actualStateOfWorld */, nil /* mounter */)
+	}
+	if err := unmountDevice(); err != nil {
+		t.Fatalf("UnmountDevice failed: %v", err)
+	}
+	waitForOperationToComplete(t, oe, deviceToDetach.VolumeName, "" /* podName */)
+
+	// Act & Assert: the operation is rejected until the reported retry time
+	err := unmountDevice()
+	exhausted, ok := err.(retriesExhaustedError)
+	if !ok {
+		t.Fatalf("expected UnmountDevice to be rejected after the policy gave up, got %v", err)
+	}
+	fakeClock.Step(exhausted.retryTime.Sub(fakeClock.Now()))
+	if err := unmountDevice(); !IsRetriesExhaustedError(err) {
+		t.Errorf("expected UnmountDevice to be rejected until %v, got %v", exhausted.retryTime, err)
+	}
+	fakeClock.Step(time.Second)
+	if err := unmountDevice(); err != nil {
+		t.Errorf("expected UnmountDevice to be permitted once giving up expired, got %v", err)
+	}
+	waitForOperationToComplete(t, oe, deviceToDetach.VolumeName, "" /* podName */)
+	if len(policy.errs) != 2 {
+		t.Errorf("expected the policy to be called for 2 failures, got %v", policy.errs)
+	}
+}
+
+func TestOperationBackoff_PrunesExpiredFailures(t *testing.T) {
+	// Arrange
+	backoff := newOperationBackoff(OperationBackoff{InitialDelay: time.Second, MaxDelay: time.Minute})
+	fakeClock := clock.NewFakeClock(time.Now())
+	backoff.clock = fakeClock
+	fail := func() error { return errors.New("device busy") }
+	backoff.wrap("fake-plugin/volume1", "" /* podName */, fail)()
+
+	// Act
+	fakeClock.Step(time.Second + failureExpiry + time.Second)
+	backoff.wrap("fake-plugin/volume2", "" /* podName */, fail)()
+
+	// Assert
+	if _, exists := backoff.failures[operationKey{volumeName: "fake-plugin/volume1"}]; exists {
+		t.Errorf("expected the expired failure of volume1 to be pruned")
+	}
+	if len(backoff.failures) != 1 {
+		t.Errorf("expected only the failure of volume2 to be kept, got %d failures", len(backoff.failures))
+	}
+}
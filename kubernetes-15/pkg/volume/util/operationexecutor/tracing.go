@@ -0,0 +1,101 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operationexecutor
+
+import (
+	"k8s.io/apimachinery/pkg/types"
+	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/api/v1"
+	volumetypes "github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/volume/util/types"
+)
+
+// The tags set on the span of an operation. Tags that do not apply to an
+// operation, e.g. the pod of an AttachVolume operation, are not set.
+const (
+	// SpanTagOperation is the type of the operation, e.g. "MountVolume".
+	SpanTagOperation = "operation"
+	// SpanTagVolume is the unique name of the volume.
+	SpanTagVolume = "volume"
+	// SpanTagNode is the name of the node.
+	SpanTagNode = "node"
+	// SpanTagPod is the unique name of the pod.
+	SpanTagPod = "pod"
+	// SpanTagError is set to true if the operation failed.
+	SpanTagError = "error"
+	// SpanTagErrorMessage is the error the operation failed with.
+	SpanTagErrorMessage = "error.message"
+)
+
+// Tracer starts a span for every operation the executor runs. It follows the
+// OpenTracing API, so that an OpenTracing tracer is easily adapted to it.
+type Tracer interface {
+	// StartSpan starts a span named after the type of the operation.
+	StartSpan(operationName string) Span
+}
+
+// Span is the span of a single operation.
+type Span interface {
+	// SetTag sets a tag on the span.
+	SetTag(key string, value interface{})
+	// Finish ends the span.
+	Finish()
+}
+
+// noopTracer is the Tracer used if none is set, its spans record nothing.
+type noopTracer struct{}
+
+func (noopTracer) StartSpan(operationName string) Span {
+	return noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetTag(key string, value interface{}) {}
+
+func (noopSpan) Finish() {}
+
+// traceOperation returns a function that runs operation in a span of tracer
+// tagged with the given volume, node and pod, each if not empty, and with the
+// error status of operation.
+func traceOperation(
+	tracer Tracer,
+	operationName string,
+	volumeName v1.UniqueVolumeName,
+	nodeName types.NodeName,
+	podName volumetypes.UniquePodName,
+	operation func() error) func() error {
+	return func() error {
+		span := tracer.StartSpan(operationName)
+		defer span.Finish()
+		span.SetTag(SpanTagOperation, operationName)
+		if volumeName != "" {
+			span.SetTag(SpanTagVolume, string(volumeName))
+		}
+		if nodeName != "" {
+			span.SetTag(SpanTagNode, string(nodeName))
+		}
+		if podName != "" {
+			span.SetTag(SpanTagPod, string(podName))
+		}
+
+		err := operation()
+		if err != nil {
+			span.SetTag(SpanTagError, true)
+			span.SetTag(SpanTagErrorMessage, err.Error())
+		}
+		return err
+	}
+}
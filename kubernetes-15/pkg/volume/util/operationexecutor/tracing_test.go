@@ -0,0 +1,150 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operationexecutor
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/api/v1"
+	volumetypes "github.com/sourcegraph/monorepo-test-1/kubernetes-15/pkg/volume/util/types"
+)
+
+// fakeTracer records the spans it started.
+type fakeTracer struct {
+	lock  sync.Mutex
+	spans []*fakeSpan
+}
+
+func (t *fakeTracer) StartSpan(operationName string) Span {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	span := &fakeSpan{operationName: operationName, tags: map[string]interface{}{}}
+	t.spans = append(t.spans, span)
+	return span
+}
+
+func (t *fakeTracer) getSpans() []*fakeSpan {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return append([]*fakeSpan(nil), t.spans...)
+}
+
+type fakeSpan struct {
+	operationName string
+	tags          map[string]interface{}
+	finished      bool
+}
+
+func (s *fakeSpan) SetTag(key string, value interface{}) {
+	s.tags[key] = value
+}
+
+func (s *fakeSpan) Finish() {
+	s.finished = true
+}
+
+func TestOperationExecutor_TracesOperations(t *testing.T) {
+	// Arrange
+	tracer := &fakeTracer{}
+	oe := NewOperationExecutor(
+		newFailingUnmountOperationGenerator(),
+		WithTracer(tracer))
+	pod := getTestPodWithGCEPD("pod1", "pd-volume")
+	deviceToDetach := AttachedVolume{VolumeName: "fake-plugin/pd-volume", NodeName: "node1"}
+	volumeToUnmount := MountedVolume{PodName: volumetypes.UniquePodName(pod.UID), PodUID: pod.UID, VolumeName: "fake-plugin/pd-volume"}
+
+	// Act
+	if err := oe.UnmountVolume(volumeToUnmount, nil /* actualStateOfWorld */); err != nil {
+		t.Fatalf("UnmountVolume failed: %v", err)
+	}
+	waitForOperationToComplete(t, oe, volumeToUnmount.VolumeName, volumeToUnmount.PodName)
+	if err := oe.UnmountDevice(deviceToDetach, nil /* actualStateOfWorld */, nil /* mounter */); err != nil {
+		t.Fatalf("UnmountDevice failed: %v", err)
+	}
+	waitForOperationToComplete(t, oe, deviceToDetach.VolumeName, "" /* podName */)
+
+	// Assert
+	expected := []*fakeSpan{
+		{
+			operationName: "UnmountVolume",
+			tags: map[string]interface{}{
+				SpanTagOperation:    "UnmountVolume",
+				SpanTagVolume:       "fake-plugin/pd-volume",
+				SpanTagPod:          string(pod.UID),
+				SpanTagError:        true,
+				SpanTagErrorMessage: "volume busy",
+			},
+			finished: true,
+		},
+		{
+			operationName: "UnmountDevice",
+			tags: map[string]interface{}{
+				SpanTagOperation:    "UnmountDevice",
+				SpanTagVolume:       "fake-plugin/pd-volume",
+				SpanTagNode:         "node1",
+				SpanTagError:        true,
+				SpanTagErrorMessage: "device busy",
+			},
+			finished: true,
+		},
+	}
+	if spans := tracer.getSpans(); !reflect.DeepEqual(spans, expected) {
+		t.Errorf("expected spans %+v, got %+v", expected, spans)
+	}
+}
+
+func TestOperationExecutor_TracesSuccessfulMountWithoutError(t *testing.T) {
+	// Arrange
+	tracer := &fakeTracer{}
+	generator := newFakeOperationGenerator(nil /* ch */, nil /* quit */)
+	generator.setErr("MountVolume", nil)
+	oe := NewOperationExecutor(
+		generator,
+		WithTracer(tracer))
+	pod := getTestPodWithGCEPD("pod1", "pd-volume")
+	pod.Spec.NodeName = "node1"
+	volumeToMount := VolumeToMount{
+		Pod:                pod,
+		VolumeName:         v1.UniqueVolumeName("pd-volume"),
+		PluginIsAttachable: true,
+	}
+
+	// Act
+	if err := oe.MountVolume(0 /* waitForAttachTimeOut */, volumeToMount, nil /* actualStateOfWorldMounterUpdater */); err != nil {
+		t.Fatalf("MountVolume failed: %v", err)
+	}
+	waitForOperationToComplete(t, oe, volumeToMount.VolumeName, "" /* podName */)
+
+	// Assert
+	expected := []*fakeSpan{
+		{
+			operationName: "MountVolume",
+			tags: map[string]interface{}{
+				SpanTagOperation: "MountVolume",
+				SpanTagVolume:    "pd-volume",
+				SpanTagNode:      "node1",
+				SpanTagPod:       string(pod.UID),
+			},
+			finished: true,
+		},
+	}
+	if spans := tracer.getSpans(); !reflect.DeepEqual(spans, expected) {
+		t.Errorf("expected spans %+v, got %+v", expected, spans)
+	}
+}
@@ -19,7 +19,9 @@ package main
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 
+	"github.com/spf13/cobra"
 	"github.com/spf13/cobra/doc"
 	"github.com/sourcegraph/monorepo-test-1/kubernetes-5/cmd/genutils"
 	apiservapp "github.com/sourcegraph/monorepo-test-1/kubernetes-5/cmd/kube-apiserver/app"
@@ -33,11 +35,16 @@ func main() {
 	// use os.Args instead of "flags" because "flags" will mess up the man pages!
 	path := ""
 	module := ""
-	if len(os.Args) == 3 {
-		path = os.Args[1]
-		module = os.Args[2]
+	format := "markdown"
+	args, includeHiddenFlags := extractIncludeHiddenFlags(os.Args[1:])
+	if len(args) == 2 || len(args) == 3 {
+		path = args[0]
+		module = args[1]
+		if len(args) == 3 {
+			format = args[2]
+		}
 	} else {
-		fmt.Fprintf(os.Stderr, "usage: %s [output directory] [module] \n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "usage: %s [output directory] [module] [format (markdown|json-flags)] [%s]\n", os.Args[0], includeHiddenFlagsArg)
 		os.Exit(1)
 	}
 
@@ -47,29 +54,41 @@ func main() {
 		os.Exit(1)
 	}
 
+	var cmd *cobra.Command
 	switch module {
 	case "kube-apiserver":
 		// generate docs for kube-apiserver
-		apiserver := apiservapp.NewAPIServerCommand()
-		doc.GenMarkdownTree(apiserver, outDir)
+		cmd = apiservapp.NewAPIServerCommand()
 	case "kube-controller-manager":
 		// generate docs for kube-controller-manager
-		controllermanager := cmapp.NewControllerManagerCommand()
-		doc.GenMarkdownTree(controllermanager, outDir)
+		cmd = cmapp.NewControllerManagerCommand()
 	case "kube-proxy":
 		// generate docs for kube-proxy
-		proxy := proxyapp.NewProxyCommand()
-		doc.GenMarkdownTree(proxy, outDir)
+		cmd = proxyapp.NewProxyCommand()
 	case "kube-scheduler":
 		// generate docs for kube-scheduler
-		scheduler := schapp.NewSchedulerCommand()
-		doc.GenMarkdownTree(scheduler, outDir)
+		cmd = schapp.NewSchedulerCommand()
 	case "kubelet":
 		// generate docs for kubelet
-		kubelet := kubeletapp.NewKubeletCommand()
-		doc.GenMarkdownTree(kubelet, outDir)
+		cmd = kubeletapp.NewKubeletCommand()
 	default:
 		fmt.Fprintf(os.Stderr, "Module %s is not supported", module)
 		os.Exit(1)
 	}
+
+	switch format {
+	case "markdown":
+		if includeHiddenFlags {
+			defer unhideFlags(cmd)()
+		}
+		doc.GenMarkdownTree(cmd, outDir)
+	case "json-flags":
+		if err := genJSONFlags(cmd, filepath.Join(outDir, module+".json")); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to generate json flags: %v\n", err)
+			os.Exit(1)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Format %s is not supported", format)
+		os.Exit(1)
+	}
 }
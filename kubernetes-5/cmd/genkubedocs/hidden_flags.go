@@ -0,0 +1,84 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// includeHiddenFlagsArg is the optional argument that makes genkubedocs
+// document hidden and deprecated flags too, e.g. for an internal reference.
+const includeHiddenFlagsArg = "--include-hidden-flags"
+
+// extractIncludeHiddenFlags returns args without includeHiddenFlagsArg and
+// whether it was part of them.
+func extractIncludeHiddenFlags(args []string) ([]string, bool) {
+	remaining := make([]string, 0, len(args))
+	found := false
+	for _, arg := range args {
+		if arg == includeHiddenFlagsArg {
+			found = true
+			continue
+		}
+		remaining = append(remaining, arg)
+	}
+	return remaining, found
+}
+
+// unhideFlags makes the hidden and deprecated flags of cmd and its
+// subcommands visible to the doc generators, which skip them otherwise. The
+// usage of deprecated flags is annotated with their deprecation message. The
+// returned function restores the flags.
+func unhideFlags(cmd *cobra.Command) (restore func()) {
+	type flagState struct {
+		hidden     bool
+		deprecated string
+		usage      string
+	}
+	saved := map[*pflag.Flag]flagState{}
+	unhide := func(flag *pflag.Flag) {
+		if _, seen := saved[flag]; seen || (!flag.Hidden && flag.Deprecated == "") {
+			return
+		}
+		saved[flag] = flagState{hidden: flag.Hidden, deprecated: flag.Deprecated, usage: flag.Usage}
+		if flag.Deprecated != "" {
+			flag.Usage = fmt.Sprintf("%s (DEPRECATED: %s)", flag.Usage, flag.Deprecated)
+		}
+		flag.Hidden = false
+		flag.Deprecated = ""
+	}
+	var visit func(*cobra.Command)
+	visit = func(c *cobra.Command) {
+		c.Flags().VisitAll(unhide)
+		c.PersistentFlags().VisitAll(unhide)
+		for _, sub := range c.Commands() {
+			visit(sub)
+		}
+	}
+	visit(cmd)
+
+	return func() {
+		for flag, state := range saved {
+			flag.Hidden = state.hidden
+			flag.Deprecated = state.deprecated
+			flag.Usage = state.usage
+		}
+	}
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/cobra/doc"
+)
+
+func newHiddenFlagsCommand() *cobra.Command {
+	cmd := &cobra.Command{Use: "test-command", Run: func(*cobra.Command, []string) {}}
+	cmd.Flags().String("visible-flag", "", "a visible flag")
+	cmd.Flags().String("hidden-flag", "", "a hidden flag")
+	cmd.Flags().MarkHidden("hidden-flag")
+	cmd.Flags().String("deprecated-flag", "", "a deprecated flag")
+	cmd.Flags().MarkDeprecated("deprecated-flag", "use --visible-flag instead")
+	return cmd
+}
+
+func genMarkdown(t *testing.T, cmd *cobra.Command) string {
+	dir, err := ioutil.TempDir("", "genkubedocs")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := doc.GenMarkdownTree(cmd, dir); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, cmd.Name()+".md"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return string(data)
+}
+
+func TestUnhideFlags(t *testing.T) {
+	cmd := newHiddenFlagsCommand()
+
+	output := genMarkdown(t, cmd)
+	if strings.Contains(output, "hidden-flag") || strings.Contains(output, "deprecated-flag") {
+		t.Errorf("expected hidden and deprecated flags to be left out by default, got:\n%s", output)
+	}
+
+	restore := unhideFlags(cmd)
+	output = genMarkdown(t, cmd)
+	for _, expected := range []string{"visible-flag", "hidden-flag", "deprecated-flag", "DEPRECATED: use --visible-flag instead"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected %q in output:\n%s", expected, output)
+		}
+	}
+
+	restore()
+	if flag := cmd.Flags().Lookup("hidden-flag"); !flag.Hidden {
+		t.Errorf("expected flag %q to be hidden again", flag.Name)
+	}
+	if flag := cmd.Flags().Lookup("deprecated-flag"); flag.Deprecated != "use --visible-flag instead" || flag.Usage != "a deprecated flag" {
+		t.Errorf("expected flag %q to be restored, got deprecated %q and usage %q", flag.Name, flag.Deprecated, flag.Usage)
+	}
+}
+
+func TestExtractIncludeHiddenFlags(t *testing.T) {
+	args, found := extractIncludeHiddenFlags([]string{"out", "kubelet", includeHiddenFlagsArg, "markdown"})
+	if !found {
+		t.Errorf("expected %q to be found", includeHiddenFlagsArg)
+	}
+	if strings.Join(args, " ") != "out kubelet markdown" {
+		t.Errorf("unexpected remaining args %v", args)
+	}
+
+	if _, found := extractIncludeHiddenFlags([]string{"out", "kubelet"}); found {
+		t.Errorf("expected %q not to be found", includeHiddenFlagsArg)
+	}
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// commandFlags describes the flags of a command and, recursively, of its
+// subcommands.
+type commandFlags struct {
+	Name        string         `json:"name"`
+	Flags       []flagInfo     `json:"flags"`
+	Subcommands []commandFlags `json:"subcommands,omitempty"`
+}
+
+// flagInfo describes a single flag.
+type flagInfo struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Default    string `json:"default"`
+	Usage      string `json:"usage"`
+	Deprecated string `json:"deprecated,omitempty"`
+}
+
+// genJSONFlags writes the flags of cmd and all of its subcommands to
+// filename as JSON.
+func genJSONFlags(cmd *cobra.Command, filename string) error {
+	data, err := json.MarshalIndent(newCommandFlags(cmd), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0644)
+}
+
+func newCommandFlags(cmd *cobra.Command) commandFlags {
+	result := commandFlags{
+		Name:  cmd.Name(),
+		Flags: []flagInfo{},
+	}
+	cmd.NonInheritedFlags().VisitAll(func(flag *pflag.Flag) {
+		result.Flags = append(result.Flags, flagInfo{
+			Name:       flag.Name,
+			Type:       flag.Value.Type(),
+			Default:    flag.DefValue,
+			Usage:      flag.Usage,
+			Deprecated: flag.Deprecated,
+		})
+	})
+	for _, c := range cmd.Commands() {
+		if !c.IsAvailableCommand() {
+			continue
+		}
+		result.Subcommands = append(result.Subcommands, newCommandFlags(c))
+	}
+	return result
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	schapp "github.com/sourcegraph/monorepo-test-1/kubernetes-5/plugin/cmd/kube-scheduler/app"
+)
+
+func TestGenJSONFlags(t *testing.T) {
+	dir, err := ioutil.TempDir("", "genkubedocs")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "kube-scheduler.json")
+	if err := genJSONFlags(schapp.NewSchedulerCommand(), filename); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var actual commandFlags
+	if err := json.Unmarshal(data, &actual); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if actual.Name != "kube-scheduler" {
+		t.Errorf("expected command name %q, got %q", "kube-scheduler", actual.Name)
+	}
+	found := false
+	for _, flag := range actual.Flags {
+		if flag.Name == "kubeconfig" {
+			found = true
+			if flag.Type != "string" {
+				t.Errorf("expected flag %q to have type %q, got %q", flag.Name, "string", flag.Type)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("expected flag %q in %s", "kubeconfig", string(data))
+	}
+}
@@ -20,11 +20,15 @@ limitations under the License.
 package app
 
 import (
+	"fmt"
 	"net"
 	"net/http"
 	"net/http/pprof"
 	goruntime "runtime"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
@@ -32,6 +36,7 @@ import (
 	utilflag "k8s.io/apiserver/pkg/util/flag"
 	"k8s.io/client-go/dynamic"
 	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
 	federationclientset "github.com/sourcegraph/monorepo-test-1/kubernetes-6/federation/client/clientset_generated/federation_clientset"
 	"github.com/sourcegraph/monorepo-test-1/kubernetes-6/federation/cmd/federation-controller-manager/app/options"
@@ -96,14 +101,18 @@ func Run(s *options.CMServer) error {
 	restClientCfg.QPS = s.APIServerQPS
 	restClientCfg.Burst = s.APIServerBurst
 
+	featureGatesClientset := federationclientset.NewForConfigOrDie(restclient.AddUserAgent(restClientCfg, "feature-gates"))
+	featureGates := NewFeatureGateReader(featureGatesClientset, metav1.NamespaceSystem, FeatureGatesConfigMapName, DefaultFederationFeatureGates, 0)
+	go featureGates.Run(wait.NeverStop)
+
 	go func() {
 		mux := http.NewServeMux()
 		healthz.InstallHandler(mux)
 		if s.EnableProfiling {
-			mux.HandleFunc("/debug/pprof/", pprof.Index)
-			mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
-			mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
-			mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+			mux.HandleFunc("/debug/pprof/", featureGates.GatedHandler(ProfilingFeature, pprof.Index))
+			mux.HandleFunc("/debug/pprof/profile", featureGates.GatedHandler(ProfilingFeature, pprof.Profile))
+			mux.HandleFunc("/debug/pprof/symbol", featureGates.GatedHandler(ProfilingFeature, pprof.Symbol))
+			mux.HandleFunc("/debug/pprof/trace", featureGates.GatedHandler(ProfilingFeature, pprof.Trace))
 			if s.EnableContentionProfiling {
 				goruntime.SetBlockProfileRate(1)
 			}
@@ -118,7 +127,7 @@ func Run(s *options.CMServer) error {
 	}()
 
 	run := func() {
-		err := StartControllers(s, restClientCfg)
+		err := StartControllers(s, restClientCfg, featureGates)
 		glog.Fatalf("error running controllers: %v", err)
 		panic("unreachable")
 	}
@@ -126,103 +135,308 @@ func Run(s *options.CMServer) error {
 	panic("unreachable")
 }
 
-func StartControllers(s *options.CMServer, restClientCfg *restclient.Config) error {
+// featureGatesSyncTimeout is how long StartControllers waits for the feature
+// gates to be read before it starts the controllers with the defaults.
+const featureGatesSyncTimeout = 30 * time.Second
+
+func StartControllers(s *options.CMServer, restClientCfg *restclient.Config, featureGates *FeatureGateReader) error {
 	stopChan := wait.NeverStop
-	minimizeLatency := false
+	rateLimits := s.ControllerClientRateLimits
+
+	waitForFeatureGates(featureGates, featureGatesSyncTimeout, stopChan)
+	minimizeLatency := featureGates.Enabled(MinimizeLatencyFeature)
 
 	discoveryClient := discovery.NewDiscoveryClientForConfigOrDie(restClientCfg)
 	serverResources, err := discoveryClient.ServerResources()
 	if err != nil {
-		glog.Fatalf("Could not find resources from API Server: %v", err)
+		return fmt.Errorf("could not find resources from API Server: %v", err)
 	}
 
-	clustercontroller.StartClusterController(restClientCfg, stopChan, s.ClusterMonitorPeriod.Duration)
+	if err := startClusterControllerIfEnabled(s, restClientCfg, serverResources, stopChan); err != nil {
+		return err
+	}
 
-	if controllerEnabled(s.Controllers, serverResources, servicecontroller.ControllerName, servicecontroller.RequiredResources, true) {
-		dns, err := dnsprovider.InitDnsProvider(s.DnsProvider, s.DnsConfigFile)
-		if err != nil {
-			glog.Fatalf("Cloud provider could not be initialized: %v", err)
-		}
-		glog.Infof("Loading client config for service controller %q", servicecontroller.UserAgentName)
-		scClientset := federationclientset.NewForConfigOrDie(restclient.AddUserAgent(restClientCfg, servicecontroller.UserAgentName))
-		servicecontroller := servicecontroller.New(scClientset, dns, s.FederationName, s.ServiceDnsSuffix, s.ZoneName, s.ZoneID)
-		glog.Infof("Running service controller")
-		if err := servicecontroller.Run(s.ConcurrentServiceSyncs, wait.NeverStop); err != nil {
-			glog.Fatalf("Failed to start service controller: %v", err)
+	enabled, err := controllerEnabled(s.Controllers, serverResources, servicecontroller.ControllerName, servicecontroller.RequiredResources, true)
+	if err != nil {
+		return err
+	}
+	if enabled {
+		if err := startServiceController(s, restClientCfg, rateLimits); err != nil {
+			return err
 		}
 	}
 
-	if controllerEnabled(s.Controllers, serverResources, namespacecontroller.ControllerName, namespacecontroller.RequiredResources, true) {
+	enabled, err = controllerEnabled(s.Controllers, serverResources, namespacecontroller.ControllerName, namespacecontroller.RequiredResources, true)
+	if err != nil {
+		return err
+	}
+	if enabled {
 		glog.Infof("Loading client config for namespace controller %q", "namespace-controller")
-		nsClientset := federationclientset.NewForConfigOrDie(restclient.AddUserAgent(restClientCfg, "namespace-controller"))
-		namespaceController := namespacecontroller.NewNamespaceController(nsClientset, dynamic.NewDynamicClientPool(restclient.AddUserAgent(restClientCfg, "namespace-controller")))
-		glog.Infof("Running namespace controller")
-		namespaceController.Run(wait.NeverStop)
+		nsClientset := federationclientset.NewForConfigOrDie(controllerClientConfig(restClientCfg, rateLimits, namespacecontroller.ControllerName, "namespace-controller"))
+		namespaceController := namespacecontroller.NewNamespaceController(nsClientset, dynamic.NewDynamicClientPool(controllerClientConfig(restClientCfg, rateLimits, namespacecontroller.ControllerName, "namespace-controller")))
+		runController(namespacecontroller.ControllerName, func() { namespaceController.Run(wait.NeverStop) })
 	}
 
-	for kind, federatedType := range federatedtypes.FederatedTypes() {
-		if controllerEnabled(s.Controllers, serverResources, federatedType.ControllerName, federatedType.RequiredResources, true) {
-			synccontroller.StartFederationSyncController(kind, federatedType.AdapterFactory, restClientCfg, stopChan, minimizeLatency)
+	federatedTypesSummary := controllerSummary{}
+	federatedTypes := federatedtypes.FederatedTypes()
+	kinds := make([]string, 0, len(federatedTypes))
+	for kind := range federatedTypes {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	var federatedTypeControllers []func()
+	for _, kind := range kinds {
+		kind, federatedType := kind, federatedTypes[kind]
+		enabled, reason, err := controllerEnabledWithReason(s.Controllers, serverResources, federatedType.ControllerName, federatedType.RequiredResources, true)
+		if err != nil {
+			return err
+		}
+		federatedTypesSummary.record(kind, enabled, reason)
+		if enabled {
+			federatedTypeControllers = append(federatedTypeControllers, func() {
+				startFederatedTypeController(kind, federatedType, restClientCfg, rateLimits, stopChan, minimizeLatency)
+			})
 		}
 	}
+	startInBatches(federatedTypeControllers, s.FederatedTypeControllerStartLimit)
 
-	if controllerEnabled(s.Controllers, serverResources, configmapcontroller.ControllerName, configmapcontroller.RequiredResources, true) {
-		configmapcontrollerClientset := federationclientset.NewForConfigOrDie(restclient.AddUserAgent(restClientCfg, "configmap-controller"))
-		configmapcontroller := configmapcontroller.NewConfigMapController(configmapcontrollerClientset)
-		configmapcontroller.Run(wait.NeverStop)
+	enabled, err = controllerEnabled(s.Controllers, serverResources, configmapcontroller.ControllerName, configmapcontroller.RequiredResources, true)
+	if err != nil {
+		return err
+	}
+	if enabled {
+		configmapcontrollerClientset := federationclientset.NewForConfigOrDie(controllerClientConfig(restClientCfg, rateLimits, configmapcontroller.ControllerName, "configmap-controller"))
+		configMapController := configmapcontroller.NewConfigMapController(configmapcontrollerClientset)
+		runController(configmapcontroller.ControllerName, func() { configMapController.Run(wait.NeverStop) })
 	}
 
-	if controllerEnabled(s.Controllers, serverResources, daemonsetcontroller.ControllerName, daemonsetcontroller.RequiredResources, true) {
-		daemonsetcontrollerClientset := federationclientset.NewForConfigOrDie(restclient.AddUserAgent(restClientCfg, "daemonset-controller"))
-		daemonsetcontroller := daemonsetcontroller.NewDaemonSetController(daemonsetcontrollerClientset)
-		daemonsetcontroller.Run(wait.NeverStop)
+	enabled, err = controllerEnabled(s.Controllers, serverResources, daemonsetcontroller.ControllerName, daemonsetcontroller.RequiredResources, true)
+	if err != nil {
+		return err
+	}
+	if enabled {
+		daemonsetcontrollerClientset := federationclientset.NewForConfigOrDie(controllerClientConfig(restClientCfg, rateLimits, daemonsetcontroller.ControllerName, "daemonset-controller"))
+		daemonSetController := daemonsetcontroller.NewDaemonSetController(daemonsetcontrollerClientset)
+		runController(daemonsetcontroller.ControllerName, func() { daemonSetController.Run(wait.NeverStop) })
 	}
 
-	if controllerEnabled(s.Controllers, serverResources, replicasetcontroller.ControllerName, replicasetcontroller.RequiredResources, true) {
-		replicaSetClientset := federationclientset.NewForConfigOrDie(restclient.AddUserAgent(restClientCfg, replicasetcontroller.UserAgentName))
+	enabled, err = controllerEnabled(s.Controllers, serverResources, replicasetcontroller.ControllerName, replicasetcontroller.RequiredResources, true)
+	if err != nil {
+		return err
+	}
+	if enabled {
+		replicaSetClientset := federationclientset.NewForConfigOrDie(controllerClientConfig(restClientCfg, rateLimits, replicasetcontroller.ControllerName, replicasetcontroller.UserAgentName))
 		replicaSetController := replicasetcontroller.NewReplicaSetController(replicaSetClientset)
-		go replicaSetController.Run(s.ConcurrentReplicaSetSyncs, wait.NeverStop)
+		runController(replicasetcontroller.ControllerName, func() { replicaSetController.Run(s.ConcurrentReplicaSetSyncs, wait.NeverStop) })
 	}
 
-	if controllerEnabled(s.Controllers, serverResources, deploymentcontroller.ControllerName, deploymentcontroller.RequiredResources, true) {
-		deploymentClientset := federationclientset.NewForConfigOrDie(restclient.AddUserAgent(restClientCfg, deploymentcontroller.UserAgentName))
+	enabled, err = controllerEnabled(s.Controllers, serverResources, deploymentcontroller.ControllerName, deploymentcontroller.RequiredResources, true)
+	if err != nil {
+		return err
+	}
+	if enabled {
+		deploymentClientset := federationclientset.NewForConfigOrDie(controllerClientConfig(restClientCfg, rateLimits, deploymentcontroller.ControllerName, deploymentcontroller.UserAgentName))
 		deploymentController := deploymentcontroller.NewDeploymentController(deploymentClientset)
 		// TODO: rename s.ConcurentReplicaSetSyncs
-		go deploymentController.Run(s.ConcurrentReplicaSetSyncs, wait.NeverStop)
+		runController(deploymentcontroller.ControllerName, func() { deploymentController.Run(s.ConcurrentReplicaSetSyncs, wait.NeverStop) })
 	}
 
-	if controllerEnabled(s.Controllers, serverResources, ingresscontroller.ControllerName, ingresscontroller.RequiredResources, true) {
+	enabled, err = controllerEnabled(s.Controllers, serverResources, ingresscontroller.ControllerName, ingresscontroller.RequiredResources, true)
+	if err != nil {
+		return err
+	}
+	if enabled {
 		glog.Infof("Loading client config for ingress controller %q", "ingress-controller")
-		ingClientset := federationclientset.NewForConfigOrDie(restclient.AddUserAgent(restClientCfg, "ingress-controller"))
+		ingClientset := federationclientset.NewForConfigOrDie(controllerClientConfig(restClientCfg, rateLimits, ingresscontroller.ControllerName, "ingress-controller"))
 		ingressController := ingresscontroller.NewIngressController(ingClientset)
-		glog.Infof("Running ingress controller")
-		ingressController.Run(wait.NeverStop)
+		runController(ingresscontroller.ControllerName, func() { ingressController.Run(wait.NeverStop) })
 	}
 
+	glog.Infof("Federated type controllers: %s", federatedTypesSummary)
+
 	select {}
 }
 
-func controllerEnabled(controllers utilflag.ConfigurationMap, serverResources []*metav1.APIResourceList, controller string, requiredResources []schema.GroupVersionResource, defaultValue bool) bool {
+// waitForFeatureGates waits until featureGates read their ConfigMap. If it
+// can not be read within timeout, e.g. because listing it is forbidden, the
+// gates read so far, usually the defaults, are kept as their baseline.
+func waitForFeatureGates(featureGates *FeatureGateReader, timeout time.Duration, stopChan <-chan struct{}) {
+	if waitForCacheSyncWithTimeout(timeout, stopChan, featureGates.HasSynced) {
+		return
+	}
+	glog.Warningf("Could not read feature gates from ConfigMap %s/%s within %v, starting with the defaults", metav1.NamespaceSystem, FeatureGatesConfigMapName, timeout)
+	featureGates.keepBaseline()
+}
+
+// startClusterController starts the cluster controller. It is a variable so
+// tests can replace it.
+var startClusterController = clustercontroller.StartClusterController
+
+// startClusterControllerIfEnabled starts the cluster controller unless it is
+// disabled by config or the API Server does not have the resources it
+// requires.
+func startClusterControllerIfEnabled(s *options.CMServer, restClientCfg *restclient.Config, serverResources []*metav1.APIResourceList, stopChan <-chan struct{}) error {
+	enabled, err := controllerEnabled(s.Controllers, serverResources, clustercontroller.ControllerName, clustercontroller.RequiredResources, true)
+	if err != nil {
+		return err
+	}
+	if enabled {
+		glog.Infof("Running %s controller", clustercontroller.ControllerName)
+		startClusterController(restClientCfg, stopChan, s.ClusterMonitorPeriod.Duration)
+	}
+	return nil
+}
+
+// startFederationSyncController starts the sync controller of a federated
+// type. It is a variable so tests can replace it.
+var startFederationSyncController = synccontroller.StartFederationSyncController
+
+// startFederatedTypeController starts the sync controller of the federated
+// type of kind with the client rate limit of its controller.
+func startFederatedTypeController(kind string, federatedType federatedtypes.FederatedTypeConfig, restClientCfg *restclient.Config, rateLimits options.ControllerClientRateLimits, stopChan <-chan struct{}, minimizeLatency bool) {
+	startFederationSyncController(kind, federatedType.AdapterFactory, withClientRateLimit(restClientCfg, rateLimits, federatedType.ControllerName), stopChan, minimizeLatency)
+}
+
+// sleepBetweenBatches waits between two batches of startInBatches. It is a
+// variable so tests can replace it.
+var sleepBetweenBatches = time.Sleep
+
+// startInBatches calls the start functions in order, at most
+// limit.BatchSize of them before waiting limit.BatchDelay and continuing
+// with the next batch. A BatchSize of zero calls all of them at once.
+func startInBatches(starts []func(), limit options.FederatedTypeControllerStartLimit) {
+	for i, start := range starts {
+		if limit.BatchSize > 0 && i > 0 && i%limit.BatchSize == 0 {
+			glog.V(2).Infof("Started %d federated type controllers, waiting %v before starting more", i, limit.BatchDelay)
+			sleepBetweenBatches(limit.BatchDelay)
+		}
+		start()
+	}
+}
+
+// waitForCacheSyncWithTimeout waits until all of synced return true,
+// returning false if timeout passes or stopChan is closed first.
+func waitForCacheSyncWithTimeout(timeout time.Duration, stopChan <-chan struct{}, synced ...cache.InformerSynced) bool {
+	done := make(chan struct{})
+	defer close(done)
+	timeoutChan := make(chan struct{})
+	go func() {
+		defer close(timeoutChan)
+		select {
+		case <-stopChan:
+		case <-time.After(timeout):
+		case <-done:
+		}
+	}()
+	return cache.WaitForCacheSync(timeoutChan, synced...)
+}
+
+// startServiceController starts the service controller, returning an error
+// naming the controller if it could not be started.
+func startServiceController(s *options.CMServer, restClientCfg *restclient.Config, rateLimits options.ControllerClientRateLimits) error {
+	dns, err := dnsprovider.InitDnsProvider(s.DnsProvider, s.DnsConfigFile)
+	if err != nil {
+		return fmt.Errorf("%s controller: cloud provider could not be initialized: %v", servicecontroller.ControllerName, err)
+	}
+	glog.Infof("Loading client config for service controller %q", servicecontroller.UserAgentName)
+	scClientset := federationclientset.NewForConfigOrDie(controllerClientConfig(restClientCfg, rateLimits, servicecontroller.ControllerName, servicecontroller.UserAgentName))
+	serviceController := servicecontroller.New(scClientset, dns, s.FederationName, s.ServiceDnsSuffix, s.ZoneName, s.ZoneID)
+	glog.Infof("Running service controller")
+	if err := serviceController.Run(s.ConcurrentServiceSyncs, wait.NeverStop); err != nil {
+		return fmt.Errorf("%s controller: failed to start: %v", servicecontroller.ControllerName, err)
+	}
+	return nil
+}
+
+// runController runs a controller in its own goroutine, so that a controller
+// whose Run blocks does not prevent the controllers started after it from
+// starting.
+func runController(controller string, run func()) {
+	glog.Infof("Running %s controller", controller)
+	go run()
+}
+
+// controllerClientConfig returns a copy of restClientCfg with the given user
+// agent for the clients of controller, see withClientRateLimit.
+func controllerClientConfig(restClientCfg *restclient.Config, rateLimits options.ControllerClientRateLimits, controller, userAgent string) *restclient.Config {
+	config := *restClientCfg
+	return withClientRateLimit(restclient.AddUserAgent(&config, userAgent), rateLimits, controller)
+}
+
+// withClientRateLimit returns a copy of restClientCfg using the QPS and burst
+// of controller in rateLimits, falling back to the ones of restClientCfg.
+func withClientRateLimit(restClientCfg *restclient.Config, rateLimits options.ControllerClientRateLimits, controller string) *restclient.Config {
+	config := *restClientCfg
+	if limit, ok := rateLimits[controller]; ok {
+		if limit.QPS != 0 {
+			config.QPS = limit.QPS
+		}
+		if limit.Burst != 0 {
+			config.Burst = limit.Burst
+		}
+	}
+	return &config
+}
+
+// controllerSummary maps the name of a controller to whether it is running
+// and, if it is not, why.
+type controllerSummary map[string]string
+
+func (s controllerSummary) record(controller string, enabled bool, reason string) {
+	if enabled {
+		s[controller] = "enabled"
+	} else {
+		s[controller] = "disabled (" + reason + ")"
+	}
+}
+
+// String returns the summary sorted by controller name.
+func (s controllerSummary) String() string {
+	controllers := make([]string, 0, len(s))
+	for controller := range s {
+		controllers = append(controllers, controller)
+	}
+	sort.Strings(controllers)
+	entries := make([]string, 0, len(controllers))
+	for _, controller := range controllers {
+		entries = append(entries, controller+": "+s[controller])
+	}
+	return strings.Join(entries, ", ")
+}
+
+// controllerEnabled returns whether the controller should run. It returns an
+// error if the controller is enabled explicitly but the API Server does not
+// have the resources it requires.
+func controllerEnabled(controllers utilflag.ConfigurationMap, serverResources []*metav1.APIResourceList, controller string, requiredResources []schema.GroupVersionResource, defaultValue bool) (bool, error) {
+	enabled, _, err := controllerEnabledWithReason(controllers, serverResources, controller, requiredResources, defaultValue)
+	return enabled, err
+}
+
+// controllerEnabledWithReason is like controllerEnabled but also returns why
+// the controller is disabled.
+func controllerEnabledWithReason(controllers utilflag.ConfigurationMap, serverResources []*metav1.APIResourceList, controller string, requiredResources []schema.GroupVersionResource, defaultValue bool) (bool, string, error) {
 	controllerConfig, ok := controllers[controller]
 	if ok {
 		if controllerConfig == "false" {
 			glog.Infof("%s controller disabled by config", controller)
-			return false
+			return false, "by config", nil
 		}
 		if controllerConfig == "true" {
 			if !hasRequiredResources(serverResources, requiredResources) {
-				glog.Fatalf("%s controller enabled explicitly but API Server does not have required resources", controller)
-				panic("unreachable")
+				return false, "", fmt.Errorf("%s controller enabled explicitly but API Server does not have required resources", controller)
 			}
-			return true
+			return true, "", nil
 		}
 	} else if defaultValue {
 		if !hasRequiredResources(serverResources, requiredResources) {
 			glog.Warningf("%s controller disabled because API Server does not have required resources", controller)
-			return false
+			return false, "API Server does not have required resources", nil
 		}
 	}
-	return defaultValue
+	if !defaultValue {
+		return false, "by default", nil
+	}
+	return true, "", nil
 }
 
 func hasRequiredResources(serverResources []*metav1.APIResourceList, requiredResources []schema.GroupVersionResource) bool {
@@ -17,11 +17,23 @@ limitations under the License.
 package app
 
 import (
+	"strings"
+	"testing"
+	"time"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
 	utilflag "k8s.io/apiserver/pkg/util/flag"
+	restclient "k8s.io/client-go/rest"
+	"github.com/sourcegraph/monorepo-test-1/kubernetes-6/federation/cmd/federation-controller-manager/app/options"
+	"github.com/sourcegraph/monorepo-test-1/kubernetes-6/federation/pkg/federatedtypes"
+	clustercontroller "github.com/sourcegraph/monorepo-test-1/kubernetes-6/federation/pkg/federation-controller/cluster"
 	ingresscontroller "github.com/sourcegraph/monorepo-test-1/kubernetes-6/federation/pkg/federation-controller/ingress"
-	"testing"
+	namespacecontroller "github.com/sourcegraph/monorepo-test-1/kubernetes-6/federation/pkg/federation-controller/namespace"
+	servicecontroller "github.com/sourcegraph/monorepo-test-1/kubernetes-6/federation/pkg/federation-controller/service"
+
+	"github.com/spf13/pflag"
 )
 
 func TestControllerEnabled(t *testing.T) {
@@ -80,9 +92,256 @@ func TestControllerEnabled(t *testing.T) {
 	}
 
 	for _, test := range testCases {
-		actualEnabled := controllerEnabled(test.controllersConfig, test.serverResources, test.controller, test.requiredResources, test.defaultValue)
+		actualEnabled, err := controllerEnabled(test.controllersConfig, test.serverResources, test.controller, test.requiredResources, test.defaultValue)
+		if err != nil {
+			t.Errorf("%s controller: unexpected error: %v", test.controller, err)
+		}
 		if actualEnabled != test.expectedResult {
 			t.Errorf("%s controller: expected %v, got %v", test.controller, test.expectedResult, actualEnabled)
 		}
 	}
 }
+
+func TestControllerEnabledExplicitlyWithoutRequiredResources(t *testing.T) {
+	controllersConfig := utilflag.ConfigurationMap{ingresscontroller.ControllerName: "true"}
+	_, err := controllerEnabled(controllersConfig, []*metav1.APIResourceList{}, ingresscontroller.ControllerName, ingresscontroller.RequiredResources, true)
+	if err == nil || !strings.Contains(err.Error(), ingresscontroller.ControllerName) {
+		t.Errorf("expected an error naming the %s controller, got %v", ingresscontroller.ControllerName, err)
+	}
+}
+
+func TestStartServiceControllerDNSInitFailure(t *testing.T) {
+	s := options.NewCMServer()
+	s.DnsProvider = "not-a-dns-provider"
+	err := startServiceController(s, &restclient.Config{}, nil)
+	if err == nil || !strings.Contains(err.Error(), servicecontroller.ControllerName+" controller") {
+		t.Errorf("expected an error naming the %s controller, got %v", servicecontroller.ControllerName, err)
+	}
+}
+
+func TestStartClusterControllerIfEnabled(t *testing.T) {
+	serverResources := []*metav1.APIResourceList{
+		{
+			GroupVersion: "federation/v1beta1",
+			APIResources: []metav1.APIResource{
+				{Name: "clusters", Namespaced: false, Kind: "Cluster"},
+			},
+		},
+	}
+	defer func(start func(*restclient.Config, <-chan struct{}, time.Duration)) {
+		startClusterController = start
+	}(startClusterController)
+
+	for _, test := range []struct {
+		name              string
+		controllersConfig utilflag.ConfigurationMap
+		expectStarted     bool
+	}{
+		{name: "no override", controllersConfig: utilflag.ConfigurationMap{}, expectStarted: true},
+		{name: "disabled by config", controllersConfig: utilflag.ConfigurationMap{clustercontroller.ControllerName: "false"}, expectStarted: false},
+	} {
+		started := false
+		startClusterController = func(*restclient.Config, <-chan struct{}, time.Duration) { started = true }
+		s := options.NewCMServer()
+		s.Controllers = test.controllersConfig
+		if err := startClusterControllerIfEnabled(s, &restclient.Config{}, serverResources, wait.NeverStop); err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+		if started != test.expectStarted {
+			t.Errorf("%s: expected the %s controller to be started: %v, got %v", test.name, clustercontroller.ControllerName, test.expectStarted, started)
+		}
+	}
+}
+
+func TestControllerClientConfigAppliesRateLimitOverride(t *testing.T) {
+	rateLimits := options.ControllerClientRateLimits{}
+	if err := rateLimits.Set(ingresscontroller.ControllerName + "=50:100"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	restClientCfg := &restclient.Config{QPS: 5, Burst: 10}
+
+	ingressCfg := controllerClientConfig(restClientCfg, rateLimits, ingresscontroller.ControllerName, "ingress-controller")
+	if ingressCfg.QPS != 50 || ingressCfg.Burst != 100 {
+		t.Errorf("expected the override to be applied to the %s controller, got QPS %v and burst %d", ingresscontroller.ControllerName, ingressCfg.QPS, ingressCfg.Burst)
+	}
+	serviceCfg := controllerClientConfig(restClientCfg, rateLimits, servicecontroller.ControllerName, servicecontroller.UserAgentName)
+	if serviceCfg.QPS != 5 || serviceCfg.Burst != 10 {
+		t.Errorf("expected the %s controller to use the global rate limit, got QPS %v and burst %d", servicecontroller.ControllerName, serviceCfg.QPS, serviceCfg.Burst)
+	}
+	if restClientCfg.QPS != 5 || restClientCfg.Burst != 10 || restClientCfg.UserAgent != "" {
+		t.Errorf("expected the global config to be unchanged, got %+v", restClientCfg)
+	}
+}
+
+func TestCMServerControllerClientRateLimitsFlag(t *testing.T) {
+	s := options.NewCMServer()
+	fs := pflag.NewFlagSet("federation-controller-manager", pflag.ContinueOnError)
+	s.AddFlags(fs)
+	if err := fs.Parse([]string{"--controller-client-rate-limits=" + ingresscontroller.ControllerName + "=50:100"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	restClientCfg := &restclient.Config{QPS: 5, Burst: 10}
+	ingressCfg := controllerClientConfig(restClientCfg, s.ControllerClientRateLimits, ingresscontroller.ControllerName, "ingress-controller")
+	if ingressCfg.QPS != 50 || ingressCfg.Burst != 100 {
+		t.Errorf("expected the flag to override the rate limit of the %s controller, got QPS %v and burst %d", ingresscontroller.ControllerName, ingressCfg.QPS, ingressCfg.Burst)
+	}
+}
+
+func TestCMServerFederatedTypeControllerStartLimitFlags(t *testing.T) {
+	s := options.NewCMServer()
+	fs := pflag.NewFlagSet("federation-controller-manager", pflag.ContinueOnError)
+	s.AddFlags(fs)
+	expected := options.FederatedTypeControllerStartLimit{BatchDelay: options.DefaultFederatedTypeControllerStartBatchDelay}
+	if s.FederatedTypeControllerStartLimit != expected {
+		t.Errorf("expected the default start limit %+v, got %+v", expected, s.FederatedTypeControllerStartLimit)
+	}
+
+	if err := fs.Parse([]string{"--federated-type-controller-start-batch-size=3", "--federated-type-controller-start-batch-delay=5s"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected = options.FederatedTypeControllerStartLimit{BatchSize: 3, BatchDelay: 5 * time.Second}
+	if s.FederatedTypeControllerStartLimit != expected {
+		t.Errorf("expected the start limit %+v, got %+v", expected, s.FederatedTypeControllerStartLimit)
+	}
+}
+
+func TestStartFederatedTypeController(t *testing.T) {
+	defer func(start func(string, federatedtypes.AdapterFactory, *restclient.Config, <-chan struct{}, bool)) {
+		startFederationSyncController = start
+	}(startFederationSyncController)
+	rateLimits := options.ControllerClientRateLimits{}
+	if err := rateLimits.Set("secrets=50:100"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var startedKind string
+	var startedConfig *restclient.Config
+	startFederationSyncController = func(kind string, _ federatedtypes.AdapterFactory, config *restclient.Config, _ <-chan struct{}, _ bool) {
+		startedKind, startedConfig = kind, config
+	}
+	federatedType := federatedtypes.FederatedTypeConfig{ControllerName: "secrets"}
+	startFederatedTypeController("secret", federatedType, &restclient.Config{QPS: 5, Burst: 10}, rateLimits, wait.NeverStop, false /* minimizeLatency */)
+
+	if startedKind != "secret" {
+		t.Errorf("expected the secret sync controller to be started, got %q", startedKind)
+	}
+	if startedConfig == nil || startedConfig.QPS != 50 || startedConfig.Burst != 100 {
+		t.Errorf("expected the sync controller to be started with the rate limit of its controller, got %+v", startedConfig)
+	}
+}
+
+func TestRunControllerDoesNotBlockLaterControllers(t *testing.T) {
+	blocked := make(chan struct{})
+	defer close(blocked)
+	running := make(chan struct{})
+	returned := make(chan struct{})
+	go func() {
+		runController(namespacecontroller.ControllerName, func() {
+			close(running)
+			<-blocked
+		})
+		close(returned)
+	}()
+
+	select {
+	case <-returned:
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatalf("expected runController to return while the %s controller is running", namespacecontroller.ControllerName)
+	}
+	select {
+	case <-running:
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatalf("expected the %s controller to run", namespacecontroller.ControllerName)
+	}
+}
+
+func TestControllerSummary(t *testing.T) {
+	serverResources := []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "secrets", Namespaced: true, Kind: "Secret"},
+			},
+		},
+	}
+	secrets := []schema.GroupVersionResource{{Version: "v1", Resource: "secrets"}}
+
+	summary := controllerSummary{}
+	for _, test := range []struct {
+		kind              string
+		controllersConfig utilflag.ConfigurationMap
+		requiredResources []schema.GroupVersionResource
+	}{
+		{kind: "secret", controllersConfig: utilflag.ConfigurationMap{}, requiredResources: secrets},
+		{kind: "ingress", controllersConfig: utilflag.ConfigurationMap{}, requiredResources: ingresscontroller.RequiredResources},
+		{kind: "configmap", controllersConfig: utilflag.ConfigurationMap{"configmaps": "false"}, requiredResources: secrets},
+	} {
+		enabled, reason, err := controllerEnabledWithReason(test.controllersConfig, serverResources, test.kind+"s", test.requiredResources, true)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.kind, err)
+		}
+		summary.record(test.kind, enabled, reason)
+	}
+
+	expected := controllerSummary{
+		"secret":    "enabled",
+		"ingress":   "disabled (API Server does not have required resources)",
+		"configmap": "disabled (by config)",
+	}
+	for kind, status := range expected {
+		if summary[kind] != status {
+			t.Errorf("%s: expected %q, got %q", kind, status, summary[kind])
+		}
+	}
+	if s := summary.String(); !strings.HasPrefix(s, "configmap: ") {
+		t.Errorf("expected summary sorted by type, got %q", s)
+	}
+}
+
+func TestStartInBatches(t *testing.T) {
+	defer func(sleep func(time.Duration)) {
+		sleepBetweenBatches = sleep
+	}(sleepBetweenBatches)
+
+	for _, test := range []struct {
+		name                  string
+		controllers           int
+		batchSize             int
+		expectedStartedBefore []int
+	}{
+		{name: "no limit", controllers: 5, batchSize: 0},
+		{name: "limit above the number of controllers", controllers: 3, batchSize: 5},
+		{name: "limit dividing the number of controllers", controllers: 4, batchSize: 2, expectedStartedBefore: []int{2}},
+		{name: "partial last batch", controllers: 5, batchSize: 2, expectedStartedBefore: []int{2, 4}},
+	} {
+		started := 0
+		var startedBefore []int
+		sleepBetweenBatches = func(delay time.Duration) {
+			if delay != time.Second {
+				t.Errorf("%s: expected to wait the batch delay, got %v", test.name, delay)
+			}
+			startedBefore = append(startedBefore, started)
+		}
+		starts := make([]func(), test.controllers)
+		for i := range starts {
+			starts[i] = func() { started++ }
+		}
+
+		limit := options.FederatedTypeControllerStartLimit{BatchSize: test.batchSize, BatchDelay: time.Second}
+		startInBatches(starts, limit)
+
+		if started != test.controllers {
+			t.Errorf("%s: expected %d controllers to be started, got %d", test.name, test.controllers, started)
+		}
+		if len(startedBefore) != len(test.expectedStartedBefore) {
+			t.Errorf("%s: expected %d waits between batches, got %v", test.name, len(test.expectedStartedBefore), startedBefore)
+			continue
+		}
+		for i, expected := range test.expectedStartedBefore {
+			if startedBefore[i] != expected {
+				t.Errorf("%s: expected %d controllers to be started before wait %d, got %d", test.name, expected, i, startedBefore[i])
+			}
+		}
+	}
+}
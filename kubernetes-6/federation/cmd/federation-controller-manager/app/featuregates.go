@@ -0,0 +1,222 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	pkgruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+	federationclientset "github.com/sourcegraph/monorepo-test-1/kubernetes-6/federation/client/clientset_generated/federation_clientset"
+	apiv1 "github.com/sourcegraph/monorepo-test-1/kubernetes-6/pkg/api/v1"
+)
+
+const (
+	// FeatureGatesConfigMapName is the name of the ConfigMap in the
+	// federation control plane that holds the feature gates of the
+	// controller manager. Each key is a gate name and each value is
+	// "true" or "false".
+	FeatureGatesConfigMapName = "federation-controller-manager-features"
+
+	// MinimizeLatencyFeature makes the sync controllers use short delays
+	// between reconciliations. It is read once when the controllers start.
+	MinimizeLatencyFeature = "MinimizeLatency"
+
+	// ProfilingFeature serves the /debug/pprof handlers enabled by
+	// --profiling. It is hot reloadable, so profiling can be switched off and
+	// on again without a restart.
+	ProfilingFeature = "Profiling"
+)
+
+// FeatureGateSpec describes a feature gate read from the feature gates ConfigMap.
+type FeatureGateSpec struct {
+	// Default is the value of the gate when it is not set in the ConfigMap.
+	Default bool
+	// HotReloadable indicates that changes to the gate are picked up at
+	// runtime. Changes to other gates only take effect after a restart.
+	HotReloadable bool
+}
+
+// DefaultFederationFeatureGates are the feature gates known to the
+// federation controller manager.
+var DefaultFederationFeatureGates = map[string]FeatureGateSpec{
+	MinimizeLatencyFeature: {Default: false, HotReloadable: false},
+	ProfilingFeature:       {Default: true, HotReloadable: true},
+}
+
+// FeatureGateReader watches the feature gates ConfigMap and exposes the
+// parsed gates to controllers. It is safe for concurrent use.
+type FeatureGateReader struct {
+	lock    sync.RWMutex
+	specs   map[string]FeatureGateSpec
+	enabled map[string]bool
+	// loaded is true once the baseline of the gates has been read when the
+	// reader started, see loadBaseline. Until then all gates may be set,
+	// afterwards only hot reloadable ones.
+	loaded bool
+
+	client     federationclientset.Interface
+	namespace  string
+	name       string
+	controller cache.Controller
+}
+
+// NewFeatureGateReader returns a FeatureGateReader for the given gates that
+// reads the ConfigMap namespace/name using client.
+func NewFeatureGateReader(client federationclientset.Interface, namespace, name string, specs map[string]FeatureGateSpec, resyncPeriod time.Duration) *FeatureGateReader {
+	r := &FeatureGateReader{
+		specs:     specs,
+		enabled:   make(map[string]bool, len(specs)),
+		client:    client,
+		namespace: namespace,
+		name:      name,
+	}
+	for gate, spec := range specs {
+		r.enabled[gate] = spec.Default
+	}
+
+	fieldSelector := fields.OneTermEqualSelector("metadata.name", name).String()
+	_, r.controller = cache.NewInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (pkgruntime.Object, error) {
+				options.FieldSelector = fieldSelector
+				return client.Core().ConfigMaps(namespace).List(options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				options.FieldSelector = fieldSelector
+				return client.Core().ConfigMaps(namespace).Watch(options)
+			},
+		},
+		&apiv1.ConfigMap{},
+		resyncPeriod,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				if configMap, ok := obj.(*apiv1.ConfigMap); ok && configMap.Name == name {
+					r.update(configMap.Data)
+				}
+			},
+			UpdateFunc: func(old, cur interface{}) {
+				if configMap, ok := cur.(*apiv1.ConfigMap); ok && configMap.Name == name {
+					r.update(configMap.Data)
+				}
+			},
+			DeleteFunc: func(obj interface{}) {
+				r.update(nil)
+			},
+		},
+	)
+	return r
+}
+
+// Run reads the baseline of the gates and then watches the feature gates
+// ConfigMap until stopCh is closed.
+func (r *FeatureGateReader) Run(stopCh <-chan struct{}) {
+	r.loadBaseline()
+	r.controller.Run(stopCh)
+}
+
+// loadBaseline sets the gates from the ConfigMap as it is when the reader
+// starts. A missing ConfigMap leaves the defaults as the baseline, so that
+// creating it later only changes the hot reloadable gates. If the ConfigMap
+// can not be read, the first state observed by the watch is the baseline.
+func (r *FeatureGateReader) loadBaseline() {
+	configMap, err := r.client.Core().ConfigMaps(r.namespace).Get(r.name, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		r.update(nil)
+	case err != nil:
+		glog.Errorf("Could not read feature gates from ConfigMap %s/%s: %v", r.namespace, r.name, err)
+	default:
+		r.update(configMap.Data)
+	}
+}
+
+// HasSynced returns true once the initial state of the ConfigMap was read.
+func (r *FeatureGateReader) HasSynced() bool {
+	return r.controller.HasSynced()
+}
+
+// Enabled returns whether the given feature gate is enabled. Unknown gates
+// are disabled.
+func (r *FeatureGateReader) Enabled(gate string) bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.enabled[gate]
+}
+
+// GatedHandler returns a handler that serves handler while gate is enabled and
+// responds with 404 Not Found while it is not.
+func (r *FeatureGateReader) GatedHandler(gate string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if !r.Enabled(gate) {
+			http.NotFound(w, req)
+			return
+		}
+		handler(w, req)
+	}
+}
+
+// keepBaseline makes the gates as they are the baseline, if it was not read
+// yet, so that only hot reloadable gates change when the ConfigMap is read
+// later.
+func (r *FeatureGateReader) keepBaseline() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.loaded = true
+}
+
+// update sets the gates from the data of the ConfigMap. Gates missing from
+// data are reset to their default.
+func (r *FeatureGateReader) update(data map[string]string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for gate, spec := range r.specs {
+		value := spec.Default
+		if s, ok := data[gate]; ok {
+			parsed, err := strconv.ParseBool(s)
+			if err != nil {
+				glog.Errorf("Ignoring invalid value %q of feature gate %s: %v", s, gate, err)
+				continue
+			}
+			value = parsed
+		}
+		if value == r.enabled[gate] {
+			continue
+		}
+		if r.loaded && !spec.HotReloadable {
+			glog.Warningf("Feature gate %s changed to %v, restart the controller manager for the change to take effect", gate, value)
+			continue
+		}
+		glog.Infof("Feature gate %s set to %v", gate, value)
+		r.enabled[gate] = value
+	}
+	for gate := range data {
+		if _, ok := r.specs[gate]; !ok {
+			glog.Warningf("Ignoring unknown feature gate %s", gate)
+		}
+	}
+	r.loaded = true
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	fakefedclientset "github.com/sourcegraph/monorepo-test-1/kubernetes-6/federation/client/clientset_generated/federation_clientset/fake"
+	apiv1 "github.com/sourcegraph/monorepo-test-1/kubernetes-6/pkg/api/v1"
+)
+
+func TestFeatureGateReader(t *testing.T) {
+	const (
+		hotGate     = "HotGate"
+		startupGate = "StartupGate"
+	)
+	configMap := &apiv1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: FeatureGatesConfigMapName, Namespace: metav1.NamespaceSystem},
+		Data: map[string]string{
+			hotGate:     "false",
+			startupGate: "true",
+		},
+	}
+	client := fakefedclientset.NewSimpleClientset(configMap)
+	reader := NewFeatureGateReader(client, metav1.NamespaceSystem, FeatureGatesConfigMapName, map[string]FeatureGateSpec{
+		hotGate:     {Default: false, HotReloadable: true},
+		startupGate: {Default: false, HotReloadable: false},
+	}, 0)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go reader.Run(stopCh)
+	if !cache.WaitForCacheSync(stopCh, reader.HasSynced) {
+		t.Fatalf("feature gate reader did not sync")
+	}
+
+	if reader.Enabled(hotGate) {
+		t.Errorf("expected %s to be disabled", hotGate)
+	}
+	if !reader.Enabled(startupGate) {
+		t.Errorf("expected %s to be enabled", startupGate)
+	}
+
+	updated := *configMap
+	updated.Data = map[string]string{
+		hotGate:     "true",
+		startupGate: "false",
+	}
+	if _, err := client.Core().ConfigMaps(metav1.NamespaceSystem).Update(&updated); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A consumer polling the gate observes the change without a restart.
+	if err := wait.PollImmediate(10*time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
+		return reader.Enabled(hotGate), nil
+	}); err != nil {
+		t.Fatalf("expected %s to be enabled after the ConfigMap update", hotGate)
+	}
+	if !reader.Enabled(startupGate) {
+		t.Errorf("expected %s to keep its startup value", startupGate)
+	}
+}
+
+func TestFeatureGateReaderWithoutConfigMapAtStartup(t *testing.T) {
+	const (
+		hotGate     = "HotGate"
+		startupGate = "StartupGate"
+	)
+	client := fakefedclientset.NewSimpleClientset()
+	reader := NewFeatureGateReader(client, metav1.NamespaceSystem, FeatureGatesConfigMapName, map[string]FeatureGateSpec{
+		hotGate:     {Default: false, HotReloadable: true},
+		startupGate: {Default: false, HotReloadable: false},
+	}, 0)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go reader.Run(stopCh)
+	if !cache.WaitForCacheSync(stopCh, reader.HasSynced) {
+		t.Fatalf("feature gate reader did not sync")
+	}
+
+	configMap := &apiv1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: FeatureGatesConfigMapName, Namespace: metav1.NamespaceSystem},
+		Data: map[string]string{
+			hotGate:     "true",
+			startupGate: "true",
+		},
+	}
+	if _, err := client.Core().ConfigMaps(metav1.NamespaceSystem).Create(configMap); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The defaults were the baseline, so the ConfigMap created later is a
+	// change at runtime.
+	if err := wait.PollImmediate(10*time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
+		return reader.Enabled(hotGate), nil
+	}); err != nil {
+		t.Fatalf("expected %s to be enabled after the ConfigMap was created", hotGate)
+	}
+	if reader.Enabled(startupGate) {
+		t.Errorf("expected %s to keep its default until a restart", startupGate)
+	}
+}
+
+func TestWaitForFeatureGatesFallsBackToDefaults(t *testing.T) {
+	const (
+		hotGate     = "HotGate"
+		startupGate = "StartupGate"
+	)
+	client := fakefedclientset.NewSimpleClientset()
+	reader := NewFeatureGateReader(client, metav1.NamespaceSystem, FeatureGatesConfigMapName, map[string]FeatureGateSpec{
+		hotGate:     {Default: false, HotReloadable: true},
+		startupGate: {Default: false, HotReloadable: false},
+	}, 0)
+
+	// The reader is not running, so it never syncs, as if the ConfigMap
+	// could not be listed.
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	waitForFeatureGates(reader, 10*time.Millisecond, stopCh)
+
+	// The defaults are the baseline, so a ConfigMap read later only changes
+	// the hot reloadable gates.
+	reader.update(map[string]string{
+		hotGate:     "true",
+		startupGate: "true",
+	})
+	if !reader.Enabled(hotGate) {
+		t.Errorf("expected %s to be enabled", hotGate)
+	}
+	if reader.Enabled(startupGate) {
+		t.Errorf("expected %s to keep its default until a restart", startupGate)
+	}
+}
+
+func TestGatedHandler(t *testing.T) {
+	client := fakefedclientset.NewSimpleClientset()
+	reader := NewFeatureGateReader(client, metav1.NamespaceSystem, FeatureGatesConfigMapName, DefaultFederationFeatureGates, 0)
+	reader.update(nil)
+	handler := reader.GatedHandler(ProfilingFeature, func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	serve := func() int {
+		recorder := httptest.NewRecorder()
+		handler(recorder, httptest.NewRequest("GET", "/debug/pprof/", nil))
+		return recorder.Code
+	}
+	if code := serve(); code != http.StatusOK {
+		t.Errorf("expected status %d while %s is enabled, got %d", http.StatusOK, ProfilingFeature, code)
+	}
+	reader.update(map[string]string{ProfilingFeature: "false"})
+	if code := serve(); code != http.StatusNotFound {
+		t.Errorf("expected status %d while %s is disabled, got %d", http.StatusNotFound, ProfilingFeature, code)
+	}
+	reader.update(nil)
+	if code := serve(); code != http.StatusOK {
+		t.Errorf("expected status %d after %s was enabled again, got %d", http.StatusOK, ProfilingFeature, code)
+	}
+}
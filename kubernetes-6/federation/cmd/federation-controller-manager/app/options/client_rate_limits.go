@@ -0,0 +1,94 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package options
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// ClientRateLimit is the QPS and burst of the clients of a controller. Zero
+// values fall back to the global --federated-api-qps and --federated-api-burst.
+type ClientRateLimit struct {
+	QPS   float32
+	Burst int
+}
+
+// ControllerClientRateLimits maps controller names to the rate limits of
+// their clients. It implements pflag.Value, parsing a comma separated list of
+// <controller>=<qps>[:<burst>] entries.
+type ControllerClientRateLimits map[string]ClientRateLimit
+
+var _ pflag.Value = ControllerClientRateLimits{}
+
+// AddFlags adds the flag configuring the per controller client rate limits
+// to the specified FlagSet.
+func (l ControllerClientRateLimits) AddFlags(fs *pflag.FlagSet) {
+	fs.Var(l, "controller-client-rate-limits", ""+
+		"A set of <controller>=<qps>[:<burst>] pairs overriding the QPS and burst of "+
+		"the clients of individual controllers, e.g. 'ingresses=50:100'. Controllers "+
+		"without an override use --federated-api-qps and --federated-api-burst.")
+}
+
+func (l ControllerClientRateLimits) String() string {
+	controllers := make([]string, 0, len(l))
+	for controller := range l {
+		controllers = append(controllers, controller)
+	}
+	sort.Strings(controllers)
+	pairs := make([]string, 0, len(controllers))
+	for _, controller := range controllers {
+		limit := l[controller]
+		pairs = append(pairs, fmt.Sprintf("%s=%s:%d", controller, strconv.FormatFloat(float64(limit.QPS), 'f', -1, 32), limit.Burst))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (l ControllerClientRateLimits) Set(value string) error {
+	for _, pair := range strings.Split(value, ",") {
+		if len(pair) == 0 {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || len(parts[0]) == 0 {
+			return fmt.Errorf("invalid controller client rate limit %q: expected <controller>=<qps>[:<burst>]", pair)
+		}
+		limits := strings.SplitN(parts[1], ":", 2)
+		qps, err := strconv.ParseFloat(limits[0], 32)
+		if err != nil || qps < 0 {
+			return fmt.Errorf("invalid QPS in controller client rate limit %q", pair)
+		}
+		limit := ClientRateLimit{QPS: float32(qps)}
+		if len(limits) == 2 {
+			burst, err := strconv.Atoi(limits[1])
+			if err != nil || burst < 0 {
+				return fmt.Errorf("invalid burst in controller client rate limit %q", pair)
+			}
+			limit.Burst = burst
+		}
+		l[strings.TrimSpace(parts[0])] = limit
+	}
+	return nil
+}
+
+func (ControllerClientRateLimits) Type() string {
+	return "mapStringString"
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package options
+
+import (
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// DefaultFederatedTypeControllerStartBatchDelay is the default time waited
+// between starting two batches of federated type sync controllers.
+const DefaultFederatedTypeControllerStartBatchDelay = time.Second
+
+// FederatedTypeControllerStartLimit bounds how many sync controllers of
+// federated types are started at once, so that their initial lists and
+// watches against the member clusters are spread out.
+type FederatedTypeControllerStartLimit struct {
+	// BatchSize is the maximum number of sync controllers started at once.
+	// Zero starts all of them at once.
+	BatchSize int
+
+	// BatchDelay is the time waited after starting a batch before the next
+	// one is started.
+	BatchDelay time.Duration
+}
+
+// NewFederatedTypeControllerStartLimit returns a limit that starts all sync
+// controllers at once and waits DefaultFederatedTypeControllerStartBatchDelay
+// between batches once a batch size is set.
+func NewFederatedTypeControllerStartLimit() FederatedTypeControllerStartLimit {
+	return FederatedTypeControllerStartLimit{BatchDelay: DefaultFederatedTypeControllerStartBatchDelay}
+}
+
+// AddFlags adds the flags configuring the start limit to the specified
+// FlagSet.
+func (l *FederatedTypeControllerStartLimit) AddFlags(fs *pflag.FlagSet) {
+	fs.IntVar(&l.BatchSize, "federated-type-controller-start-batch-size", l.BatchSize, ""+
+		"The maximum number of federated type sync controllers started at once. "+
+		"Zero starts all of them at once.")
+	fs.DurationVar(&l.BatchDelay, "federated-type-controller-start-batch-delay", l.BatchDelay, ""+
+		"The time waited between starting two batches of federated type sync controllers, "+
+		"see --federated-type-controller-start-batch-size.")
+}
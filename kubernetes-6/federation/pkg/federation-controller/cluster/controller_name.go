@@ -0,0 +1,32 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clustercontroller
+
+import (
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	federationapi "github.com/sourcegraph/monorepo-test-1/kubernetes-6/federation/apis/federation/v1beta1"
+)
+
+const (
+	// ControllerName is the name of the cluster controller in the
+	// controllers configuration of the federation controller manager.
+	ControllerName = "clusters"
+)
+
+// RequiredResources are the resources the API Server must serve for the
+// cluster controller to run.
+var RequiredResources = []schema.GroupVersionResource{federationapi.SchemeGroupVersion.WithResource("clusters")}
@@ -0,0 +1,115 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apps
+
+import (
+	"strconv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// StatefulSetPodName returns the name of the pod of ss with the given ordinal.
+func StatefulSetPodName(ss *StatefulSet, ordinal int) string {
+	return ss.Name + "-" + strconv.Itoa(ordinal)
+}
+
+// ExpectedPodNames returns the names of the pods of ss, from ordinal 0 to
+// ordinal replicas-1.
+func ExpectedPodNames(ss *StatefulSet) []string {
+	if ss.Spec.Replicas <= 0 {
+		return []string{}
+	}
+	names := make([]string, 0, ss.Spec.Replicas)
+	for ordinal := 0; ordinal < int(ss.Spec.Replicas); ordinal++ {
+		names = append(names, StatefulSetPodName(ss, ordinal))
+	}
+	return names
+}
+
+// SelectorsOverlap returns true if some set of labels is matched by both a
+// and b, e.g. if the selector of a StatefulSet would also match the pods of a
+// Deployment. Both matchLabels and matchExpressions are taken into account.
+// A nil selector matches nothing, an empty one everything. An error is
+// returned if either selector is invalid.
+func SelectorsOverlap(a, b *metav1.LabelSelector) (bool, error) {
+	for _, selector := range []*metav1.LabelSelector{a, b} {
+		if _, err := metav1.LabelSelectorAsSelector(selector); err != nil {
+			return false, err
+		}
+	}
+	if a == nil || b == nil {
+		return false, nil
+	}
+
+	// Labels with different keys do not constrain each other, so the
+	// selectors overlap if the requirements on each key can be met.
+	requirements := map[string][]metav1.LabelSelectorRequirement{}
+	for _, selector := range []*metav1.LabelSelector{a, b} {
+		for key, value := range selector.MatchLabels {
+			requirements[key] = append(requirements[key], metav1.LabelSelectorRequirement{
+				Key:      key,
+				Operator: metav1.LabelSelectorOpIn,
+				Values:   []string{value},
+			})
+		}
+		for _, requirement := range selector.MatchExpressions {
+			requirements[requirement.Key] = append(requirements[requirement.Key], requirement)
+		}
+	}
+	for _, keyRequirements := range requirements {
+		if !requirementsSatisfiable(keyRequirements) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// requirementsSatisfiable returns true if some value, or the absence, of a
+// label meets all requirements, which must be on the same key.
+func requirementsSatisfiable(requirements []metav1.LabelSelectorRequirement) bool {
+	mustExist, mustNotExist := false, false
+	var allowed sets.String
+	excluded := sets.NewString()
+	for _, requirement := range requirements {
+		switch requirement.Operator {
+		case metav1.LabelSelectorOpIn:
+			mustExist = true
+			if allowed == nil {
+				allowed = sets.NewString(requirement.Values...)
+			} else {
+				allowed = allowed.Intersection(sets.NewString(requirement.Values...))
+			}
+		case metav1.LabelSelectorOpNotIn:
+			excluded.Insert(requirement.Values...)
+		case metav1.LabelSelectorOpExists:
+			mustExist = true
+		case metav1.LabelSelectorOpDoesNotExist:
+			mustNotExist = true
+		}
+	}
+	switch {
+	case mustExist && mustNotExist:
+		return false
+	case allowed != nil:
+		return allowed.Difference(excluded).Len() > 0
+	default:
+		// Either the label is absent, or it has one of the infinitely many
+		// values that are not excluded.
+		return true
+	}
+}
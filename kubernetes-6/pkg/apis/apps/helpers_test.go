@@ -0,0 +1,167 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apps
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestExpectedPodNames(t *testing.T) {
+	testCases := []struct {
+		replicas int32
+		expected []string
+	}{
+		{replicas: 0, expected: []string{}},
+		{replicas: 1, expected: []string{"web-0"}},
+		{replicas: 12, expected: []string{
+			"web-0", "web-1", "web-2", "web-3", "web-4", "web-5",
+			"web-6", "web-7", "web-8", "web-9", "web-10", "web-11",
+		}},
+	}
+
+	for _, tc := range testCases {
+		ss := &StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "web"},
+			Spec:       StatefulSetSpec{Replicas: tc.replicas},
+		}
+		if actual := ExpectedPodNames(ss); !reflect.DeepEqual(actual, tc.expected) {
+			t.Errorf("replicas %d: expected %v, got %v", tc.replicas, tc.expected, actual)
+		}
+	}
+}
+
+func TestSelectorsOverlap(t *testing.T) {
+	testCases := []struct {
+		name     string
+		a, b     *metav1.LabelSelector
+		expected bool
+	}{
+		{
+			name:     "same labels",
+			a:        &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			b:        &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			expected: true,
+		},
+		{
+			name:     "subset of labels",
+			a:        &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			b:        &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web", "tier": "frontend"}},
+			expected: true,
+		},
+		{
+			name:     "different values",
+			a:        &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			b:        &metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}},
+			expected: false,
+		},
+		{
+			name: "in overlapping values",
+			a:    &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			b: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "app", Operator: metav1.LabelSelectorOpIn, Values: []string{"web", "db"}},
+			}},
+			expected: true,
+		},
+		{
+			name: "in disjoint values",
+			a: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "app", Operator: metav1.LabelSelectorOpIn, Values: []string{"web", "cache"}},
+			}},
+			b: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "app", Operator: metav1.LabelSelectorOpIn, Values: []string{"db"}},
+			}},
+			expected: false,
+		},
+		{
+			name: "not in the only value",
+			a:    &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			b: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "app", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"web"}},
+			}},
+			expected: false,
+		},
+		{
+			name: "not in other values",
+			a:    &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			b: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "app", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"db"}},
+			}},
+			expected: true,
+		},
+		{
+			name: "exists and does not exist",
+			a: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "canary", Operator: metav1.LabelSelectorOpExists},
+			}},
+			b: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "canary", Operator: metav1.LabelSelectorOpDoesNotExist},
+			}},
+			expected: false,
+		},
+		{
+			name: "does not exist and not in",
+			a: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "canary", Operator: metav1.LabelSelectorOpDoesNotExist},
+			}},
+			b: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "canary", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"true"}},
+			}},
+			expected: true,
+		},
+		{
+			name:     "empty selector",
+			a:        &metav1.LabelSelector{},
+			b:        &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			expected: true,
+		},
+		{
+			name:     "nil selector",
+			a:        nil,
+			b:        &metav1.LabelSelector{},
+			expected: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		for _, selectors := range [][2]*metav1.LabelSelector{{tc.a, tc.b}, {tc.b, tc.a}} {
+			overlap, err := SelectorsOverlap(selectors[0], selectors[1])
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tc.name, err)
+				continue
+			}
+			if overlap != tc.expected {
+				t.Errorf("%s: expected overlap %v, got %v", tc.name, tc.expected, overlap)
+			}
+		}
+	}
+}
+
+func TestSelectorsOverlapInvalidSelector(t *testing.T) {
+	invalid := &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+		{Key: "app", Operator: metav1.LabelSelectorOpIn},
+	}}
+	valid := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}
+	if _, err := SelectorsOverlap(invalid, valid); err == nil {
+		t.Errorf("expected an error for an In requirement without values")
+	}
+	if _, err := SelectorsOverlap(valid, invalid); err == nil {
+		t.Errorf("expected an error for an In requirement without values")
+	}
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package validation
+
+import (
+	"testing"
+
+	"github.com/sourcegraph/monorepo-test-1/kubernetes-6/pkg/api"
+	_ "github.com/sourcegraph/monorepo-test-1/kubernetes-6/pkg/api/install"
+	"github.com/sourcegraph/monorepo-test-1/kubernetes-6/pkg/apis/apps"
+	_ "github.com/sourcegraph/monorepo-test-1/kubernetes-6/pkg/apis/apps/install"
+	appsv1beta1 "github.com/sourcegraph/monorepo-test-1/kubernetes-6/pkg/apis/apps/v1beta1"
+)
+
+// defaultStatefulSet returns a copy of ss with the apps/v1beta1 defaults
+// applied, the way the API server defaults a StatefulSet before validating
+// it.
+func defaultStatefulSet(t *testing.T, name string, ss *apps.StatefulSet) *apps.StatefulSet {
+	copied, err := api.Scheme.DeepCopy(ss)
+	if err != nil {
+		t.Fatalf("%s: unexpected error copying: %v", name, err)
+	}
+	external := &appsv1beta1.StatefulSet{}
+	if err := api.Scheme.Convert(copied, external, nil); err != nil {
+		t.Fatalf("%s: unexpected error converting to %s: %v", name, appsv1beta1.SchemeGroupVersion, err)
+	}
+	api.Scheme.Default(external)
+	defaulted := &apps.StatefulSet{}
+	if err := api.Scheme.Convert(external, defaulted, nil); err != nil {
+		t.Fatalf("%s: unexpected error converting from %s: %v", name, appsv1beta1.SchemeGroupVersion, err)
+	}
+	return defaulted
+}
+
+// expectConsistentDefaulting validates ss as it is and after defaulting, and
+// fails t if only one of the two passes. If defaultingFixes is true, ss is
+// expected to be invalid only until the missing fields are defaulted.
+func expectConsistentDefaulting(t *testing.T, name string, ss *apps.StatefulSet, defaultingFixes bool) {
+	errs := ValidateStatefulSet(ss)
+	defaultedErrs := ValidateStatefulSet(defaultStatefulSet(t, name, ss))
+	switch {
+	case defaultingFixes:
+		if len(errs) == 0 || len(defaultedErrs) != 0 {
+			t.Errorf("%s: expected defaulting to fix the validation errors, got %v before and %v after defaulting", name, errs, defaultedErrs)
+		}
+	case len(errs) == 0 && len(defaultedErrs) != 0:
+		t.Errorf("%s: expected success after defaulting: %v", name, defaultedErrs)
+	case len(errs) != 0 && len(defaultedErrs) == 0:
+		t.Errorf("%s: expected failure after defaulting, got success despite %v before defaulting", name, errs)
+	}
+}
+
+func TestValidateDefaultedStatefulSet(t *testing.T) {
+	// The selector of these StatefulSets is defaulted from the pod template
+	// labels.
+	fixedByDefaulting := map[string]bool{
+		"empty selector": true,
+	}
+
+	successCases, errorCases := statefulSetValidationCases()
+	for i := range successCases {
+		expectConsistentDefaulting(t, successCases[i].Name, &successCases[i], false)
+	}
+	for k, v := range errorCases {
+		expectConsistentDefaulting(t, k, &v, fixedByDefaulting[k])
+	}
+}
@@ -17,17 +17,57 @@ limitations under the License.
 package validation
 
 import (
+	"fmt"
 	"reflect"
+	"sort"
+	"strings"
 
+	"github.com/golang/glog"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	unversionedvalidation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	"github.com/sourcegraph/monorepo-test-1/kubernetes-6/pkg/api"
 	apivalidation "github.com/sourcegraph/monorepo-test-1/kubernetes-6/pkg/api/validation"
 	"github.com/sourcegraph/monorepo-test-1/kubernetes-6/pkg/apis/apps"
 )
 
+// StatefulSetValidationOptions configures the optional validations of
+// StatefulSets. The zero value turns all of them off.
+type StatefulSetValidationOptions struct {
+	// VolumeClaimTemplates decides what happens to StatefulSets that do not
+	// declare any volumeClaimTemplates.
+	VolumeClaimTemplates VolumeClaimTemplatesPolicy
+
+	// RequireContainerResourceRequests rejects StatefulSets with pod template
+	// containers that do not request both CPU and memory, e.g. to enforce
+	// cost governance.
+	RequireContainerResourceRequests bool
+
+	// ReservedTemplateAnnotationPrefixes are the annotation prefixes that
+	// users may not set on the pod template, such as the ones of annotations
+	// injected by the platform.
+	ReservedTemplateAnnotationPrefixes []string
+}
+
+// VolumeClaimTemplatesPolicy decides what happens to StatefulSets that do not
+// declare any volumeClaimTemplates.
+type VolumeClaimTemplatesPolicy string
+
+const (
+	// VolumeClaimTemplatesOptional accepts StatefulSets without persistent
+	// storage.
+	VolumeClaimTemplatesOptional VolumeClaimTemplatesPolicy = ""
+	// VolumeClaimTemplatesWarn accepts StatefulSets without persistent
+	// storage, but logs a warning.
+	VolumeClaimTemplatesWarn VolumeClaimTemplatesPolicy = "Warn"
+	// VolumeClaimTemplatesRequired rejects StatefulSets without persistent
+	// storage.
+	VolumeClaimTemplatesRequired VolumeClaimTemplatesPolicy = "Required"
+)
+
 // ValidateStatefulSetName can be used to check whether the given StatefulSet name is valid.
 // Prefix indicates this name will be used as part of generation, in which case
 // trailing dashes are allowed.
@@ -63,7 +103,7 @@ func ValidatePodTemplateSpecForStatefulSet(template *api.PodTemplateSpec, select
 }
 
 // ValidateStatefulSetSpec tests if required fields in the StatefulSet spec are set.
-func ValidateStatefulSetSpec(spec *apps.StatefulSetSpec, fldPath *field.Path) field.ErrorList {
+func ValidateStatefulSetSpec(spec *apps.StatefulSetSpec, fldPath *field.Path, opts StatefulSetValidationOptions) field.ErrorList {
 	allErrs := field.ErrorList{}
 
 	allErrs = append(allErrs, apivalidation.ValidateNonnegativeField(int64(spec.Replicas), fldPath.Child("replicas"))...)
@@ -89,14 +129,145 @@ func ValidateStatefulSetSpec(spec *apps.StatefulSetSpec, fldPath *field.Path) fi
 	if spec.Template.Spec.ActiveDeadlineSeconds != nil {
 		allErrs = append(allErrs, field.Invalid(fldPath.Child("spec", "activeDeadlineSeconds"), spec.Template.Spec.ActiveDeadlineSeconds, "must not be specified"))
 	}
+	allErrs = append(allErrs, validateVolumeClaimTemplatesPresence(spec.VolumeClaimTemplates, opts.VolumeClaimTemplates, fldPath.Child("volumeClaimTemplates"))...)
+	allErrs = append(allErrs, validateVolumeClaimTemplateNames(spec.VolumeClaimTemplates, fldPath.Child("volumeClaimTemplates"))...)
+	allErrs = append(allErrs, validateVolumeClaimTemplateStorageRequests(spec.VolumeClaimTemplates, fldPath.Child("volumeClaimTemplates"))...)
+	if opts.RequireContainerResourceRequests {
+		allErrs = append(allErrs, validateContainerResourceRequests(spec.Template.Spec.Containers, fldPath.Child("template", "spec", "containers"))...)
+	}
+	allErrs = append(allErrs, validateStatefulSetTemplateAnnotations(spec.Template.Annotations, opts.ReservedTemplateAnnotationPrefixes, fldPath.Child("template", "metadata", "annotations"))...)
+
+	return allErrs
+}
+
+// ValidateStatefulSetMinReadySeconds tests that minReadySeconds, the
+// spec.minReadySeconds of a StatefulSet, is not negative. Zero and positive
+// values are valid. StatefulSetSpec has no minReadySeconds field yet, so
+// ValidateStatefulSetSpec does not call this until it gains one.
+func ValidateStatefulSetMinReadySeconds(minReadySeconds int32, fldPath *field.Path) field.ErrorList {
+	return apivalidation.ValidateNonnegativeField(int64(minReadySeconds), fldPath)
+}
+
+// validateVolumeClaimTemplatesPresence applies policy to a StatefulSet without
+// volumeClaimTemplates.
+func validateVolumeClaimTemplatesPresence(templates []api.PersistentVolumeClaim, policy VolumeClaimTemplatesPolicy, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if len(templates) > 0 {
+		return allErrs
+	}
+	switch policy {
+	case VolumeClaimTemplatesWarn:
+		glog.Warningf("%s: no volumeClaimTemplates are declared, the pods of the StatefulSet have no persistent storage", fldPath)
+	case VolumeClaimTemplatesRequired:
+		allErrs = append(allErrs, field.Required(fldPath, "at least one volumeClaimTemplate is required"))
+	}
+	return allErrs
+}
+
+// validateVolumeClaimTemplateNames tests that the volumeClaimTemplates have
+// unique names, as the claims created from templates sharing a name would
+// conflict.
+func validateVolumeClaimTemplateNames(templates []api.PersistentVolumeClaim, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	names := sets.String{}
+	for i := range templates {
+		name := templates[i].Name
+		if names.Has(name) {
+			allErrs = append(allErrs, field.Duplicate(fldPath.Index(i).Child("metadata", "name"), name))
+		}
+		names.Insert(name)
+	}
+	return allErrs
+}
 
+// validateVolumeClaimTemplateStorageRequests tests that each volumeClaimTemplate
+// requests a positive amount of storage, as claims created from a template
+// without one can not bind meaningfully.
+func validateVolumeClaimTemplateStorageRequests(templates []api.PersistentVolumeClaim, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	for i := range templates {
+		storagePath := fldPath.Index(i).Child("spec", "resources", "requests").Key(string(api.ResourceStorage))
+		storage, exists := templates[i].Spec.Resources.Requests[api.ResourceStorage]
+		if !exists {
+			allErrs = append(allErrs, field.Required(storagePath, ""))
+		} else if storage.Sign() <= 0 {
+			allErrs = append(allErrs, field.Invalid(storagePath, storage.String(), "must be greater than zero"))
+		}
+	}
 	return allErrs
 }
 
-// ValidateStatefulSet validates a StatefulSet.
+// validateContainerResourceRequests tests that each container requests CPU
+// and memory.
+func validateContainerResourceRequests(containers []api.Container, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	for i := range containers {
+		var missing []string
+		for _, name := range []api.ResourceName{api.ResourceCPU, api.ResourceMemory} {
+			if _, exists := containers[i].Resources.Requests[name]; !exists {
+				missing = append(missing, string(name))
+			}
+		}
+		if len(missing) > 0 {
+			allErrs = append(allErrs, field.Required(fldPath.Index(i).Child("resources", "requests"), fmt.Sprintf("must request %s", strings.Join(missing, " and "))))
+		}
+	}
+	return allErrs
+}
+
+// validateStatefulSetTemplateAnnotations rejects pod template annotations that
+// use one of the reservedPrefixes, in the order of their keys.
+func validateStatefulSetTemplateAnnotations(annotations map[string]string, reservedPrefixes []string, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if len(reservedPrefixes) == 0 {
+		return allErrs
+	}
+	keys := make([]string, 0, len(annotations))
+	for key := range annotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, prefix := range reservedPrefixes {
+			if strings.HasPrefix(key, prefix) {
+				allErrs = append(allErrs, field.Invalid(fldPath, key, fmt.Sprintf("annotations with prefix %q are reserved", prefix)))
+				break
+			}
+		}
+	}
+	return allErrs
+}
+
+// ValidateStatefulSetPodNames ensures that the names of the pods of the
+// StatefulSet, which are of the form {name}-{ordinal}, are valid hostnames
+// for all ordinals up to replicas-1.
+func ValidateStatefulSetPodNames(statefulSet *apps.StatefulSet, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	// The last pod has the longest name. Without replicas, check the name of
+	// the first pod created once the StatefulSet is scaled up.
+	podName := apps.StatefulSetPodName(statefulSet, 0)
+	if podNames := apps.ExpectedPodNames(statefulSet); len(podNames) > 0 {
+		podName = podNames[len(podNames)-1]
+	}
+	if len(podName) > validation.DNS1123LabelMaxLength {
+		allErrs = append(allErrs, field.Invalid(fldPath, statefulSet.Name,
+			fmt.Sprintf("must be no more than %d characters so that pod name %q is a valid hostname", validation.DNS1123LabelMaxLength-len(podName)+len(statefulSet.Name), podName)))
+	}
+	return allErrs
+}
+
+// ValidateStatefulSet validates a StatefulSet without the optional
+// validations.
 func ValidateStatefulSet(statefulSet *apps.StatefulSet) field.ErrorList {
+	return ValidateStatefulSetWithOptions(statefulSet, StatefulSetValidationOptions{})
+}
+
+// ValidateStatefulSetWithOptions validates a StatefulSet, including the
+// optional validations turned on by opts.
+func ValidateStatefulSetWithOptions(statefulSet *apps.StatefulSet, opts StatefulSetValidationOptions) field.ErrorList {
 	allErrs := apivalidation.ValidateObjectMeta(&statefulSet.ObjectMeta, true, ValidateStatefulSetName, field.NewPath("metadata"))
-	allErrs = append(allErrs, ValidateStatefulSetSpec(&statefulSet.Spec, field.NewPath("spec"))...)
+	allErrs = append(allErrs, ValidateStatefulSetSpec(&statefulSet.Spec, field.NewPath("spec"), opts)...)
+	allErrs = append(allErrs, ValidateStatefulSetPodNames(statefulSet, field.NewPath("metadata", "name"))...)
 	return allErrs
 }
 
@@ -132,3 +303,34 @@ func ValidateStatefulSetStatusUpdate(statefulSet, oldStatefulSet *apps.StatefulS
 	// TODO: Validate status.
 	return allErrs
 }
+
+// ValidateStatefulSetComprehensive runs every validation that applies to
+// statefulSet, so that a StatefulSet can be checked without persisting it.
+// On create this is ValidateStatefulSetWithOptions; on update oldStatefulSet
+// is required and the spec, update and status update validations are all run.
+// Errors reported by more than one of them are only returned once.
+func ValidateStatefulSetComprehensive(statefulSet, oldStatefulSet *apps.StatefulSet, isUpdate bool, opts StatefulSetValidationOptions) field.ErrorList {
+	if !isUpdate {
+		return ValidateStatefulSetWithOptions(statefulSet, opts)
+	}
+	if oldStatefulSet == nil {
+		return field.ErrorList{field.InternalError(field.NewPath("metadata"), fmt.Errorf("the existing StatefulSet is required to validate an update"))}
+	}
+
+	allErrs := field.ErrorList{}
+	seen := sets.NewString()
+	for _, errs := range []field.ErrorList{
+		ValidateStatefulSetWithOptions(statefulSet, opts),
+		ValidateStatefulSetUpdate(statefulSet, oldStatefulSet),
+		ValidateStatefulSetStatusUpdate(statefulSet, oldStatefulSet),
+	} {
+		for _, err := range errs {
+			if seen.Has(err.Error()) {
+				continue
+			}
+			seen.Insert(err.Error())
+			allErrs = append(allErrs, err)
+		}
+	}
+	return allErrs
+}
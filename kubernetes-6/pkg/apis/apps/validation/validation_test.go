@@ -17,15 +17,20 @@ limitations under the License.
 package validation
 
 import (
+	"fmt"
 	"strings"
 	"testing"
 
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"github.com/sourcegraph/monorepo-test-1/kubernetes-6/pkg/api"
 	"github.com/sourcegraph/monorepo-test-1/kubernetes-6/pkg/apis/apps"
 )
 
-func TestValidateStatefulSet(t *testing.T) {
+// statefulSetValidationCases returns StatefulSets that are expected to pass
+// validation, and ones expected to fail it keyed by the reason.
+func statefulSetValidationCases() ([]apps.StatefulSet, map[string]apps.StatefulSet) {
 	validLabels := map[string]string{"a": "b"}
 	validPodTemplate := api.PodTemplate{
 		Template: api.PodTemplateSpec{
@@ -67,11 +72,6 @@ func TestValidateStatefulSet(t *testing.T) {
 			},
 		},
 	}
-	for _, successCase := range successCases {
-		if errs := ValidateStatefulSet(&successCase); len(errs) != 0 {
-			t.Errorf("expected success: %v", errs)
-		}
-	}
 
 	errorCases := map[string]apps.StatefulSet{
 		"zero-length ID": {
@@ -191,6 +191,17 @@ func TestValidateStatefulSet(t *testing.T) {
 			},
 		},
 	}
+	return successCases, errorCases
+}
+
+func TestValidateStatefulSet(t *testing.T) {
+	successCases, errorCases := statefulSetValidationCases()
+	for _, successCase := range successCases {
+		if errs := ValidateStatefulSet(&successCase); len(errs) != 0 {
+			t.Errorf("expected success: %v", errs)
+		}
+	}
+
 	for k, v := range errorCases {
 		errs := ValidateStatefulSet(&v)
 		if len(errs) == 0 {
@@ -215,6 +226,263 @@ func TestValidateStatefulSet(t *testing.T) {
 	}
 }
 
+// newValidStatefulSet returns a valid StatefulSet without volumeClaimTemplates,
+// for tests to change the fields they validate.
+func newValidStatefulSet() *apps.StatefulSet {
+	validLabels := map[string]string{"a": "b"}
+	return &apps.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "abc", Namespace: metav1.NamespaceDefault},
+		Spec: apps.StatefulSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: validLabels},
+			Template: api.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: validLabels},
+				Spec: api.PodSpec{
+					RestartPolicy: api.RestartPolicyAlways,
+					DNSPolicy:     api.DNSClusterFirst,
+					Containers:    []api.Container{{Name: "abc", Image: "image", ImagePullPolicy: "IfNotPresent"}},
+				},
+			},
+		},
+	}
+}
+
+// newVolumeClaimTemplate returns a volumeClaimTemplate named name that
+// requests the given resources.
+func newVolumeClaimTemplate(name string, requests api.ResourceList) api.PersistentVolumeClaim {
+	return api.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: api.PersistentVolumeClaimSpec{
+			Resources: api.ResourceRequirements{Requests: requests},
+		},
+	}
+}
+
+func TestValidateStatefulSetRequireVolumeClaimTemplates(t *testing.T) {
+	withoutClaims := newValidStatefulSet()
+	withClaims := newValidStatefulSet()
+	withClaims.Spec.VolumeClaimTemplates = []api.PersistentVolumeClaim{
+		newVolumeClaimTemplate("data", api.ResourceList{api.ResourceStorage: resource.MustParse("1Gi")}),
+	}
+
+	if errs := ValidateStatefulSet(withoutClaims); len(errs) != 0 {
+		t.Errorf("expected success when volumeClaimTemplates are not required: %v", errs)
+	}
+
+	warn := StatefulSetValidationOptions{VolumeClaimTemplates: VolumeClaimTemplatesWarn}
+	if errs := ValidateStatefulSetWithOptions(withoutClaims, warn); len(errs) != 0 {
+		t.Errorf("expected only a warning without volumeClaimTemplates: %v", errs)
+	}
+
+	require := StatefulSetValidationOptions{VolumeClaimTemplates: VolumeClaimTemplatesRequired}
+	if errs := ValidateStatefulSetWithOptions(withClaims, require); len(errs) != 0 {
+		t.Errorf("expected success with volumeClaimTemplates: %v", errs)
+	}
+	errs := ValidateStatefulSetWithOptions(withoutClaims, require)
+	if len(errs) != 1 {
+		t.Fatalf("expected exactly one error without volumeClaimTemplates, got %v", errs)
+	}
+	if errs[0].Field != "spec.volumeClaimTemplates" {
+		t.Errorf("expected error at spec.volumeClaimTemplates, got %v", errs[0])
+	}
+}
+
+func TestValidateStatefulSetRequireContainerResourceRequests(t *testing.T) {
+	newStatefulSet := func(requests ...api.ResourceList) *apps.StatefulSet {
+		containers := []api.Container{}
+		for i := range requests {
+			containers = append(containers, api.Container{
+				Name:            fmt.Sprintf("c%d", i),
+				Image:           "image",
+				ImagePullPolicy: "IfNotPresent",
+				Resources:       api.ResourceRequirements{Requests: requests[i]},
+			})
+		}
+		statefulSet := newValidStatefulSet()
+		statefulSet.Spec.Template.Spec.Containers = containers
+		return statefulSet
+	}
+	cpuAndMemory := api.ResourceList{api.ResourceCPU: resource.MustParse("100m"), api.ResourceMemory: resource.MustParse("64Mi")}
+	cpuOnly := api.ResourceList{api.ResourceCPU: resource.MustParse("100m")}
+
+	if errs := ValidateStatefulSet(newStatefulSet(nil, cpuOnly)); len(errs) != 0 {
+		t.Errorf("expected success when resource requests are not required: %v", errs)
+	}
+
+	require := StatefulSetValidationOptions{RequireContainerResourceRequests: true}
+	if errs := ValidateStatefulSetWithOptions(newStatefulSet(cpuAndMemory, cpuAndMemory), require); len(errs) != 0 {
+		t.Errorf("expected success with CPU and memory requests: %v", errs)
+	}
+	errs := ValidateStatefulSetWithOptions(newStatefulSet(cpuAndMemory, nil, cpuOnly), require)
+	expectedFields := []string{
+		"spec.template.spec.containers[1].resources.requests",
+		"spec.template.spec.containers[2].resources.requests",
+	}
+	if len(errs) != len(expectedFields) {
+		t.Fatalf("expected errors at %v, got %v", expectedFields, errs)
+	}
+	for i, expected := range expectedFields {
+		if errs[i].Field != expected || errs[i].Type != field.ErrorTypeRequired {
+			t.Errorf("expected a required error at %s, got %v", expected, errs[i])
+		}
+	}
+}
+
+func TestValidateStatefulSetMinReadySeconds(t *testing.T) {
+	fldPath := field.NewPath("spec", "minReadySeconds")
+	testCases := []struct {
+		minReadySeconds int32
+		expectError     bool
+	}{
+		{minReadySeconds: -10, expectError: true},
+		{minReadySeconds: -1, expectError: true},
+		{minReadySeconds: 0, expectError: false},
+		{minReadySeconds: 1, expectError: false},
+		{minReadySeconds: 300, expectError: false},
+	}
+	for _, tc := range testCases {
+		errs := ValidateStatefulSetMinReadySeconds(tc.minReadySeconds, fldPath)
+		if !tc.expectError {
+			if len(errs) != 0 {
+				t.Errorf("minReadySeconds %d: expected success, got %v", tc.minReadySeconds, errs)
+			}
+			continue
+		}
+		if len(errs) != 1 || errs[0].Field != "spec.minReadySeconds" {
+			t.Errorf("minReadySeconds %d: expected a single error at spec.minReadySeconds, got %v", tc.minReadySeconds, errs)
+		}
+	}
+}
+
+func TestValidateStatefulSetVolumeClaimTemplateStorageRequests(t *testing.T) {
+	newStatefulSet := func(requests api.ResourceList) *apps.StatefulSet {
+		statefulSet := newValidStatefulSet()
+		statefulSet.Spec.VolumeClaimTemplates = []api.PersistentVolumeClaim{
+			newVolumeClaimTemplate("logs", api.ResourceList{api.ResourceStorage: resource.MustParse("1Gi")}),
+			newVolumeClaimTemplate("data", requests),
+		}
+		return statefulSet
+	}
+
+	if errs := ValidateStatefulSet(newStatefulSet(api.ResourceList{api.ResourceStorage: resource.MustParse("10Gi")})); len(errs) != 0 {
+		t.Errorf("expected success for a positive storage request: %v", errs)
+	}
+
+	errorCases := map[string]api.ResourceList{
+		"missing storage request": {api.ResourceCPU: resource.MustParse("1")},
+		"zero storage request":    {api.ResourceStorage: resource.MustParse("0")},
+	}
+	for name, requests := range errorCases {
+		errs := ValidateStatefulSet(newStatefulSet(requests))
+		if len(errs) != 1 {
+			t.Errorf("%s: expected exactly one error, got %v", name, errs)
+			continue
+		}
+		if expected := "spec.volumeClaimTemplates[1].spec.resources.requests[storage]"; errs[0].Field != expected {
+			t.Errorf("%s: expected error at %s, got %v", name, expected, errs[0])
+		}
+	}
+}
+
+func TestValidateStatefulSetVolumeClaimTemplateNames(t *testing.T) {
+	newStatefulSet := func(names ...string) *apps.StatefulSet {
+		statefulSet := newValidStatefulSet()
+		for _, name := range names {
+			statefulSet.Spec.VolumeClaimTemplates = append(statefulSet.Spec.VolumeClaimTemplates,
+				newVolumeClaimTemplate(name, api.ResourceList{api.ResourceStorage: resource.MustParse("1Gi")}))
+		}
+		return statefulSet
+	}
+
+	if errs := ValidateStatefulSet(newStatefulSet("logs", "data")); len(errs) != 0 {
+		t.Errorf("expected success for distinct volumeClaimTemplate names: %v", errs)
+	}
+
+	errs := ValidateStatefulSet(newStatefulSet("logs", "data", "logs"))
+	if len(errs) != 1 {
+		t.Fatalf("expected exactly one error for a duplicate volumeClaimTemplate name, got %v", errs)
+	}
+	if errs[0].Type != field.ErrorTypeDuplicate {
+		t.Errorf("expected a duplicate error, got %v", errs[0])
+	}
+	if expected := "spec.volumeClaimTemplates[2].metadata.name"; errs[0].Field != expected {
+		t.Errorf("expected error at %s, got %v", expected, errs[0])
+	}
+}
+
+func TestValidateStatefulSetReservedTemplateAnnotations(t *testing.T) {
+	newStatefulSet := func(annotations map[string]string) *apps.StatefulSet {
+		statefulSet := newValidStatefulSet()
+		statefulSet.Spec.Template.Annotations = annotations
+		return statefulSet
+	}
+
+	opts := StatefulSetValidationOptions{ReservedTemplateAnnotationPrefixes: []string{"platform.example.com/"}}
+
+	if errs := ValidateStatefulSetWithOptions(newStatefulSet(map[string]string{"user.example.com/owner": "me"}), opts); len(errs) != 0 {
+		t.Errorf("expected success for a non-reserved annotation: %v", errs)
+	}
+	errs := ValidateStatefulSetWithOptions(newStatefulSet(map[string]string{"platform.example.com/sidecar": "true"}), opts)
+	if len(errs) != 1 {
+		t.Fatalf("expected exactly one error for a reserved annotation, got %v", errs)
+	}
+	if errs[0].Field != "spec.template.metadata.annotations" {
+		t.Errorf("expected error at spec.template.metadata.annotations, got %v", errs[0])
+	}
+
+	errs = ValidateStatefulSetWithOptions(newStatefulSet(map[string]string{
+		"platform.example.com/d": "true",
+		"platform.example.com/b": "true",
+		"platform.example.com/c": "true",
+		"platform.example.com/a": "true",
+	}), opts)
+	expectedKeys := []string{"platform.example.com/a", "platform.example.com/b", "platform.example.com/c", "platform.example.com/d"}
+	if len(errs) != len(expectedKeys) {
+		t.Fatalf("expected errors for %v, got %v", expectedKeys, errs)
+	}
+	for i, expected := range expectedKeys {
+		if errs[i].BadValue != expected {
+			t.Errorf("expected error %d for %s, got %v", i, expected, errs[i])
+		}
+	}
+}
+
+func TestValidateStatefulSetPodNameLength(t *testing.T) {
+	newStatefulSet := func(nameLength int, replicas int32) *apps.StatefulSet {
+		statefulSet := newValidStatefulSet()
+		statefulSet.Name = strings.Repeat("a", nameLength)
+		statefulSet.Spec.Replicas = replicas
+		return statefulSet
+	}
+
+	testCases := []struct {
+		nameLength  int
+		replicas    int32
+		expectError bool
+	}{
+		// "-9" leaves 61 characters for the name.
+		{nameLength: 61, replicas: 10, expectError: false},
+		{nameLength: 62, replicas: 10, expectError: true},
+		// "-10" leaves 60 characters for the name.
+		{nameLength: 60, replicas: 11, expectError: false},
+		{nameLength: 61, replicas: 11, expectError: true},
+		// No replicas still produces pod name "-0" once scaled.
+		{nameLength: 61, replicas: 0, expectError: false},
+		{nameLength: 62, replicas: 0, expectError: true},
+	}
+	for _, tc := range testCases {
+		errs := ValidateStatefulSet(newStatefulSet(tc.nameLength, tc.replicas))
+		if !tc.expectError {
+			if len(errs) != 0 {
+				t.Errorf("name length %d, replicas %d: expected success, got %v", tc.nameLength, tc.replicas, errs)
+			}
+			continue
+		}
+		if len(errs) != 1 || errs[0].Field != "metadata.name" {
+			t.Errorf("name length %d, replicas %d: expected a single error at metadata.name, got %v", tc.nameLength, tc.replicas, errs)
+		}
+	}
+}
+
 func TestValidateStatefulSetUpdate(t *testing.T) {
 	validLabels := map[string]string{"a": "b"}
 	validPodTemplate := api.PodTemplate{
@@ -377,3 +645,63 @@ func TestValidateStatefulSetUpdate(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateStatefulSetComprehensive(t *testing.T) {
+	newStatefulSet := func(name string, replicas int32, serviceName string) *apps.StatefulSet {
+		statefulSet := newValidStatefulSet()
+		statefulSet.Name = name
+		statefulSet.ResourceVersion = "1"
+		statefulSet.Spec.Replicas = replicas
+		statefulSet.Spec.ServiceName = serviceName
+		return statefulSet
+	}
+
+	testCases := map[string]struct {
+		statefulSet    *apps.StatefulSet
+		oldStatefulSet *apps.StatefulSet
+		isUpdate       bool
+		expectedFields []string
+	}{
+		"valid create": {
+			statefulSet: newStatefulSet("abc", 3, ""),
+		},
+		"create with invalid name": {
+			statefulSet:    newStatefulSet("", 3, ""),
+			expectedFields: []string{"metadata.name"},
+		},
+		"valid update": {
+			statefulSet:    newStatefulSet("abc", 5, ""),
+			oldStatefulSet: newStatefulSet("abc", 3, ""),
+			isUpdate:       true,
+		},
+		"update without the existing StatefulSet": {
+			statefulSet:    newStatefulSet("abc", 5, ""),
+			isUpdate:       true,
+			expectedFields: []string{"metadata"},
+		},
+		"update changing the name and a forbidden spec field": {
+			statefulSet:    newStatefulSet("def", 3, "changed"),
+			oldStatefulSet: newStatefulSet("abc", 3, ""),
+			isUpdate:       true,
+			expectedFields: []string{"metadata.name", "spec"},
+		},
+		"update reports negative replicas once": {
+			statefulSet:    newStatefulSet("abc", -1, ""),
+			oldStatefulSet: newStatefulSet("abc", 3, ""),
+			isUpdate:       true,
+			expectedFields: []string{"spec.replicas"},
+		},
+	}
+	for name, tc := range testCases {
+		errs := ValidateStatefulSetComprehensive(tc.statefulSet, tc.oldStatefulSet, tc.isUpdate, StatefulSetValidationOptions{})
+		if len(errs) != len(tc.expectedFields) {
+			t.Errorf("%s: expected errors at %v, got %v", name, tc.expectedFields, errs)
+			continue
+		}
+		for i := range errs {
+			if errs[i].Field != tc.expectedFields[i] {
+				t.Errorf("%s: expected error %d at %q, got %v", name, i, tc.expectedFields[i], errs[i])
+			}
+		}
+	}
+}
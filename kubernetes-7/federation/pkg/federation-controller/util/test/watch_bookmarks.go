@@ -0,0 +1,121 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testutil
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	core "k8s.io/client-go/testing"
+)
+
+// BookmarkEventType is the type of the bookmark events added by
+// PrependBookmarkWatchReactor.
+const BookmarkEventType watch.EventType = "BOOKMARK"
+
+// PrependBookmarkWatchReactor makes the watches of resource served by client
+// emit a bookmark event every interval, in addition to the events of the
+// watch reactors the client already has. The object of each bookmark is
+// returned by newBookmark for a resourceVersion that increases from the one
+// the watch was started at and from the ones of the events passed on.
+func PrependBookmarkWatchReactor(client *core.Fake, resource string, interval time.Duration, newBookmark func(resourceVersion string) runtime.Object) {
+	next := append([]core.WatchReactor{}, client.WatchReactionChain...)
+	client.PrependWatchReactor(resource, func(action core.Action) (bool, watch.Interface, error) {
+		for _, reactor := range next {
+			if !reactor.Handles(action) {
+				continue
+			}
+			handled, watcher, err := reactor.React(action)
+			if !handled {
+				continue
+			}
+			if err != nil {
+				return true, nil, err
+			}
+			var resourceVersion uint64
+			if watchAction, ok := action.(core.WatchAction); ok {
+				// An empty or non numeric resourceVersion starts from zero.
+				resourceVersion, _ = strconv.ParseUint(watchAction.GetWatchRestrictions().ResourceVersion, 10, 64)
+			}
+			return true, newBookmarkWatcher(watcher, resourceVersion, interval, newBookmark), nil
+		}
+		return false, nil, nil
+	})
+}
+
+// bookmarkWatcher passes on the events of a watch and adds bookmark events
+// until it is stopped or the watch ends.
+type bookmarkWatcher struct {
+	watcher  watch.Interface
+	result   chan watch.Event
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func newBookmarkWatcher(watcher watch.Interface, resourceVersion uint64, interval time.Duration, newBookmark func(resourceVersion string) runtime.Object) *bookmarkWatcher {
+	w := &bookmarkWatcher{
+		watcher: watcher,
+		result:  make(chan watch.Event),
+		stop:    make(chan struct{}),
+	}
+	go w.run(resourceVersion, interval, newBookmark)
+	return w
+}
+
+func (w *bookmarkWatcher) run(resourceVersion uint64, interval time.Duration, newBookmark func(resourceVersion string) runtime.Object) {
+	defer close(w.result)
+	defer w.watcher.Stop()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		var event watch.Event
+		select {
+		case <-w.stop:
+			return
+		case passedOn, ok := <-w.watcher.ResultChan():
+			if !ok {
+				return
+			}
+			if accessor, err := meta.Accessor(passedOn.Object); err == nil {
+				if eventResourceVersion, err := strconv.ParseUint(accessor.GetResourceVersion(), 10, 64); err == nil && eventResourceVersion > resourceVersion {
+					resourceVersion = eventResourceVersion
+				}
+			}
+			event = passedOn
+		case <-ticker.C:
+			resourceVersion++
+			event = watch.Event{Type: BookmarkEventType, Object: newBookmark(strconv.FormatUint(resourceVersion, 10))}
+		}
+		select {
+		case <-w.stop:
+			return
+		case w.result <- event:
+		}
+	}
+}
+
+func (w *bookmarkWatcher) Stop() {
+	w.stopOnce.Do(func() { close(w.stop) })
+}
+
+func (w *bookmarkWatcher) ResultChan() <-chan watch.Event {
+	return w.result
+}
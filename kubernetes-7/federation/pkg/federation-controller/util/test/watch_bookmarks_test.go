@@ -0,0 +1,78 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testutil
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	core "k8s.io/client-go/testing"
+	fakefedclientset "github.com/sourcegraph/monorepo-test-1/kubernetes-7/federation/client/clientset_generated/federation_internalclientset/fake"
+	"github.com/sourcegraph/monorepo-test-1/kubernetes-7/pkg/api"
+)
+
+func TestPrependBookmarkWatchReactor(t *testing.T) {
+	client := fakefedclientset.NewSimpleClientset()
+	configMapWatch := watch.NewFake()
+	client.PrependWatchReactor("configmaps", core.DefaultWatchReactor(configMapWatch, nil))
+	PrependBookmarkWatchReactor(&client.Fake, "configmaps", time.Millisecond, func(resourceVersion string) runtime.Object {
+		return &api.ConfigMap{ObjectMeta: metav1.ObjectMeta{ResourceVersion: resourceVersion}}
+	})
+
+	watcher, err := client.Core().ConfigMaps("ns").Watch(metav1.ListOptions{ResourceVersion: "10"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	go configMapWatch.Add(&api.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "ns", ResourceVersion: "20"}})
+
+	lastResourceVersion, bookmarks, added := 10, 0, false
+	for bookmarks < 3 || !added {
+		select {
+		case event := <-watcher.ResultChan():
+			resourceVersion, err := strconv.Atoi(event.Object.(*api.ConfigMap).ResourceVersion)
+			if err != nil {
+				t.Fatalf("unexpected resourceVersion: %v", err)
+			}
+			switch event.Type {
+			case BookmarkEventType:
+				if resourceVersion <= lastResourceVersion {
+					t.Errorf("expected bookmark resourceVersion greater than %d, got %d", lastResourceVersion, resourceVersion)
+				}
+				bookmarks++
+			case watch.Added:
+				added = true
+			default:
+				t.Fatalf("unexpected event %v", event.Type)
+			}
+			lastResourceVersion = resourceVersion
+		case <-time.After(wait.ForeverTestTimeout):
+			t.Fatalf("timed out after %d bookmarks, added event received: %v", bookmarks, added)
+		}
+	}
+
+	watcher.Stop()
+	for range watcher.ResultChan() {
+	}
+	if !configMapWatch.IsStopped() {
+		t.Errorf("expected the configMap watch to be stopped")
+	}
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"sort"
+
+	"k8s.io/apimachinery/pkg/types"
+	"github.com/sourcegraph/monorepo-test-1/kubernetes-7/pkg/api"
+)
+
+// compactAddressKey identifies an address within a compact view.
+type compactAddressKey struct {
+	ip  string
+	uid types.UID
+}
+
+// CompactView returns the ready addresses of endpoints indexed by port, so
+// that consumers of large services can look up the addresses of a port
+// without scanning every subset. An address listed by several subsets appears
+// once per port, and the addresses of each port are sorted by IP and then by
+// target UID. Ports without ready addresses are omitted.
+func CompactView(endpoints *api.Endpoints) map[api.EndpointPort][]api.EndpointAddress {
+	view := map[api.EndpointPort][]api.EndpointAddress{}
+	seen := map[api.EndpointPort]map[compactAddressKey]bool{}
+	for i := range endpoints.Subsets {
+		ss := &endpoints.Subsets[i]
+		for _, port := range ss.Ports {
+			if seen[port] == nil {
+				seen[port] = map[compactAddressKey]bool{}
+			}
+			for _, addr := range ss.Addresses {
+				key := compactAddressKey{ip: addr.IP}
+				if addr.TargetRef != nil {
+					key.uid = addr.TargetRef.UID
+				}
+				if seen[port][key] {
+					continue
+				}
+				seen[port][key] = true
+				view[port] = append(view[port], addr)
+			}
+		}
+	}
+	for _, addrs := range view {
+		sort.Sort(compactAddressesByIPAndUID(addrs))
+	}
+	return view
+}
+
+type compactAddressesByIPAndUID []api.EndpointAddress
+
+func (sl compactAddressesByIPAndUID) Len() int      { return len(sl) }
+func (sl compactAddressesByIPAndUID) Swap(i, j int) { sl[i], sl[j] = sl[j], sl[i] }
+func (sl compactAddressesByIPAndUID) Less(i, j int) bool {
+	if sl[i].IP != sl[j].IP {
+		return sl[i].IP < sl[j].IP
+	}
+	return compactAddressUID(sl[i]) < compactAddressUID(sl[j])
+}
+
+func compactAddressUID(addr api.EndpointAddress) types.UID {
+	if addr.TargetRef == nil {
+		return ""
+	}
+	return addr.TargetRef.UID
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+	"github.com/sourcegraph/monorepo-test-1/kubernetes-7/pkg/api"
+)
+
+func TestCompactView(t *testing.T) {
+	http := api.EndpointPort{Name: "http", Port: 80, Protocol: "TCP"}
+	https := api.EndpointPort{Name: "https", Port: 443, Protocol: "TCP"}
+	endpoints := &api.Endpoints{
+		Subsets: []api.EndpointSubset{
+			{
+				Addresses: []api.EndpointAddress{{IP: "1.2.3.6"}, {IP: "1.2.3.4"}},
+				Ports:     []api.EndpointPort{http},
+			},
+			{
+				// Overlaps with the first subset on 1.2.3.4:80.
+				Addresses:         []api.EndpointAddress{{IP: "1.2.3.5"}, {IP: "1.2.3.4"}},
+				NotReadyAddresses: []api.EndpointAddress{{IP: "1.2.3.7"}},
+				Ports:             []api.EndpointPort{http, https},
+			},
+			{
+				Addresses: []api.EndpointAddress{{IP: "1.2.3.4", TargetRef: &api.ObjectReference{UID: "uid-1"}}},
+				Ports:     []api.EndpointPort{https},
+			},
+		},
+	}
+	expected := map[api.EndpointPort][]api.EndpointAddress{
+		http: {{IP: "1.2.3.4"}, {IP: "1.2.3.5"}, {IP: "1.2.3.6"}},
+		https: {
+			{IP: "1.2.3.4"},
+			{IP: "1.2.3.4", TargetRef: &api.ObjectReference{UID: "uid-1"}},
+			{IP: "1.2.3.5"},
+		},
+	}
+
+	view := CompactView(endpoints)
+	if !reflect.DeepEqual(view, expected) {
+		t.Errorf("expected %s, got %s", spew.Sprint(expected), spew.Sprint(view))
+	}
+}
@@ -18,10 +18,14 @@ package endpoint
 
 import (
 	"fmt"
+	"net"
+	"sort"
 
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
 	"k8s.io/apiserver/pkg/registry/generic"
@@ -32,52 +36,318 @@ import (
 	"github.com/sourcegraph/monorepo-test-1/kubernetes-7/pkg/api/validation"
 )
 
-// endpointsStrategy implements behavior for Endpoints
-type endpointsStrategy struct {
+// OverCapacityAnnotation is set on Endpoints with more addresses than the
+// MaxAddresses of the StrategyOptions of a strategy returned by NewStrategy.
+// Consumers seeing it should not rely on the object being complete and
+// consult EndpointSlices instead.
+const OverCapacityAnnotation = "endpoints.kubernetes.io/over-capacity"
+
+// OverCapacityAnnotationValue is the value of OverCapacityAnnotation.
+const OverCapacityAnnotationValue = "warning"
+
+// StrategyOptions are the optional behaviors of the strategy returned by
+// NewStrategy. The zero value is the behavior of Strategy.
+type StrategyOptions struct {
+	// MaxAddresses, if positive, is the number of addresses, ready or not,
+	// above which Endpoints get OverCapacityAnnotation on create and update.
+	// The annotation is removed from the others. Oversized Endpoints are
+	// still accepted, this is a migration aid for consumers of very large
+	// services.
+	MaxAddresses int
+
+	// RejectEmptySubsetsOnCreate makes Validate reject Endpoints created
+	// without subsets, which usually come from a misbehaving controller.
+	// Updates may always remove all subsets, the endpoints controller does
+	// so for services without ready pods.
+	RejectEmptySubsetsOnCreate bool
+}
+
+// EndpointsStrategy implements behavior for Endpoints
+type EndpointsStrategy struct {
 	runtime.ObjectTyper
 	names.NameGenerator
+
+	options StrategyOptions
 }
 
 // Strategy is the default logic that applies when creating and updating Endpoint
 // objects via the REST API.
-var Strategy = endpointsStrategy{api.Scheme, names.SimpleNameGenerator}
+var Strategy = NewStrategy(StrategyOptions{})
+
+// NewStrategy returns the logic that applies when creating and updating
+// Endpoint objects via the REST API with the given options.
+func NewStrategy(options StrategyOptions) EndpointsStrategy {
+	return EndpointsStrategy{ObjectTyper: api.Scheme, NameGenerator: names.SimpleNameGenerator, options: options}
+}
 
 // NamespaceScoped is true for endpoints.
-func (endpointsStrategy) NamespaceScoped() bool {
+func (EndpointsStrategy) NamespaceScoped() bool {
 	return true
 }
 
 // PrepareForCreate clears fields that are not allowed to be set by end users on creation.
-func (endpointsStrategy) PrepareForCreate(ctx genericapirequest.Context, obj runtime.Object) {
+func (s EndpointsStrategy) PrepareForCreate(ctx genericapirequest.Context, obj runtime.Object) {
+	endpoints := obj.(*api.Endpoints)
+	s.annotateOverCapacity(endpoints)
 }
 
 // PrepareForUpdate clears fields that are not allowed to be set by end users on update.
-func (endpointsStrategy) PrepareForUpdate(ctx genericapirequest.Context, obj, old runtime.Object) {
+func (s EndpointsStrategy) PrepareForUpdate(ctx genericapirequest.Context, obj, old runtime.Object) {
+	s.annotateOverCapacity(obj.(*api.Endpoints))
+}
+
+// annotateOverCapacity sets or removes OverCapacityAnnotation depending on
+// whether endpoints has more than MaxAddresses addresses. It does nothing if
+// MaxAddresses is not set.
+func (s EndpointsStrategy) annotateOverCapacity(endpoints *api.Endpoints) {
+	if s.options.MaxAddresses <= 0 {
+		return
+	}
+	addresses := 0
+	for i := range endpoints.Subsets {
+		addresses += len(endpoints.Subsets[i].Addresses) + len(endpoints.Subsets[i].NotReadyAddresses)
+	}
+	if addresses <= s.options.MaxAddresses {
+		delete(endpoints.Annotations, OverCapacityAnnotation)
+		return
+	}
+	if endpoints.Annotations == nil {
+		endpoints.Annotations = map[string]string{}
+	}
+	endpoints.Annotations[OverCapacityAnnotation] = OverCapacityAnnotationValue
 }
 
 // Validate validates a new endpoints.
-func (endpointsStrategy) Validate(ctx genericapirequest.Context, obj runtime.Object) field.ErrorList {
-	return validation.ValidateEndpoints(obj.(*api.Endpoints))
+func (s EndpointsStrategy) Validate(ctx genericapirequest.Context, obj runtime.Object) field.ErrorList {
+	endpoints := obj.(*api.Endpoints)
+	errorList := validation.ValidateEndpoints(endpoints)
+	if s.options.RejectEmptySubsetsOnCreate && len(endpoints.Subsets) == 0 {
+		errorList = append(errorList, field.Required(field.NewPath("subsets"), "must have at least one subset on create"))
+	}
+	return append(errorList, validateAddressesNotReadyAddressesDisjoint(endpoints)...)
 }
 
-// Canonicalize normalizes the object after validation.
-func (endpointsStrategy) Canonicalize(obj runtime.Object) {
+// validateAddressesNotReadyAddressesDisjoint ensures that no address of a
+// subset is listed both as ready and as not ready, since kube-proxy cannot
+// tell which of the two is meant.
+func validateAddressesNotReadyAddressesDisjoint(endpoints *api.Endpoints) field.ErrorList {
+	allErrs := field.ErrorList{}
+	subsetsPath := field.NewPath("subsets")
+	for i := range endpoints.Subsets {
+		ss := &endpoints.Subsets[i]
+		ready := make(map[string]bool, len(ss.Addresses))
+		for j := range ss.Addresses {
+			ready[ss.Addresses[j].IP] = true
+		}
+		for j := range ss.NotReadyAddresses {
+			addr := &ss.NotReadyAddresses[j]
+			if ready[addr.IP] {
+				allErrs = append(allErrs, field.Invalid(subsetsPath.Index(i).Child("notReadyAddresses").Index(j).Child("ip"), addr.IP, "must not also be listed in addresses"))
+			}
+		}
+	}
+	return allErrs
+}
+
+// validateAddressIPs returns an error for every address, ready or not, whose
+// IP check rejects with a non-empty message.
+func validateAddressIPs(endpoints *api.Endpoints, check func(ip string) string) field.ErrorList {
+	allErrs := field.ErrorList{}
+	subsetsPath := field.NewPath("subsets")
+	validate := func(addrs []api.EndpointAddress, fldPath *field.Path) {
+		for i := range addrs {
+			if msg := check(addrs[i].IP); msg != "" {
+				allErrs = append(allErrs, field.Invalid(fldPath.Index(i).Child("ip"), addrs[i].IP, msg))
+			}
+		}
+	}
+	for i := range endpoints.Subsets {
+		ss := &endpoints.Subsets[i]
+		validate(ss.Addresses, subsetsPath.Index(i).Child("addresses"))
+		validate(ss.NotReadyAddresses, subsetsPath.Index(i).Child("notReadyAddresses"))
+	}
+	return allErrs
+}
+
+// ValidateEndpointsAgainstService ensures that the port names of endpoints
+// match the port names of the service they belong to, and that none of their
+// addresses is the cluster IP of the service, which controllers have been
+// seen to add by mistake. The endpoints of a headless service may be managed
+// manually, and endpoint ports whose names are not service port names are
+// left out of the DNS SRV records. The service is not available to the
+// strategy, so this is meant for callers that have both, e.g. an admission
+// webhook.
+func ValidateEndpointsAgainstService(ep *api.Endpoints, svc *api.Service) field.ErrorList {
+	allErrs := field.ErrorList{}
+	portNames := sets.NewString()
+	for i := range svc.Spec.Ports {
+		portNames.Insert(svc.Spec.Ports[i].Name)
+	}
+	subsetsPath := field.NewPath("subsets")
+	for i := range ep.Subsets {
+		ss := &ep.Subsets[i]
+		for j := range ss.Ports {
+			if name := ss.Ports[j].Name; !portNames.Has(name) {
+				allErrs = append(allErrs, field.NotSupported(subsetsPath.Index(i).Child("ports").Index(j).Child("name"), name, portNames.List()))
+			}
+		}
+	}
+	if clusterIP := net.ParseIP(svc.Spec.ClusterIP); clusterIP != nil {
+		allErrs = append(allErrs, validateAddressIPs(ep, func(ip string) string {
+			if clusterIP.Equal(net.ParseIP(ip)) {
+				return "may not be the cluster IP of the service"
+			}
+			return ""
+		})...)
+	}
+	return allErrs
+}
+
+// Canonicalize normalizes the object after validation. It only rewrites the
+// subsets into their canonical form and is idempotent, so it is safe to run
+// again on an already canonical object, e.g. for a dry-run followed by the
+// actual create.
+//
+// Unlike RepackSubsets of pkg/api/endpoints, it does not merge addresses
+// that only differ by hostname, since per-pod DNS depends on distinct
+// hostnames.
+//
+// Ports without a protocol are set to TCP, the default protocol, first so
+// that they merge with the same ports given with an explicit TCP protocol,
+// see defaultPortProtocols.
+func (EndpointsStrategy) Canonicalize(obj runtime.Object) {
 	endpoints := obj.(*api.Endpoints)
-	endpoints.Subsets = endptspkg.RepackSubsets(endpoints.Subsets)
+	defaultPortProtocols(endpoints.Subsets)
+	endpoints.Subsets = repackSubsets(endpoints.Subsets)
+}
+
+// defaultPortProtocols sets the protocol of the ports of subsets that do not
+// have one to TCP. Requests never get here without a protocol, versioned
+// defaulting sets it and ValidateEndpoints rejects an empty one. It guards
+// internal callers that canonicalize endpoints built in code, which skip both.
+func defaultPortProtocols(subsets []api.EndpointSubset) {
+	for i := range subsets {
+		for j := range subsets[i].Ports {
+			if subsets[i].Ports[j].Protocol == "" {
+				subsets[i].Ports[j].Protocol = api.ProtocolTCP
+			}
+		}
+	}
+}
+
+// endpointAddressKey identifies an address the way RepackSubsets does when
+// merging addresses, plus its hostname.
+type endpointAddressKey struct {
+	ip       string
+	uid      types.UID
+	hostname string
+}
+
+func newEndpointAddressKey(addr *api.EndpointAddress) endpointAddressKey {
+	key := endpointAddressKey{ip: addr.IP, hostname: addr.Hostname}
+	if addr.TargetRef != nil {
+		key.uid = addr.TargetRef.UID
+	}
+	return key
+}
+
+type endpointAddressKeys []endpointAddressKey
+
+func (sl endpointAddressKeys) Len() int      { return len(sl) }
+func (sl endpointAddressKeys) Swap(i, j int) { sl[i], sl[j] = sl[j], sl[i] }
+func (sl endpointAddressKeys) Less(i, j int) bool {
+	if sl[i].ip != sl[j].ip {
+		return sl[i].ip < sl[j].ip
+	}
+	if sl[i].uid != sl[j].uid {
+		return sl[i].uid < sl[j].uid
+	}
+	return sl[i].hostname < sl[j].hostname
+}
+
+// repackSubsets is RepackSubsets of pkg/api/endpoints with the hostname as
+// part of the key of addresses. It maps every port to the addresses offering
+// it, an address that is ready for a port in any subset is ready for it, and
+// then groups the ports offered by the same addresses into a subset. The
+// result is sorted by SortSubsets, so that it equals what the endpoints
+// controller stores for the same subsets.
+func repackSubsets(subsets []api.EndpointSubset) []api.EndpointSubset {
+	addresses := map[endpointAddressKey]api.EndpointAddress{}
+	portAddresses := map[api.EndpointPort]map[endpointAddressKey]bool{}
+	mapAddresses := func(addrs []api.EndpointAddress, port api.EndpointPort, ready bool) {
+		for i := range addrs {
+			key := newEndpointAddressKey(&addrs[i])
+			if _, found := addresses[key]; !found {
+				addresses[key] = addrs[i]
+			}
+			if portAddresses[port] == nil {
+				portAddresses[port] = map[endpointAddressKey]bool{}
+			}
+			if wasReady, found := portAddresses[port][key]; !found || !wasReady {
+				portAddresses[port][key] = ready
+			}
+		}
+	}
+	for i := range subsets {
+		ports := subsets[i].Ports
+		if len(ports) == 0 {
+			// Don't discard addresses without ports, use a sentinel.
+			ports = []api.EndpointPort{{Port: -1}}
+		}
+		for _, port := range ports {
+			mapAddresses(subsets[i].Addresses, port, true)
+			mapAddresses(subsets[i].NotReadyAddresses, port, false)
+		}
+	}
+
+	repacked := map[string]*api.EndpointSubset{}
+	for port, ready := range portAddresses {
+		keys := make(endpointAddressKeys, 0, len(ready))
+		for key := range ready {
+			keys = append(keys, key)
+		}
+		sort.Sort(keys)
+		id := ""
+		for _, key := range keys {
+			id += fmt.Sprintf("%q/%q/%q/%t,", key.ip, key.uid, key.hostname, ready[key])
+		}
+		subset, found := repacked[id]
+		if !found {
+			subset = &api.EndpointSubset{}
+			for _, key := range keys {
+				if ready[key] {
+					subset.Addresses = append(subset.Addresses, addresses[key])
+				} else {
+					subset.NotReadyAddresses = append(subset.NotReadyAddresses, addresses[key])
+				}
+			}
+			repacked[id] = subset
+		}
+		if port.Port > 0 { // avoid sentinels
+			subset.Ports = append(subset.Ports, port)
+		}
+	}
+
+	final := []api.EndpointSubset{}
+	for _, subset := range repacked {
+		final = append(final, *subset)
+	}
+	return endptspkg.SortSubsets(final)
 }
 
 // AllowCreateOnUpdate is true for endpoints.
-func (endpointsStrategy) AllowCreateOnUpdate() bool {
+func (EndpointsStrategy) AllowCreateOnUpdate() bool {
 	return true
 }
 
 // ValidateUpdate is the default update validation for an end user.
-func (endpointsStrategy) ValidateUpdate(ctx genericapirequest.Context, obj, old runtime.Object) field.ErrorList {
+func (EndpointsStrategy) ValidateUpdate(ctx genericapirequest.Context, obj, old runtime.Object) field.ErrorList {
 	errorList := validation.ValidateEndpoints(obj.(*api.Endpoints))
+	errorList = append(errorList, validateAddressesNotReadyAddressesDisjoint(obj.(*api.Endpoints))...)
 	return append(errorList, validation.ValidateEndpointsUpdate(obj.(*api.Endpoints), old.(*api.Endpoints))...)
 }
 
-func (endpointsStrategy) AllowUnconditionalUpdate() bool {
+func (EndpointsStrategy) AllowUnconditionalUpdate() bool {
 	return true
 }
 
@@ -99,6 +369,18 @@ func MatchEndpoints(label labels.Selector, field fields.Selector) pkgstorage.Sel
 	}
 }
 
+// SelectableFieldKeys returns the sorted field selector keys supported by
+// endpoints, e.g. for tools that build field selectors. They are derived from
+// EndpointsToSelectableFields, so the two can't get out of sync.
+func SelectableFieldKeys() []string {
+	keys := []string{}
+	for key := range EndpointsToSelectableFields(&api.Endpoints{}) {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // EndpointsToSelectableFields returns a field set that represents the object
 // TODO: fields are not labels, and the validation rules for them do not apply.
 func EndpointsToSelectableFields(endpoints *api.Endpoints) fields.Set {
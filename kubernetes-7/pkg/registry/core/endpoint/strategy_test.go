@@ -17,9 +17,15 @@ limitations under the License.
 package endpoint
 
 import (
+	"reflect"
+	"sort"
 	"testing"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
 	"github.com/sourcegraph/monorepo-test-1/kubernetes-7/pkg/api"
+	endptspkg "github.com/sourcegraph/monorepo-test-1/kubernetes-7/pkg/api/endpoints"
 	apitesting "github.com/sourcegraph/monorepo-test-1/kubernetes-7/pkg/api/testing"
 )
 
@@ -31,3 +37,508 @@ func TestSelectableFieldLabelConversions(t *testing.T) {
 		nil,
 	)
 }
+
+func TestValidateAddressInAddressesAndNotReadyAddresses(t *testing.T) {
+	ctx := genericapirequest.NewDefaultContext()
+	endpoints := &api.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: metav1.NamespaceDefault},
+		Subsets: []api.EndpointSubset{
+			{
+				Addresses:         []api.EndpointAddress{{IP: "10.10.1.1"}},
+				NotReadyAddresses: []api.EndpointAddress{{IP: "10.10.1.2"}},
+				Ports:             []api.EndpointPort{{Name: "a", Port: 93, Protocol: "TCP"}},
+			},
+			{
+				Addresses:         []api.EndpointAddress{{IP: "10.10.2.1"}, {IP: "10.10.2.2"}},
+				NotReadyAddresses: []api.EndpointAddress{{IP: "10.10.2.3"}, {IP: "10.10.2.2"}},
+				Ports:             []api.EndpointPort{{Name: "b", Port: 76, Protocol: "TCP"}},
+			},
+		},
+	}
+
+	errs := Strategy.Validate(ctx, endpoints)
+	if len(errs) != 1 {
+		t.Fatalf("expected exactly one error, got %v", errs)
+	}
+	if expected := "subsets[1].notReadyAddresses[1].ip"; errs[0].Field != expected {
+		t.Errorf("expected error at %s, got %s", expected, errs[0].Field)
+	}
+
+	endpoints.Subsets[1].NotReadyAddresses = []api.EndpointAddress{{IP: "10.10.2.3"}}
+	if errs := Strategy.Validate(ctx, endpoints); len(errs) != 0 {
+		t.Errorf("expected success, got %v", errs)
+	}
+}
+
+func TestCanonicalizeIsIdempotent(t *testing.T) {
+	testCases := map[string][]api.EndpointSubset{
+		"no subsets": nil,
+		"unsorted and duplicated": {
+			{
+				Addresses: []api.EndpointAddress{{IP: "10.10.1.2"}, {IP: "10.10.1.1"}, {IP: "10.10.1.2"}},
+				Ports:     []api.EndpointPort{{Name: "b", Port: 76, Protocol: "TCP"}, {Name: "a", Port: 93, Protocol: "TCP"}},
+			},
+			{
+				Addresses: []api.EndpointAddress{{IP: "10.10.1.1"}},
+				Ports:     []api.EndpointPort{{Name: "a", Port: 93, Protocol: "TCP"}},
+			},
+		},
+		"not ready addresses": {
+			{
+				Addresses:         []api.EndpointAddress{{IP: "10.10.1.1", TargetRef: &api.ObjectReference{Kind: "Pod", Name: "pod1"}}},
+				NotReadyAddresses: []api.EndpointAddress{{IP: "10.10.1.3"}, {IP: "10.10.1.2"}},
+				Ports:             []api.EndpointPort{{Name: "a", Port: 93, Protocol: "TCP"}},
+			},
+		},
+		"no ports": {
+			{Addresses: []api.EndpointAddress{{IP: "10.10.1.1"}}},
+		},
+	}
+
+	for name, subsets := range testCases {
+		endpoints := &api.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: metav1.NamespaceDefault},
+			Subsets:    subsets,
+		}
+		Strategy.Canonicalize(endpoints)
+		copied, err := api.Scheme.DeepCopy(endpoints)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		canonical := copied.(*api.Endpoints)
+
+		Strategy.Canonicalize(endpoints)
+		if !reflect.DeepEqual(canonical, endpoints) {
+			t.Errorf("%s: expected Canonicalize to be idempotent, got %#v after first and %#v after second run", name, canonical.Subsets, endpoints.Subsets)
+		}
+	}
+}
+
+func TestCanonicalizePreservesDistinctHostnames(t *testing.T) {
+	endpoints := &api.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: metav1.NamespaceDefault},
+		Subsets: []api.EndpointSubset{
+			{
+				Addresses: []api.EndpointAddress{{IP: "10.10.1.2"}, {IP: "10.10.1.1", Hostname: "web-0"}},
+				Ports:     []api.EndpointPort{{Name: "a", Port: 93, Protocol: "TCP"}},
+			},
+			{
+				Addresses: []api.EndpointAddress{{IP: "10.10.1.1", Hostname: "web-1"}, {IP: "10.10.1.2"}},
+				Ports:     []api.EndpointPort{{Name: "a", Port: 93, Protocol: "TCP"}},
+			},
+		},
+	}
+
+	Strategy.Canonicalize(endpoints)
+
+	// The other addresses are still repacked.
+	expected := []api.EndpointSubset{
+		{
+			Addresses: []api.EndpointAddress{{IP: "10.10.1.1", Hostname: "web-0"}, {IP: "10.10.1.1", Hostname: "web-1"}, {IP: "10.10.1.2"}},
+			Ports:     []api.EndpointPort{{Name: "a", Port: 93, Protocol: "TCP"}},
+		},
+	}
+	if !reflect.DeepEqual(endpoints.Subsets, expected) {
+		t.Errorf("expected the subsets to be repacked into %#v, got %#v", expected, endpoints.Subsets)
+	}
+}
+
+func TestCanonicalizeMatchesRepackSubsets(t *testing.T) {
+	subsets := []api.EndpointSubset{
+		{
+			Addresses:         []api.EndpointAddress{{IP: "10.10.1.2"}, {IP: "10.10.1.1", Hostname: "web-0"}},
+			NotReadyAddresses: []api.EndpointAddress{{IP: "10.10.1.3"}},
+			Ports:             []api.EndpointPort{{Name: "b", Port: 76, Protocol: "TCP"}, {Name: "a", Port: 93, Protocol: "TCP"}},
+		},
+		{
+			Addresses: []api.EndpointAddress{{IP: "10.10.1.2"}},
+			Ports:     []api.EndpointPort{{Name: "c", Port: 8080, Protocol: "UDP"}},
+		},
+		{
+			Addresses:         []api.EndpointAddress{{IP: "10.10.1.4"}},
+			NotReadyAddresses: []api.EndpointAddress{{IP: "10.10.1.5"}},
+			Ports:             []api.EndpointPort{{Name: "a", Port: 93, Protocol: "TCP"}},
+		},
+	}
+	copied, err := api.Scheme.DeepCopy(subsets)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := endptspkg.RepackSubsets(copied.([]api.EndpointSubset))
+	endpoints := &api.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: metav1.NamespaceDefault},
+		Subsets:    subsets,
+	}
+
+	Strategy.Canonicalize(endpoints)
+
+	if !reflect.DeepEqual(endpoints.Subsets, expected) {
+		t.Errorf("expected the subsets the endpoints controller stores, %#v, got %#v", expected, endpoints.Subsets)
+	}
+}
+
+func TestCanonicalizeReadyWins(t *testing.T) {
+	endpoints := &api.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: metav1.NamespaceDefault},
+		Subsets: []api.EndpointSubset{
+			{
+				Addresses: []api.EndpointAddress{{IP: "10.10.1.1"}},
+				Ports:     []api.EndpointPort{{Name: "a", Port: 93, Protocol: "TCP"}},
+			},
+			{
+				NotReadyAddresses: []api.EndpointAddress{{IP: "10.10.1.1"}},
+				Ports:             []api.EndpointPort{{Name: "a", Port: 93, Protocol: "TCP"}},
+			},
+		},
+	}
+
+	Strategy.Canonicalize(endpoints)
+
+	expected := []api.EndpointSubset{
+		{
+			Addresses: []api.EndpointAddress{{IP: "10.10.1.1"}},
+			Ports:     []api.EndpointPort{{Name: "a", Port: 93, Protocol: "TCP"}},
+		},
+	}
+	if !reflect.DeepEqual(endpoints.Subsets, expected) {
+		t.Errorf("expected the ready listing to win, got %#v", endpoints.Subsets)
+	}
+}
+
+func TestCanonicalizeDefaultsPortProtocol(t *testing.T) {
+	endpoints := &api.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: metav1.NamespaceDefault},
+		Subsets: []api.EndpointSubset{
+			{
+				Addresses: []api.EndpointAddress{{IP: "10.10.1.1"}},
+				Ports:     []api.EndpointPort{{Name: "a", Port: 93, Protocol: api.ProtocolTCP}},
+			},
+			{
+				Addresses: []api.EndpointAddress{{IP: "10.10.1.2"}},
+				Ports:     []api.EndpointPort{{Name: "a", Port: 93}},
+			},
+		},
+	}
+
+	Strategy.Canonicalize(endpoints)
+
+	expected := []api.EndpointSubset{
+		{
+			Addresses: []api.EndpointAddress{{IP: "10.10.1.1"}, {IP: "10.10.1.2"}},
+			Ports:     []api.EndpointPort{{Name: "a", Port: 93, Protocol: api.ProtocolTCP}},
+		},
+	}
+	if !reflect.DeepEqual(endpoints.Subsets, expected) {
+		t.Errorf("expected the subsets to merge into %#v, got %#v", expected, endpoints.Subsets)
+	}
+}
+
+func TestValidateEndpointsAgainstService(t *testing.T) {
+	svc := &api.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: metav1.NamespaceDefault},
+		Spec: api.ServiceSpec{
+			ClusterIP: api.ClusterIPNone,
+			Ports: []api.ServicePort{
+				{Name: "http", Port: 80, Protocol: "TCP"},
+				{Name: "https", Port: 443, Protocol: "TCP"},
+			},
+		},
+	}
+	testCases := map[string]struct {
+		ports          []api.EndpointPort
+		expectedFields []string
+	}{
+		"aligned port names": {
+			ports: []api.EndpointPort{{Name: "http", Port: 8080, Protocol: "TCP"}, {Name: "https", Port: 8443, Protocol: "TCP"}},
+		},
+		"subset of the port names": {
+			ports: []api.EndpointPort{{Name: "https", Port: 8443, Protocol: "TCP"}},
+		},
+		"misaligned port name": {
+			ports:          []api.EndpointPort{{Name: "http", Port: 8080, Protocol: "TCP"}, {Name: "web", Port: 8443, Protocol: "TCP"}},
+			expectedFields: []string{"subsets[0].ports[1].name"},
+		},
+		"unnamed port": {
+			ports:          []api.EndpointPort{{Port: 8080, Protocol: "TCP"}},
+			expectedFields: []string{"subsets[0].ports[0].name"},
+		},
+	}
+
+	for name, tc := range testCases {
+		endpoints := &api.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: metav1.NamespaceDefault},
+			Subsets: []api.EndpointSubset{
+				{
+					Addresses: []api.EndpointAddress{{IP: "10.10.1.1"}},
+					Ports:     tc.ports,
+				},
+			},
+		}
+		errs := ValidateEndpointsAgainstService(endpoints, svc)
+		if len(errs) != len(tc.expectedFields) {
+			t.Errorf("%s: expected %d errors, got %v", name, len(tc.expectedFields), errs)
+			continue
+		}
+		for i, expected := range tc.expectedFields {
+			if errs[i].Field != expected {
+				t.Errorf("%s: expected error at %s, got %s", name, expected, errs[i].Field)
+			}
+		}
+	}
+}
+
+func TestOverCapacityAnnotatingStrategy(t *testing.T) {
+	ctx := genericapirequest.NewDefaultContext()
+	strategy := NewStrategy(StrategyOptions{MaxAddresses: 2})
+	newEndpoints := func(ips ...string) *api.Endpoints {
+		addresses := []api.EndpointAddress{}
+		for _, ip := range ips {
+			addresses = append(addresses, api.EndpointAddress{IP: ip})
+		}
+		return &api.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: metav1.NamespaceDefault},
+			Subsets: []api.EndpointSubset{
+				{
+					Addresses: addresses,
+					Ports:     []api.EndpointPort{{Name: "a", Port: 93, Protocol: "TCP"}},
+				},
+			},
+		}
+	}
+
+	small := newEndpoints("10.10.1.1", "10.10.1.2")
+	strategy.PrepareForCreate(ctx, small)
+	if _, exists := small.Annotations[OverCapacityAnnotation]; exists {
+		t.Errorf("expected no %s annotation on endpoints within capacity, got %v", OverCapacityAnnotation, small.Annotations)
+	}
+
+	oversized := newEndpoints("10.10.1.1", "10.10.1.2", "10.10.1.3")
+	strategy.PrepareForCreate(ctx, oversized)
+	if value := oversized.Annotations[OverCapacityAnnotation]; value != OverCapacityAnnotationValue {
+		t.Errorf("expected %s annotation %q on endpoints over capacity, got %v", OverCapacityAnnotation, OverCapacityAnnotationValue, oversized.Annotations)
+	}
+
+	shrunk := newEndpoints("10.10.1.1")
+	shrunk.Annotations = oversized.Annotations
+	strategy.PrepareForUpdate(ctx, shrunk, oversized)
+	if _, exists := shrunk.Annotations[OverCapacityAnnotation]; exists {
+		t.Errorf("expected the %s annotation to be removed once the endpoints are within capacity, got %v", OverCapacityAnnotation, shrunk.Annotations)
+	}
+
+	unlimited := newEndpoints("10.10.1.1", "10.10.1.2", "10.10.1.3")
+	Strategy.PrepareForCreate(ctx, unlimited)
+	if _, exists := unlimited.Annotations[OverCapacityAnnotation]; exists {
+		t.Errorf("expected the default strategy not to annotate endpoints, got %v", unlimited.Annotations)
+	}
+}
+
+func TestSelectableFieldKeys(t *testing.T) {
+	endpoints := &api.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: metav1.NamespaceDefault},
+	}
+	_, fields, err := GetAttrs(endpoints)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{}
+	for key := range fields {
+		expected = append(expected, key)
+	}
+	sort.Strings(expected)
+
+	if keys := SelectableFieldKeys(); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected selectable field keys %v, got %v", expected, keys)
+	}
+}
+
+func TestEndpointsStrategyEmptySubsets(t *testing.T) {
+	ctx := genericapirequest.NewDefaultContext()
+	newEndpoints := func(subsets ...api.EndpointSubset) *api.Endpoints {
+		return &api.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: metav1.NamespaceDefault, ResourceVersion: "1"},
+			Subsets:    subsets,
+		}
+	}
+	subset := api.EndpointSubset{
+		Addresses: []api.EndpointAddress{{IP: "10.10.1.1"}, {IP: "10.10.1.2"}},
+		Ports:     []api.EndpointPort{{Name: "a", Port: 93, Protocol: "TCP"}},
+	}
+
+	testCases := map[string]EndpointsStrategy{
+		"default":                  Strategy,
+		"reject":                   NewStrategy(StrategyOptions{RejectEmptySubsetsOnCreate: true}),
+		"reject and max addresses": NewStrategy(StrategyOptions{RejectEmptySubsetsOnCreate: true, MaxAddresses: 1}),
+	}
+	for name, strategy := range testCases {
+		empty := newEndpoints()
+		strategy.PrepareForCreate(ctx, empty)
+		errs := strategy.Validate(ctx, empty)
+		if strategy.options.RejectEmptySubsetsOnCreate {
+			if len(errs) != 1 || errs[0].Type != field.ErrorTypeRequired || errs[0].Field != "subsets" {
+				t.Errorf("%s: expected creating empty endpoints to require subsets, got %v", name, errs)
+			}
+		} else if len(errs) != 0 {
+			t.Errorf("%s: expected creating empty endpoints to be allowed, got %v", name, errs)
+		}
+		withSubsets := newEndpoints(subset)
+		strategy.PrepareForCreate(ctx, withSubsets)
+		if errs := strategy.Validate(ctx, withSubsets); len(errs) != 0 {
+			t.Errorf("%s: expected no errors creating endpoints with subsets, got %v", name, errs)
+		}
+		if _, exists := withSubsets.Annotations[OverCapacityAnnotation]; exists != (strategy.options.MaxAddresses > 0) {
+			t.Errorf("%s: expected the %s annotation only with max addresses, got %v", name, OverCapacityAnnotation, withSubsets.Annotations)
+		}
+		if errs := strategy.ValidateUpdate(ctx, newEndpoints(), newEndpoints(subset)); len(errs) != 0 {
+			t.Errorf("%s: expected updates removing all subsets to be allowed, got %v", name, errs)
+		}
+	}
+}
+
+func TestValidateLoopbackAndUnspecifiedAddresses(t *testing.T) {
+	ctx := genericapirequest.NewDefaultContext()
+	newEndpoints := func(ready, notReady string) *api.Endpoints {
+		return &api.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: metav1.NamespaceDefault, ResourceVersion: "1"},
+			Subsets: []api.EndpointSubset{
+				{
+					Addresses:         []api.EndpointAddress{{IP: "10.10.1.1"}, {IP: ready}},
+					NotReadyAddresses: []api.EndpointAddress{{IP: notReady}},
+					Ports:             []api.EndpointPort{{Name: "a", Port: 93, Protocol: "TCP"}},
+				},
+			},
+		}
+	}
+
+	testCases := map[string]struct {
+		ready          string
+		notReady       string
+		expectedFields []string
+	}{
+		"valid addresses": {
+			ready:    "10.10.1.2",
+			notReady: "fd00::1",
+		},
+		"IPv4 loopback": {
+			ready:          "127.0.0.1",
+			notReady:       "10.10.1.3",
+			expectedFields: []string{"subsets[0].addresses[1].ip"},
+		},
+		"IPv4 loopback range": {
+			ready:          "10.10.1.2",
+			notReady:       "127.3.2.1",
+			expectedFields: []string{"subsets[0].notReadyAddresses[0].ip"},
+		},
+		"IPv6 loopback": {
+			ready:          "::1",
+			notReady:       "10.10.1.3",
+			expectedFields: []string{"subsets[0].addresses[1].ip"},
+		},
+		"IPv4 unspecified": {
+			ready:          "0.0.0.0",
+			notReady:       "10.10.1.3",
+			expectedFields: []string{"subsets[0].addresses[1].ip"},
+		},
+		"IPv6 unspecified": {
+			ready:          "10.10.1.2",
+			notReady:       "::",
+			expectedFields: []string{"subsets[0].notReadyAddresses[0].ip"},
+		},
+		"loopback and unspecified": {
+			ready:          "127.0.0.1",
+			notReady:       "0.0.0.0",
+			expectedFields: []string{"subsets[0].addresses[1].ip", "subsets[0].notReadyAddresses[0].ip"},
+		},
+	}
+	for name, tc := range testCases {
+		endpoints := newEndpoints(tc.ready, tc.notReady)
+		errs := Strategy.Validate(ctx, endpoints)
+		if len(errs) != len(tc.expectedFields) {
+			t.Errorf("%s: expected errors at %v, got %v", name, tc.expectedFields, errs)
+			continue
+		}
+		for i, expected := range tc.expectedFields {
+			if errs[i].Field != expected {
+				t.Errorf("%s: expected error at %s, got %s", name, expected, errs[i].Field)
+			}
+		}
+
+		if errs := Strategy.ValidateUpdate(ctx, endpoints, newEndpoints("10.10.1.2", "10.10.1.3")); len(errs) != len(tc.expectedFields) {
+			t.Errorf("%s: expected update errors at %v, got %v", name, tc.expectedFields, errs)
+		}
+	}
+}
+
+func TestValidateAddressNodeNames(t *testing.T) {
+	ctx := genericapirequest.NewDefaultContext()
+	testCases := map[string]bool{
+		"node-1":                           true,
+		"node-2.us-central1-a.example.com": true,
+		"Node_1":                           false,
+		"node 2":                           false,
+	}
+	for nodeName, valid := range testCases {
+		nodeName := nodeName
+		endpoints := &api.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: metav1.NamespaceDefault},
+			Subsets: []api.EndpointSubset{
+				{
+					NotReadyAddresses: []api.EndpointAddress{{IP: "10.10.1.1", NodeName: &nodeName}},
+					Ports:             []api.EndpointPort{{Name: "a", Port: 93, Protocol: "TCP"}},
+				},
+			},
+		}
+		errs := Strategy.Validate(ctx, endpoints)
+		if valid && len(errs) != 0 {
+			t.Errorf("node name %q: expected success, got %v", nodeName, errs)
+		} else if !valid && (len(errs) != 1 || errs[0].Field != "subsets[0].notReadyAddresses[0].nodeName") {
+			t.Errorf("node name %q: expected one error at subsets[0].notReadyAddresses[0].nodeName, got %v", nodeName, errs)
+		}
+	}
+}
+
+func TestValidateEndpointsAgainstServiceClusterIP(t *testing.T) {
+	newService := func(clusterIP string) *api.Service {
+		return &api.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: metav1.NamespaceDefault},
+			Spec: api.ServiceSpec{
+				ClusterIP: clusterIP,
+				Ports:     []api.ServicePort{{Name: "http", Port: 80, Protocol: "TCP"}},
+			},
+		}
+	}
+	endpoints := &api.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: metav1.NamespaceDefault},
+		Subsets: []api.EndpointSubset{
+			{
+				Addresses:         []api.EndpointAddress{{IP: "10.10.1.1"}},
+				NotReadyAddresses: []api.EndpointAddress{{IP: "10.0.0.10"}},
+				Ports:             []api.EndpointPort{{Name: "http", Port: 8080, Protocol: "TCP"}},
+			},
+		},
+	}
+
+	testCases := map[string]struct {
+		clusterIP      string
+		expectedFields []string
+	}{
+		"headless service": {clusterIP: api.ClusterIPNone},
+		"no cluster IP":    {clusterIP: ""},
+		"other cluster IP": {clusterIP: "10.0.0.11"},
+		"cluster IP as endpoint": {
+			clusterIP:      "10.0.0.10",
+			expectedFields: []string{"subsets[0].notReadyAddresses[0].ip"},
+		},
+	}
+	for name, tc := range testCases {
+		errs := ValidateEndpointsAgainstService(endpoints, newService(tc.clusterIP))
+		if len(errs) != len(tc.expectedFields) {
+			t.Errorf("%s: expected errors at %v, got %v", name, tc.expectedFields, errs)
+			continue
+		}
+		for i, expected := range tc.expectedFields {
+			if errs[i].Field != expected {
+				t.Errorf("%s: expected error at %s, got %s", name, expected, errs[i].Field)
+			}
+		}
+	}
+}
@@ -18,12 +18,16 @@ package storage
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"github.com/sourcegraph/monorepo-test-1/kubernetes-7/pkg/api/v1"
 	"github.com/sourcegraph/monorepo-test-1/kubernetes-7/pkg/client/clientset_generated/clientset"
 	"github.com/sourcegraph/monorepo-test-1/kubernetes-7/test/e2e/framework"
@@ -42,6 +46,11 @@ const (
 	kStart           kubeletOpt = "start"
 	kStop            kubeletOpt = "stop"
 	kRestart         kubeletOpt = "restart"
+
+	// volumeMountPath is where framework.MakePod mounts the first claim.
+	volumeMountPath    = "/mnt/volume1"
+	resizePollInterval = 5 * time.Second
+	resizeTimeout      = 5 * time.Minute
 )
 
 var _ = framework.KubeDescribe("PersistentVolumes [Volume][Disruptive][Flaky]", func() {
@@ -141,6 +150,10 @@ var _ = framework.KubeDescribe("PersistentVolumes [Volume][Disruptive][Flaky]",
 				testItStmt: "Should test that a volume mounted to a pod that is deleted while the kubelet is down unmounts when the kubelet returns.",
 				runTest:    testVolumeUnmountsFromDeletedPod,
 			},
+			{
+				testItStmt: "Should test that the expanded size of a volume resized while mounted is still reflected in the pod after kubelet restart.",
+				runTest:    testVolumeResizeSurvivesKubeletRestart,
+			},
 		}
 
 		// Test loop executes each disruptiveTest iteratively.
@@ -194,6 +207,56 @@ func testVolumeUnmountsFromDeletedPod(c clientset.Interface, f *framework.Framew
 	framework.Logf("Volume unmounted on node %s", clientPod.Spec.NodeName)
 }
 
+// testVolumeResizeSurvivesKubeletRestart tests that a volume expanded while mounted to a pod keeps its expanded size
+// after a kubelet restart. The test is skipped if the volume backend or its filesystem does not support expansion.
+func testVolumeResizeSurvivesKubeletRestart(c clientset.Interface, f *framework.Framework, clientPod *v1.Pod, pvc *v1.PersistentVolumeClaim, pv *v1.PersistentVolume) {
+	By("Checking the size of the mounted filesystem.")
+	originalFSSize := podVolumeFSSize(clientPod)
+
+	By("Expanding the claim.")
+	claim, err := c.CoreV1().PersistentVolumeClaims(pvc.Namespace).Get(pvc.Name, metav1.GetOptions{})
+	Expect(err).NotTo(HaveOccurred())
+	currentSize := claim.Spec.Resources.Requests[v1.ResourceStorage]
+	newSize := currentSize.Copy()
+	newSize.Add(resource.MustParse("1Gi"))
+	claim.Spec.Resources.Requests[v1.ResourceStorage] = *newSize
+	if _, err = c.CoreV1().PersistentVolumeClaims(pvc.Namespace).Update(claim); err != nil {
+		framework.Skipf("Volume expansion is not supported: resizing claim %s failed: %v", pvc.Name, err)
+	}
+
+	By("Waiting for the claim capacity to reach the new size.")
+	err = wait.PollImmediate(resizePollInterval, resizeTimeout, func() (bool, error) {
+		claim, err := c.CoreV1().PersistentVolumeClaims(pvc.Namespace).Get(pvc.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		capacity := claim.Status.Capacity[v1.ResourceStorage]
+		return capacity.Cmp(*newSize) >= 0, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		framework.Skipf("Volume expansion is not supported: claim %s was not expanded to %s within %v", pvc.Name, newSize.String(), resizeTimeout)
+	}
+	Expect(err).NotTo(HaveOccurred())
+
+	By("Waiting for the mounted filesystem to be expanded.")
+	var expandedFSSize int64
+	err = wait.PollImmediate(resizePollInterval, resizeTimeout, func() (bool, error) {
+		expandedFSSize = podVolumeFSSize(clientPod)
+		return expandedFSSize > originalFSSize, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		framework.Skipf("Filesystem expansion is not supported: filesystem of pod %s was not expanded beyond %d bytes within %v", clientPod.Name, originalFSSize, resizeTimeout)
+	}
+	Expect(err).NotTo(HaveOccurred())
+
+	By("Restarting kubelet")
+	kubeletCommand(kRestart, c, clientPod)
+
+	By("Testing that the expanded size is still reflected in the pod.")
+	Expect(podVolumeFSSize(clientPod)).To(Equal(expandedFSSize))
+	framework.Logf("Volume of pod %s kept its expanded size of %d bytes post-restart.", clientPod.Name, expandedFSSize)
+}
+
 // initTestCase initializes spec resources (pv, pvc, and pod) and returns pointers to be consumed
 // by the test.
 func initTestCase(f *framework.Framework, c clientset.Interface, pvConfig framework.PersistentVolumeConfig, pvcConfig framework.PersistentVolumeClaimConfig, ns, nodeName string) (*v1.Pod, *v1.PersistentVolume, *v1.PersistentVolumeClaim) {
@@ -252,3 +315,12 @@ func kubeletCommand(kOp kubeletOpt, c clientset.Interface, pod *v1.Pod) {
 func podExec(pod *v1.Pod, bashExec string) (string, error) {
 	return framework.RunKubectl("exec", fmt.Sprintf("--namespace=%s", pod.Namespace), pod.Name, "--", "/bin/sh", "-c", bashExec)
 }
+
+// podVolumeFSSize returns the size in bytes of the filesystem mounted at volumeMountPath in the target pod
+func podVolumeFSSize(pod *v1.Pod) int64 {
+	out, err := podExec(pod, fmt.Sprintf("df -k %s | tail -n 1 | awk '{print $2}'", volumeMountPath))
+	Expect(err).NotTo(HaveOccurred())
+	sizeKB, err := strconv.ParseInt(strings.TrimSpace(out), 10, 64)
+	Expect(err).NotTo(HaveOccurred())
+	return sizeKB * 1024
+}
@@ -17,7 +17,11 @@ limitations under the License.
 package storage
 
 import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
 	"k8s.io/apiserver/pkg/registry/generic"
 	genericregistry "k8s.io/apiserver/pkg/registry/generic/registry"
 	"k8s.io/apiserver/pkg/registry/rest"
@@ -61,3 +65,37 @@ var _ rest.ShortNamesProvider = &REST{}
 func (r *REST) ShortNames() []string {
 	return []string{"ep"}
 }
+
+// EndpointsSummary counts the contents of an Endpoints object, which helps to
+// spot services with pathological endpoint counts.
+type EndpointsSummary struct {
+	Subsets           int
+	ReadyAddresses    int
+	NotReadyAddresses int
+	Ports             int
+}
+
+func (s EndpointsSummary) String() string {
+	return fmt.Sprintf("%d subsets, %d ready addresses, %d not ready addresses, %d ports",
+		s.Subsets, s.ReadyAddresses, s.NotReadyAddresses, s.Ports)
+}
+
+// SummarizeEndpoints returns the summary of the given endpoints.
+func SummarizeEndpoints(endpoints *api.Endpoints) EndpointsSummary {
+	summary := EndpointsSummary{Subsets: len(endpoints.Subsets)}
+	for i := range endpoints.Subsets {
+		summary.ReadyAddresses += len(endpoints.Subsets[i].Addresses)
+		summary.NotReadyAddresses += len(endpoints.Subsets[i].NotReadyAddresses)
+		summary.Ports += len(endpoints.Subsets[i].Ports)
+	}
+	return summary
+}
+
+// Summary returns the summary of the named endpoints, for debugging.
+func (r *REST) Summary(ctx genericapirequest.Context, name string) (EndpointsSummary, error) {
+	obj, err := r.Get(ctx, name, &metav1.GetOptions{})
+	if err != nil {
+		return EndpointsSummary{}, err
+	}
+	return SummarizeEndpoints(obj.(*api.Endpoints)), nil
+}
@@ -148,3 +148,29 @@ func TestWatch(t *testing.T) {
 		},
 	)
 }
+
+func TestSummarizeEndpoints(t *testing.T) {
+	endpoints := &api.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: metav1.NamespaceDefault},
+		Subsets: []api.EndpointSubset{
+			{
+				Addresses:         []api.EndpointAddress{{IP: "1.2.3.4"}, {IP: "5.6.7.8"}},
+				NotReadyAddresses: []api.EndpointAddress{{IP: "9.10.11.12"}},
+				Ports:             []api.EndpointPort{{Name: "http", Port: 80, Protocol: "TCP"}, {Name: "https", Port: 443, Protocol: "TCP"}},
+			},
+			{
+				Addresses: []api.EndpointAddress{{IP: "1.2.3.5"}},
+				Ports:     []api.EndpointPort{{Port: 53, Protocol: "UDP"}},
+			},
+			{
+				NotReadyAddresses: []api.EndpointAddress{{IP: "1.2.3.6"}, {IP: "1.2.3.7"}},
+				Ports:             []api.EndpointPort{{Port: 8080, Protocol: "TCP"}},
+			},
+		},
+	}
+
+	expected := EndpointsSummary{Subsets: 3, ReadyAddresses: 3, NotReadyAddresses: 3, Ports: 4}
+	if summary := SummarizeEndpoints(endpoints); summary != expected {
+		t.Errorf("expected summary %+v, got %+v", expected, summary)
+	}
+}